@@ -1,14 +1,20 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	pb "github.com/pion/ion-avp/cmd/signal/grpc/proto"
 	"github.com/pion/ion-avp/cmd/signal/grpc/server"
 	avp "github.com/pion/ion-avp/pkg"
+	"github.com/pion/ion-avp/pkg/elements"
 	log "github.com/pion/ion-log"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
@@ -18,12 +24,85 @@ var (
 	conf = avp.Config{}
 	file string
 	addr string
+	whip string
+	live string
+	dir  string
 )
 
+// packagerconf is the process config of the packager element
+type packagerconf struct {
+	Format  string  `json:"format"`
+	Segment float64 `json:"segment"`
+	Window  int     `json:"window"`
+	DASH    bool    `json:"dash"`
+	Kind    string  `json:"kind"`
+}
+
+// vadconf is the process config of the vad element
+type vadconf struct {
+	Threshold float64 `json:"threshold"`
+	Label     string  `json:"label"`
+}
+
+// pathName returns an id usable as a single path element
+func pathName(id string) string {
+	id = strings.NewReplacer("/", "_", "\\", "_").Replace(id)
+	if id == "" || id == "." || id == ".." {
+		return "_" + id
+	}
+	return id
+}
+
+// processes are the elements of the processes by eid
+var processes = map[string]avp.ElementFun{
+	"packager": createPackager,
+	"vad":      createVAD,
+}
+
+// createPackager packages the tracks of a process to dir/sid/pid
+func createPackager(sid, pid, tid string, config []byte) avp.Element {
+	c := packagerconf{}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &c); err != nil {
+			log.Warnf("invalid packager config: %s", err)
+		}
+	}
+	return elements.NewPackager(elements.PackagerConfig{
+		Dir:             filepath.Join(dir, pathName(sid), pathName(pid)),
+		Format:          c.Format,
+		SegmentDuration: time.Duration(c.Segment * float64(time.Second)),
+		WindowSize:      c.Window,
+		DASH:            c.DASH,
+		AudioOnly:       c.Kind == "audio",
+		VideoOnly:       c.Kind == "video",
+	})
+}
+
+// createVAD sends the speech events of the audio tracks of a process to
+// the session clients over a data channel, labeled "vad" by default
+func createVAD(sid, pid, tid string, config []byte) avp.Element {
+	c := vadconf{Label: "vad"}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &c); err != nil {
+			log.Warnf("invalid vad config: %s", err)
+		}
+	}
+	vad := elements.NewVAD(elements.VADConfig{Threshold: c.Threshold})
+	events := elements.NewFilter(func(sample *avp.Sample) bool {
+		return sample.Type == elements.TypeMetadata
+	})
+	events.Attach(elements.NewDataChannelWriter(elements.DataChannelConfig{Label: c.Label}))
+	vad.Attach(events)
+	return vad
+}
+
 func showHelp() {
 	fmt.Printf("Usage:%s {params}\n", os.Args[0])
 	fmt.Println("      -c {config file}")
 	fmt.Println("      -a {listen addr}")
+	fmt.Println("      -w {whip listen addr}")
+	fmt.Println("      -l {live http listen addr}")
+	fmt.Println("      -o {live output dir}")
 	fmt.Println("      -h (show help info)")
 }
 
@@ -54,6 +133,9 @@ func load() bool {
 func parse() bool {
 	flag.StringVar(&file, "c", "config.toml", "config file")
 	flag.StringVar(&addr, "a", ":50052", "address to use")
+	flag.StringVar(&whip, "w", "", "whip address to use, disabled when empty")
+	flag.StringVar(&live, "l", "", "live http address to use, disabled when empty")
+	flag.StringVar(&dir, "o", "live", "live output directory")
 	help := flag.Bool("h", false, "help info")
 	flag.Parse()
 	if !load() {
@@ -82,8 +164,31 @@ func main() {
 	log.Infof("--- AVP Node Listening at %s ---", addr)
 
 	s := grpc.NewServer()
-	srv := server.NewAVPServer(conf, map[string]avp.ElementFun{})
-	pb.RegisterAVPServer(s, srv)
+	a := server.NewAVP(conf, processes)
+	pb.RegisterAVPServer(s, server.NewServer(a))
+
+	if whip != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/whip", a.WHIP())
+		mux.Handle("/whip/", a.WHIP())
+		go func() {
+			log.Infof("--- WHIP Endpoint Listening at %s/whip ---", whip)
+			if err := http.ListenAndServe(whip, mux); err != nil {
+				log.Panicf("failed to serve whip: %v", err)
+			}
+		}()
+	}
+
+	if live != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/live/", http.StripPrefix("/live/", elements.NewPackagerHandler(dir)))
+		go func() {
+			log.Infof("--- Live Endpoint Listening at %s/live ---", live)
+			if err := http.ListenAndServe(live, mux); err != nil {
+				log.Panicf("failed to serve live: %v", err)
+			}
+		}()
+	}
 
 	if err := s.Serve(lis); err != nil {
 		log.Panicf("failed to serve: %v", err)
@@ -20,6 +20,58 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type ProcessState_State int32
+
+const (
+	ProcessState_PENDING ProcessState_State = 0 // waiting for its track
+	ProcessState_ACTIVE  ProcessState_State = 1 // attached to its track
+	ProcessState_EXPIRED ProcessState_State = 2 // its track was not received within the pending ttl
+	ProcessState_FAILED  ProcessState_State = 3 // the process could not be created
+)
+
+// Enum value maps for ProcessState_State.
+var (
+	ProcessState_State_name = map[int32]string{
+		0: "PENDING",
+		1: "ACTIVE",
+		2: "EXPIRED",
+		3: "FAILED",
+	}
+	ProcessState_State_value = map[string]int32{
+		"PENDING": 0,
+		"ACTIVE":  1,
+		"EXPIRED": 2,
+		"FAILED":  3,
+	}
+)
+
+func (x ProcessState_State) Enum() *ProcessState_State {
+	p := new(ProcessState_State)
+	*p = x
+	return p
+}
+
+func (x ProcessState_State) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ProcessState_State) Descriptor() protoreflect.EnumDescriptor {
+	return file_cmd_signal_grpc_proto_avp_proto_enumTypes[0].Descriptor()
+}
+
+func (ProcessState_State) Type() protoreflect.EnumType {
+	return &file_cmd_signal_grpc_proto_avp_proto_enumTypes[0]
+}
+
+func (x ProcessState_State) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ProcessState_State.Descriptor instead.
+func (ProcessState_State) EnumDescriptor() ([]byte, []int) {
+	return file_cmd_signal_grpc_proto_avp_proto_rawDescGZIP(), []int{4, 0}
+}
+
 type SignalRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -27,6 +79,7 @@ type SignalRequest struct {
 
 	// Types that are assignable to Payload:
 	//	*SignalRequest_Process
+	//	*SignalRequest_Status
 	Payload isSignalRequest_Payload `protobuf_oneof:"payload"`
 }
 
@@ -76,6 +129,13 @@ func (x *SignalRequest) GetProcess() *Process {
 	return nil
 }
 
+func (x *SignalRequest) GetStatus() *Status {
+	if x, ok := x.GetPayload().(*SignalRequest_Status); ok {
+		return x.Status
+	}
+	return nil
+}
+
 type isSignalRequest_Payload interface {
 	isSignalRequest_Payload()
 }
@@ -84,12 +144,23 @@ type SignalRequest_Process struct {
 	Process *Process `protobuf:"bytes,1,opt,name=process,proto3,oneof"`
 }
 
+type SignalRequest_Status struct {
+	Status *Status `protobuf:"bytes,2,opt,name=status,proto3,oneof"`
+}
+
 func (*SignalRequest_Process) isSignalRequest_Payload() {}
 
+func (*SignalRequest_Status) isSignalRequest_Payload() {}
+
 type SignalReply struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Payload:
+	//	*SignalReply_Process
+	//	*SignalReply_Status
+	Payload isSignalReply_Payload `protobuf_oneof:"payload"`
 }
 
 func (x *SignalReply) Reset() {
@@ -124,16 +195,53 @@ func (*SignalReply) Descriptor() ([]byte, []int) {
 	return file_cmd_signal_grpc_proto_avp_proto_rawDescGZIP(), []int{1}
 }
 
+func (m *SignalReply) GetPayload() isSignalReply_Payload {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (x *SignalReply) GetProcess() *ProcessState {
+	if x, ok := x.GetPayload().(*SignalReply_Process); ok {
+		return x.Process
+	}
+	return nil
+}
+
+func (x *SignalReply) GetStatus() *StatusReply {
+	if x, ok := x.GetPayload().(*SignalReply_Status); ok {
+		return x.Status
+	}
+	return nil
+}
+
+type isSignalReply_Payload interface {
+	isSignalReply_Payload()
+}
+
+type SignalReply_Process struct {
+	Process *ProcessState `protobuf:"bytes,1,opt,name=process,proto3,oneof"` // a requested process failed or expired
+}
+
+type SignalReply_Status struct {
+	Status *StatusReply `protobuf:"bytes,2,opt,name=status,proto3,oneof"`
+}
+
+func (*SignalReply_Process) isSignalReply_Payload() {}
+
+func (*SignalReply_Status) isSignalReply_Payload() {}
+
 // Process describes an a/v process
 type Process struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Sfu    string `protobuf:"bytes,1,opt,name=sfu,proto3" json:"sfu,omitempty"` // media sfu
+	Sfu    string `protobuf:"bytes,1,opt,name=sfu,proto3" json:"sfu,omitempty"` // media sfu, empty for a local source
 	Pid    string `protobuf:"bytes,2,opt,name=pid,proto3" json:"pid,omitempty"` // pipeline id
 	Sid    string `protobuf:"bytes,3,opt,name=sid,proto3" json:"sid,omitempty"` // session id
-	Tid    string `protobuf:"bytes,4,opt,name=tid,proto3" json:"tid,omitempty"` // track id
+	Tid    string `protobuf:"bytes,4,opt,name=tid,proto3" json:"tid,omitempty"` // track id or selector, e.g. * or kind=audio
 	Eid    string `protobuf:"bytes,5,opt,name=eid,proto3" json:"eid,omitempty"` // element id
 	Config []byte `protobuf:"bytes,6,opt,name=config,proto3" json:"config,omitempty"`
 }
@@ -212,32 +320,254 @@ func (x *Process) GetConfig() []byte {
 	return nil
 }
 
+// Status requests the state of the processes of a session
+type Status struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Sfu string `protobuf:"bytes,1,opt,name=sfu,proto3" json:"sfu,omitempty"` // media sfu, empty for a local source
+	Sid string `protobuf:"bytes,2,opt,name=sid,proto3" json:"sid,omitempty"` // session id
+}
+
+func (x *Status) Reset() {
+	*x = Status{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cmd_signal_grpc_proto_avp_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Status) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Status) ProtoMessage() {}
+
+func (x *Status) ProtoReflect() protoreflect.Message {
+	mi := &file_cmd_signal_grpc_proto_avp_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Status.ProtoReflect.Descriptor instead.
+func (*Status) Descriptor() ([]byte, []int) {
+	return file_cmd_signal_grpc_proto_avp_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Status) GetSfu() string {
+	if x != nil {
+		return x.Sfu
+	}
+	return ""
+}
+
+func (x *Status) GetSid() string {
+	if x != nil {
+		return x.Sid
+	}
+	return ""
+}
+
+// ProcessState describes the state of a process
+type ProcessState struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Sid   string             `protobuf:"bytes,1,opt,name=sid,proto3" json:"sid,omitempty"` // session id
+	Pid   string             `protobuf:"bytes,2,opt,name=pid,proto3" json:"pid,omitempty"` // pipeline id
+	Tid   string             `protobuf:"bytes,3,opt,name=tid,proto3" json:"tid,omitempty"` // track id or selector
+	State ProcessState_State `protobuf:"varint,4,opt,name=state,proto3,enum=avp.ProcessState_State" json:"state,omitempty"`
+	Error string             `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *ProcessState) Reset() {
+	*x = ProcessState{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cmd_signal_grpc_proto_avp_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ProcessState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProcessState) ProtoMessage() {}
+
+func (x *ProcessState) ProtoReflect() protoreflect.Message {
+	mi := &file_cmd_signal_grpc_proto_avp_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProcessState.ProtoReflect.Descriptor instead.
+func (*ProcessState) Descriptor() ([]byte, []int) {
+	return file_cmd_signal_grpc_proto_avp_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ProcessState) GetSid() string {
+	if x != nil {
+		return x.Sid
+	}
+	return ""
+}
+
+func (x *ProcessState) GetPid() string {
+	if x != nil {
+		return x.Pid
+	}
+	return ""
+}
+
+func (x *ProcessState) GetTid() string {
+	if x != nil {
+		return x.Tid
+	}
+	return ""
+}
+
+func (x *ProcessState) GetState() ProcessState_State {
+	if x != nil {
+		return x.State
+	}
+	return ProcessState_PENDING
+}
+
+func (x *ProcessState) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// StatusReply lists the processes of a session
+type StatusReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Sid       string          `protobuf:"bytes,1,opt,name=sid,proto3" json:"sid,omitempty"` // session id
+	Processes []*ProcessState `protobuf:"bytes,2,rep,name=processes,proto3" json:"processes,omitempty"`
+}
+
+func (x *StatusReply) Reset() {
+	*x = StatusReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_cmd_signal_grpc_proto_avp_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StatusReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatusReply) ProtoMessage() {}
+
+func (x *StatusReply) ProtoReflect() protoreflect.Message {
+	mi := &file_cmd_signal_grpc_proto_avp_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatusReply.ProtoReflect.Descriptor instead.
+func (*StatusReply) Descriptor() ([]byte, []int) {
+	return file_cmd_signal_grpc_proto_avp_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *StatusReply) GetSid() string {
+	if x != nil {
+		return x.Sid
+	}
+	return ""
+}
+
+func (x *StatusReply) GetProcesses() []*ProcessState {
+	if x != nil {
+		return x.Processes
+	}
+	return nil
+}
+
 var File_cmd_signal_grpc_proto_avp_proto protoreflect.FileDescriptor
 
 var file_cmd_signal_grpc_proto_avp_proto_rawDesc = []byte{
 	0x0a, 0x1f, 0x63, 0x6d, 0x64, 0x2f, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x2f, 0x67, 0x72, 0x70,
 	0x63, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x61, 0x76, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x12, 0x03, 0x61, 0x76, 0x70, 0x22, 0x44, 0x0a, 0x0d, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c,
+	0x6f, 0x12, 0x03, 0x61, 0x76, 0x70, 0x22, 0x6b, 0x0a, 0x0d, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c,
 	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x28, 0x0a, 0x07, 0x70, 0x72, 0x6f, 0x63, 0x65,
 	0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x61, 0x76, 0x70, 0x2e, 0x50,
 	0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x48, 0x00, 0x52, 0x07, 0x70, 0x72, 0x6f, 0x63, 0x65, 0x73,
-	0x73, 0x42, 0x09, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x22, 0x0d, 0x0a, 0x0b,
-	0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x7b, 0x0a, 0x07, 0x50,
-	0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x66, 0x75, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x66, 0x75, 0x12, 0x10, 0x0a, 0x03, 0x70, 0x69, 0x64, 0x18,
-	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x70, 0x69, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x69,
-	0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x69, 0x64, 0x12, 0x10, 0x0a, 0x03,
-	0x74, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x74, 0x69, 0x64, 0x12, 0x10,
-	0x0a, 0x03, 0x65, 0x69, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x65, 0x69, 0x64,
-	0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0c,
-	0x52, 0x06, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x32, 0x3b, 0x0a, 0x03, 0x41, 0x56, 0x50, 0x12,
-	0x34, 0x0a, 0x06, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x12, 0x12, 0x2e, 0x61, 0x76, 0x70, 0x2e,
-	0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x10, 0x2e,
-	0x61, 0x76, 0x70, 0x2e, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22,
-	0x00, 0x28, 0x01, 0x30, 0x01, 0x42, 0x2f, 0x5a, 0x2d, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
-	0x63, 0x6f, 0x6d, 0x2f, 0x70, 0x69, 0x6f, 0x6e, 0x2f, 0x69, 0x6f, 0x6e, 0x2d, 0x61, 0x76, 0x70,
-	0x2f, 0x63, 0x6d, 0x64, 0x2f, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x2f, 0x67, 0x72, 0x70, 0x63,
-	0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x73, 0x12, 0x25, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x0b, 0x2e, 0x61, 0x76, 0x70, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x48, 0x00,
+	0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x42, 0x09, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c,
+	0x6f, 0x61, 0x64, 0x22, 0x73, 0x0a, 0x0b, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x52, 0x65, 0x70,
+	0x6c, 0x79, 0x12, 0x2d, 0x0a, 0x07, 0x70, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x61, 0x76, 0x70, 0x2e, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73,
+	0x73, 0x53, 0x74, 0x61, 0x74, 0x65, 0x48, 0x00, 0x52, 0x07, 0x70, 0x72, 0x6f, 0x63, 0x65, 0x73,
+	0x73, 0x12, 0x2a, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x10, 0x2e, 0x61, 0x76, 0x70, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65,
+	0x70, 0x6c, 0x79, 0x48, 0x00, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x42, 0x09, 0x0a,
+	0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x22, 0x7b, 0x0a, 0x07, 0x50, 0x72, 0x6f, 0x63,
+	0x65, 0x73, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x66, 0x75, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x03, 0x73, 0x66, 0x75, 0x12, 0x10, 0x0a, 0x03, 0x70, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x03, 0x70, 0x69, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x69, 0x64, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x69, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x74, 0x69, 0x64,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x74, 0x69, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x65,
+	0x69, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x65, 0x69, 0x64, 0x12, 0x16, 0x0a,
+	0x06, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x63,
+	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x22, 0x2c, 0x0a, 0x06, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12,
+	0x10, 0x0a, 0x03, 0x73, 0x66, 0x75, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x66,
+	0x75, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03,
+	0x73, 0x69, 0x64, 0x22, 0xc4, 0x01, 0x0a, 0x0c, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x53,
+	0x74, 0x61, 0x74, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x03, 0x73, 0x69, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x70, 0x69, 0x64, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x03, 0x70, 0x69, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x74, 0x69, 0x64, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x74, 0x69, 0x64, 0x12, 0x2d, 0x0a, 0x05, 0x73, 0x74,
+	0x61, 0x74, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x17, 0x2e, 0x61, 0x76, 0x70, 0x2e,
+	0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x53, 0x74, 0x61, 0x74, 0x65, 0x2e, 0x53, 0x74, 0x61,
+	0x74, 0x65, 0x52, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72,
+	0x6f, 0x72, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x22,
+	0x39, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x50, 0x45, 0x4e, 0x44,
+	0x49, 0x4e, 0x47, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06, 0x41, 0x43, 0x54, 0x49, 0x56, 0x45, 0x10,
+	0x01, 0x12, 0x0b, 0x0a, 0x07, 0x45, 0x58, 0x50, 0x49, 0x52, 0x45, 0x44, 0x10, 0x02, 0x12, 0x0a,
+	0x0a, 0x06, 0x46, 0x41, 0x49, 0x4c, 0x45, 0x44, 0x10, 0x03, 0x22, 0x50, 0x0a, 0x0b, 0x53, 0x74,
+	0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x69, 0x64,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x73, 0x69, 0x64, 0x12, 0x2f, 0x0a, 0x09, 0x70,
+	0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x11,
+	0x2e, 0x61, 0x76, 0x70, 0x2e, 0x50, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x53, 0x74, 0x61, 0x74,
+	0x65, 0x52, 0x09, 0x70, 0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x65, 0x73, 0x32, 0x3b, 0x0a, 0x03,
+	0x41, 0x56, 0x50, 0x12, 0x34, 0x0a, 0x06, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x12, 0x12, 0x2e,
+	0x61, 0x76, 0x70, 0x2e, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x10, 0x2e, 0x61, 0x76, 0x70, 0x2e, 0x53, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x52, 0x65,
+	0x70, 0x6c, 0x79, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x42, 0x2f, 0x5a, 0x2d, 0x67, 0x69, 0x74,
+	0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x70, 0x69, 0x6f, 0x6e, 0x2f, 0x69, 0x6f, 0x6e,
+	0x2d, 0x61, 0x76, 0x70, 0x2f, 0x63, 0x6d, 0x64, 0x2f, 0x73, 0x69, 0x67, 0x6e, 0x61, 0x6c, 0x2f,
+	0x67, 0x72, 0x70, 0x63, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
 }
 
 var (
@@ -252,21 +582,31 @@ func file_cmd_signal_grpc_proto_avp_proto_rawDescGZIP() []byte {
 	return file_cmd_signal_grpc_proto_avp_proto_rawDescData
 }
 
-var file_cmd_signal_grpc_proto_avp_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_cmd_signal_grpc_proto_avp_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_cmd_signal_grpc_proto_avp_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
 var file_cmd_signal_grpc_proto_avp_proto_goTypes = []interface{}{
-	(*SignalRequest)(nil), // 0: avp.SignalRequest
-	(*SignalReply)(nil),   // 1: avp.SignalReply
-	(*Process)(nil),       // 2: avp.Process
+	(ProcessState_State)(0), // 0: avp.ProcessState.State
+	(*SignalRequest)(nil),   // 1: avp.SignalRequest
+	(*SignalReply)(nil),     // 2: avp.SignalReply
+	(*Process)(nil),         // 3: avp.Process
+	(*Status)(nil),          // 4: avp.Status
+	(*ProcessState)(nil),    // 5: avp.ProcessState
+	(*StatusReply)(nil),     // 6: avp.StatusReply
 }
 var file_cmd_signal_grpc_proto_avp_proto_depIdxs = []int32{
-	2, // 0: avp.SignalRequest.process:type_name -> avp.Process
-	0, // 1: avp.AVP.Signal:input_type -> avp.SignalRequest
-	1, // 2: avp.AVP.Signal:output_type -> avp.SignalReply
-	2, // [2:3] is the sub-list for method output_type
-	1, // [1:2] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	3, // 0: avp.SignalRequest.process:type_name -> avp.Process
+	4, // 1: avp.SignalRequest.status:type_name -> avp.Status
+	5, // 2: avp.SignalReply.process:type_name -> avp.ProcessState
+	6, // 3: avp.SignalReply.status:type_name -> avp.StatusReply
+	0, // 4: avp.ProcessState.state:type_name -> avp.ProcessState.State
+	5, // 5: avp.StatusReply.processes:type_name -> avp.ProcessState
+	1, // 6: avp.AVP.Signal:input_type -> avp.SignalRequest
+	2, // 7: avp.AVP.Signal:output_type -> avp.SignalReply
+	7, // [7:8] is the sub-list for method output_type
+	6, // [6:7] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
 }
 
 func init() { file_cmd_signal_grpc_proto_avp_proto_init() }
@@ -311,22 +651,64 @@ func file_cmd_signal_grpc_proto_avp_proto_init() {
 				return nil
 			}
 		}
+		file_cmd_signal_grpc_proto_avp_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Status); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cmd_signal_grpc_proto_avp_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ProcessState); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_cmd_signal_grpc_proto_avp_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StatusReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	file_cmd_signal_grpc_proto_avp_proto_msgTypes[0].OneofWrappers = []interface{}{
 		(*SignalRequest_Process)(nil),
+		(*SignalRequest_Status)(nil),
+	}
+	file_cmd_signal_grpc_proto_avp_proto_msgTypes[1].OneofWrappers = []interface{}{
+		(*SignalReply_Process)(nil),
+		(*SignalReply_Status)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_cmd_signal_grpc_proto_avp_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   3,
+			NumEnums:      1,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_cmd_signal_grpc_proto_avp_proto_goTypes,
 		DependencyIndexes: file_cmd_signal_grpc_proto_avp_proto_depIdxs,
+		EnumInfos:         file_cmd_signal_grpc_proto_avp_proto_enumTypes,
 		MessageInfos:      file_cmd_signal_grpc_proto_avp_proto_msgTypes,
 	}.Build()
 	File_cmd_signal_grpc_proto_avp_proto = out.File
@@ -5,38 +5,125 @@ import (
 	"sync"
 
 	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
 )
 
+// processKey identifies a process request
+type processKey struct {
+	addr, sid, pid, tid string
+}
+
 // AVP represents an avp instance
 type AVP struct {
-	config  avp.Config
-	clients map[string]*SFU
-	mu      sync.RWMutex
+	config   avp.Config
+	clients  map[string]*SFU
+	whip     *WHIP
+	rtp      map[string]*avp.RTPTransport
+	requests map[processKey]*requester
+	mu       sync.RWMutex
 }
 
 // NewAVP creates a new avp instance
 func NewAVP(c avp.Config, elems map[string]avp.ElementFun) *AVP {
 	a := &AVP{
-		config:  c,
-		clients: make(map[string]*SFU),
+		config:   c,
+		clients:  make(map[string]*SFU),
+		whip:     NewWHIP(c),
+		rtp:      make(map[string]*avp.RTPTransport),
+		requests: make(map[processKey]*requester),
 	}
 
 	avp.Init(elems)
 
+	for _, r := range c.RTP {
+		streams, err := r.RTPStreams()
+		if err != nil {
+			log.Errorf("error reading rtp source %s: %s", r.ID, err)
+			continue
+		}
+		t, err := avp.NewRTPTransport(r.ID, c, streams)
+		if err != nil {
+			log.Errorf("error creating rtp source %s: %s", r.ID, err)
+			continue
+		}
+		a.rtp[r.ID] = t
+	}
+
 	return a
 }
 
-// Process starts a process for a track.
+// WHIP returns the whip endpoint of the avp
+func (a *AVP) WHIP() *WHIP {
+	return a.whip
+}
+
+// Process starts a process for a track. Without an sfu address, sid
+// is the id of an rtp source or of a resource published to the whip
+// endpoint.
 func (a *AVP) Process(ctx context.Context, addr, pid, sid, tid, eid string, config []byte) error {
+	t, err := a.transport(addr, sid, true)
+	if err != nil {
+		return err
+	}
+	return t.Process(pid, tid, eid, config)
+}
+
+// Status returns the processes of a session, none when the session
+// has no transport.
+func (a *AVP) Status(addr, sid string) []avp.ProcessInfo {
+	t, err := a.transport(addr, sid, false)
+	if err != nil || t == nil {
+		return nil
+	}
+	return t.Processes()
+}
+
+// transport returns the transport of a session. The sfu session is
+// joined when create is set, otherwise nil is returned when it wasn't.
+func (a *AVP) transport(addr, sid string, create bool) (avp.Transport, error) {
+	var t avp.Transport
+	if addr == "" {
+		var err error
+		if t, err = a.local(sid); err != nil {
+			return nil, err
+		}
+	} else {
+		c, err := a.client(addr, create)
+		if err != nil || c == nil {
+			return nil, err
+		}
+
+		if !create {
+			wt := c.Transport(sid)
+			if wt == nil {
+				return nil, nil
+			}
+			t = wt
+		} else {
+			if t, err = c.GetTransport(sid); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	t.OnProcessExpired(func(pid, tid string) {
+		a.expired(processKey{addr: addr, sid: sid, pid: pid, tid: tid})
+	})
+	return t, nil
+}
+
+// client returns the sfu client of an address, connecting to the sfu
+// when create is set.
+func (a *AVP) client(addr string, create bool) (*SFU, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
 	c := a.clients[addr]
 	// no client yet, create one
-	if c == nil {
+	if c == nil && create {
 		var err error
 		if c, err = NewSFU(addr, a.config); err != nil {
-			return err
+			return nil, err
 		}
 		c.OnClose(func() {
 			a.mu.Lock()
@@ -46,10 +133,55 @@ func (a *AVP) Process(ctx context.Context, addr, pid, sid, tid, eid string, conf
 		a.clients[addr] = c
 	}
 
-	t, err := c.GetTransport(sid)
+	return c, nil
+}
+
+// local returns the transport of a source received by the avp
+func (a *AVP) local(sid string) (avp.Transport, error) {
+	if t := a.rtp[sid]; t != nil {
+		return t, nil
+	}
+
+	t, err := a.whip.GetTransport(sid)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return t, nil
+}
 
-	return t.Process(pid, tid, eid, config)
+// watch notifies r when the requested process expires
+func (a *AVP) watch(r *requester, addr, sid, pid, tid string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests[processKey{addr: addr, sid: sid, pid: pid, tid: tid}] = r
+}
+
+// forget the requests of r when its signal stream ended
+func (a *AVP) forget(r *requester) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, req := range a.requests {
+		if req == r {
+			delete(a.requests, k)
+		}
+	}
+}
+
+// forgetProcess forgets the request of a process that failed
+func (a *AVP) forgetProcess(addr, sid, pid, tid string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.requests, processKey{addr: addr, sid: sid, pid: pid, tid: tid})
+}
+
+// expired notifies the requester of an expired process
+func (a *AVP) expired(k processKey) {
+	a.mu.Lock()
+	r := a.requests[k]
+	delete(a.requests, k)
+	a.mu.Unlock()
+
+	if r != nil {
+		r.expired(k.sid, k.pid, k.tid)
+	}
 }
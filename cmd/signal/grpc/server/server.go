@@ -2,6 +2,7 @@ package server
 
 import (
 	"io"
+	"sync"
 
 	pb "github.com/pion/ion-avp/cmd/signal/grpc/proto"
 	avp "github.com/pion/ion-avp/pkg"
@@ -16,13 +17,64 @@ type server struct {
 }
 
 func NewAVPServer(conf avp.Config, elems map[string]avp.ElementFun) pb.AVPServer {
+	return NewServer(NewAVP(conf, elems))
+}
+
+// NewServer creates an avp grpc server for an avp instance
+func NewServer(a *AVP) pb.AVPServer {
 	return &server{
-		avp: NewAVP(conf, elems),
+		avp: a,
 	}
 }
 
+// requester sends the replies of a signal stream, replies to expired
+// processes are sent from other goroutines.
+type requester struct {
+	mu     sync.Mutex
+	stream pb.AVP_SignalServer
+}
+
+func (r *requester) send(reply *pb.SignalReply) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.stream.Send(reply); err != nil {
+		log.Errorf("error sending signal reply: %s", err)
+	}
+}
+
+func (r *requester) failed(p *pb.Process, err error) {
+	r.send(&pb.SignalReply{
+		Payload: &pb.SignalReply_Process{
+			Process: &pb.ProcessState{
+				Sid:   p.Sid,
+				Pid:   p.Pid,
+				Tid:   p.Tid,
+				State: pb.ProcessState_FAILED,
+				Error: err.Error(),
+			},
+		},
+	})
+}
+
+func (r *requester) expired(sid, pid, tid string) {
+	r.send(&pb.SignalReply{
+		Payload: &pb.SignalReply_Process{
+			Process: &pb.ProcessState{
+				Sid:   sid,
+				Pid:   pid,
+				Tid:   tid,
+				State: pb.ProcessState_EXPIRED,
+				Error: "track not found",
+			},
+		},
+	})
+}
+
 // Signal handler for avp server
 func (s *server) Signal(stream pb.AVP_SignalServer) error {
+	r := &requester{stream: stream}
+	defer s.avp.forget(r)
+
 	for {
 		in, err := stream.Recv()
 
@@ -40,18 +92,47 @@ func (s *server) Signal(stream pb.AVP_SignalServer) error {
 			return err
 		}
 
-		if payload, ok := in.Payload.(*pb.SignalRequest_Process); ok {
+		switch payload := in.Payload.(type) {
+		case *pb.SignalRequest_Process:
+			p := payload.Process
+			// watch before processing, the process may expire right away
+			s.avp.watch(r, p.Sfu, p.Sid, p.Pid, p.Tid)
 			if err = s.avp.Process(
 				stream.Context(),
-				payload.Process.Sfu,
-				payload.Process.Pid,
-				payload.Process.Sid,
-				payload.Process.Tid,
-				payload.Process.Eid,
-				payload.Process.Config,
+				p.Sfu,
+				p.Pid,
+				p.Sid,
+				p.Tid,
+				p.Eid,
+				p.Config,
 			); err != nil {
 				log.Errorf("process error: %v", err)
+				s.avp.forgetProcess(p.Sfu, p.Sid, p.Pid, p.Tid)
+				r.failed(p, err)
+			}
+
+		case *pb.SignalRequest_Status:
+			reply := &pb.StatusReply{Sid: payload.Status.Sid}
+			for _, info := range s.avp.Status(payload.Status.Sfu, payload.Status.Sid) {
+				reply.Processes = append(reply.Processes, &pb.ProcessState{
+					Sid:   payload.Status.Sid,
+					Pid:   info.PID,
+					Tid:   info.TID,
+					State: processState(info.State),
+				})
 			}
+			r.send(&pb.SignalReply{
+				Payload: &pb.SignalReply_Status{
+					Status: reply,
+				},
+			})
 		}
 	}
 }
+
+func processState(state avp.ProcessState) pb.ProcessState_State {
+	if state == avp.ProcessActive {
+		return pb.ProcessState_ACTIVE
+	}
+	return pb.ProcessState_PENDING
+}
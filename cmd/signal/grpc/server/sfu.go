@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"sync"
 
@@ -15,6 +16,8 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+var errTransportInitFailed = errors.New("transport init failed")
+
 // SFU client
 type SFU struct {
 	ctx        context.Context
@@ -74,6 +77,14 @@ func (s *SFU) GetTransport(sid string) (*avp.WebRTCTransport, error) {
 	return t, nil
 }
 
+// Transport returns the webrtc transport of a session, or nil when
+// the session wasn't joined
+func (s *SFU) Transport(sid string) *avp.WebRTCTransport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.transports[sid]
+}
+
 // OnClose handler called when sfu client is closed
 func (s *SFU) OnClose(f func()) {
 	s.onCloseFn = f
@@ -84,23 +95,51 @@ func (s *SFU) OnClose(f func()) {
 func (s *SFU) join(sid string) (*avp.WebRTCTransport, error) {
 	log.Infof("Joining sfu session: %s", sid)
 
-	sfustream, err := s.client.Signal(s.ctx)
+	t := avp.NewWebRTCTransport(sid, s.config)
+	if t == nil {
+		return nil, errTransportInitFailed
+	}
 
+	cancel, err := s.signal(sid, t)
 	if err != nil {
-		log.Errorf("error creating sfu stream: %s", err)
+		t.Close()
 		return nil, err
 	}
 
-	t := avp.NewWebRTCTransport(sid, s.config)
+	// Rejoin the session on a new signal stream when the
+	// transport peer connections are replaced.
+	t.OnReconnect(func() error {
+		cancel()
+		var err error
+		cancel, err = s.signal(sid, t)
+		return err
+	})
+
+	return t, nil
+}
+
+// signal opens a new signal stream and joins the session with the
+// transport. The returned cancel func closes the signal stream.
+func (s *SFU) signal(sid string, t *avp.WebRTCTransport) (context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	sfustream, err := s.client.Signal(ctx)
+
+	if err != nil {
+		log.Errorf("error creating sfu stream: %s", err)
+		cancel()
+		return nil, err
+	}
 
 	offer, err := t.CreateOffer()
 	if err != nil {
 		log.Errorf("Error creating offer: %v", err)
+		cancel()
 		return nil, err
 	}
 
 	marshalled, err := json.Marshal(offer)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
@@ -118,6 +157,7 @@ func (s *SFU) join(sid string) (*avp.WebRTCTransport, error) {
 
 	if err != nil {
 		log.Errorf("Error sending publish request: %v", err)
+		cancel()
 		return nil, err
 	}
 
@@ -143,6 +183,30 @@ func (s *SFU) join(sid string) (*avp.WebRTCTransport, error) {
 		}
 	})
 
+	t.OnNegotiationNeeded(func() {
+		offer, err := t.CreateOffer()
+		if err != nil {
+			log.Errorf("Error creating offer: %v", err)
+			return
+		}
+
+		marshalled, err := json.Marshal(offer)
+		if err != nil {
+			log.Errorf("sdp marshall error %s", err)
+			return
+		}
+
+		log.Debugf("Send renegotiation offer:\n %s", offer.SDP)
+		err = sfustream.Send(&sfu.SignalRequest{
+			Payload: &sfu.SignalRequest_Description{
+				Description: marshalled,
+			},
+		})
+		if err != nil {
+			log.Errorf("negotiate error %s", err)
+		}
+	})
+
 	go func() {
 		// Handle sfu stream messages
 		for {
@@ -243,5 +307,5 @@ func (s *SFU) join(sid string) (*avp.WebRTCTransport, error) {
 		}
 	}()
 
-	return t, nil
+	return cancel, nil
 }
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	whipContentType = "application/sdp"
+	maxOfferSize    = 1 << 20
+)
+
+var errResourceNotFound = errors.New("whip resource not found")
+
+// WHIP ingests media published with the webrtc-http ingestion protocol.
+// Each published stream is a resource with its own transport, processes
+// attach to it with the resource id as session id.
+type WHIP struct {
+	config     avp.Config
+	mu         sync.RWMutex
+	transports map[string]*avp.WebRTCTransport
+}
+
+// NewWHIP creates a new whip endpoint
+func NewWHIP(config avp.Config) *WHIP {
+	return &WHIP{
+		config:     config,
+		transports: make(map[string]*avp.WebRTCTransport),
+	}
+}
+
+// GetTransport returns the transport of a whip resource
+func (w *WHIP) GetTransport(id string) (*avp.WebRTCTransport, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	t := w.transports[id]
+	if t == nil {
+		return nil, errResourceNotFound
+	}
+	return t, nil
+}
+
+// ServeHTTP handles publish requests posted to the endpoint and
+// delete requests on the resource urls.
+func (w *WHIP) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		w.publish(rw, r)
+	case http.MethodDelete:
+		w.delete(rw, r)
+	default:
+		rw.Header().Set("Allow", "POST, DELETE")
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (w *WHIP) publish(rw http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), whipContentType) {
+		http.Error(rw, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, maxOfferSize))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := newResourceID()
+	if err != nil {
+		log.Errorf("error creating whip resource id: %s", err)
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	log.Infof("Publishing whip resource: %s", id)
+
+	t := avp.NewWebRTCTransport(id, w.config)
+	if t == nil {
+		http.Error(rw, errTransportInitFailed.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	answer, err := t.AnswerGathered(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer,
+		SDP:  string(body),
+	})
+	if err != nil {
+		log.Errorf("whip negotiate error: %s", err)
+		t.Close()
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t.OnClose(func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.transports, id)
+	})
+
+	w.mu.Lock()
+	w.transports[id] = t
+	w.mu.Unlock()
+
+	rw.Header().Set("Content-Type", whipContentType)
+	rw.Header().Set("Location", path.Join(r.URL.Path, id))
+	rw.WriteHeader(http.StatusCreated)
+	if _, err := rw.Write([]byte(answer.SDP)); err != nil {
+		log.Errorf("error writing whip answer: %s", err)
+	}
+}
+
+func (w *WHIP) delete(rw http.ResponseWriter, r *http.Request) {
+	id := path.Base(r.URL.Path)
+
+	t, err := w.GetTransport(id)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	log.Infof("Deleting whip resource: %s", id)
+	if err := t.Close(); err != nil {
+		log.Errorf("error closing whip resource: %s", err)
+	}
+	rw.WriteHeader(http.StatusOK)
+}
+
+func newResourceID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+// whipOffer returns the gathered offer of a peer publishing a video track
+func whipOffer(t *testing.T, pc *webrtc.PeerConnection) string {
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "stream")
+	assert.NoError(t, err)
+	_, err = pc.AddTrack(track)
+	assert.NoError(t, err)
+
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	assert.NoError(t, pc.SetLocalDescription(offer))
+	<-gatherComplete
+	return pc.LocalDescription().SDP
+}
+
+func whipRequest(t *testing.T, method, url, contentType, body string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NoError(t, err)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	return res
+}
+
+func TestWHIP_Publish(t *testing.T) {
+	whip := NewWHIP(avp.Config{})
+	server := httptest.NewServer(whip)
+	defer server.Close()
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	defer pc.Close()
+
+	res := whipRequest(t, http.MethodPost, server.URL+"/whip", whipContentType, whipOffer(t, pc))
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, whipContentType, res.Header.Get("Content-Type"))
+
+	answer, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.NoError(t, pc.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeAnswer,
+		SDP:  string(answer),
+	}))
+
+	// processes attach with the resource id of the location
+	location := res.Header.Get("Location")
+	assert.Equal(t, "/whip", path.Dir(location))
+	transport, err := whip.GetTransport(path.Base(location))
+	assert.NoError(t, err)
+	assert.NotNil(t, transport)
+
+	// the resource is torn down on delete
+	res = whipRequest(t, http.MethodDelete, server.URL+location, "", "")
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	_, err = whip.GetTransport(path.Base(location))
+	assert.Equal(t, errResourceNotFound, err)
+
+	res = whipRequest(t, http.MethodDelete, server.URL+location, "", "")
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestWHIP_BadRequests(t *testing.T) {
+	whip := NewWHIP(avp.Config{})
+	server := httptest.NewServer(whip)
+	defer server.Close()
+
+	res := whipRequest(t, http.MethodPost, server.URL+"/whip", "text/plain", "v=0")
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+
+	res = whipRequest(t, http.MethodPost, server.URL+"/whip", whipContentType, "not an offer")
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = whipRequest(t, http.MethodGet, server.URL+"/whip", "", "")
+	res.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+	assert.Equal(t, "POST, DELETE", res.Header.Get("Allow"))
+
+	whip.mu.RLock()
+	assert.Empty(t, whip.transports)
+	whip.mu.RUnlock()
+}
@@ -0,0 +1,57 @@
+// +build libvpx
+
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/pion/ion-avp/pkg/elements"
+	log "github.com/pion/ion-log"
+)
+
+// snapshotconf is the process config of the snapshot element
+type snapshotconf struct {
+	Format    string  `json:"format"`
+	Interval  float64 `json:"interval"`
+	Keyframes bool    `json:"keyframes"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+}
+
+func init() {
+	processes["snapshot"] = createSnapshot
+}
+
+// createSnapshot keeps the latest thumbnail of the vp8 tracks of a
+// process in dir/sid/pid
+func createSnapshot(sid, pid, tid string, config []byte) avp.Element {
+	c := snapshotconf{}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &c); err != nil {
+			log.Warnf("invalid snapshot config: %s", err)
+		}
+	}
+	format := elements.TypeJPEG
+	if c.Format == "png" {
+		format = elements.TypePNG
+	}
+	s, err := elements.NewSnapshot(elements.SnapshotConfig{
+		Format:    format,
+		Interval:  time.Duration(c.Interval * float64(time.Second)),
+		Keyframes: c.Keyframes,
+		MaxWidth:  c.Width,
+		MaxHeight: c.Height,
+		Dir:       filepath.Join(dir, pathName(sid), pathName(pid)),
+		Template:  "{{.TID}}{{.Ext}}",
+		SID:       sid,
+		PID:       pid,
+	}, elements.NewDecoder(0, elements.TypeYCbCr))
+	if err != nil {
+		log.Errorf("error creating snapshot: %s", err)
+		return nil
+	}
+	return s
+}
@@ -3,10 +3,8 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"os"
-	"strings"
 
 	pb "github.com/pion/ion-avp/cmd/signal/grpc/proto"
 	log "github.com/pion/ion-log"
@@ -40,22 +38,20 @@ func main() {
 		return
 	}
 
-	buf := bufio.NewReader(os.Stdin)
-	log.Infof("track id: ")
-	id, err := buf.ReadString('\n')
-	if err != nil {
-		log.Errorf("error reading ssrc: %s", err)
-		return
+	// Record every track of the session by default, a track id
+	// or a selector like kind=audio can be passed instead.
+	tid := "*"
+	if len(os.Args) > 2 {
+		tid = os.Args[2]
 	}
-	id = strings.TrimSpace(id)
 
 	err = client.Send(&pb.SignalRequest{
 		Payload: &pb.SignalRequest_Process{
 			Process: &pb.Process{
 				Sfu: sfu,
-				Pid: id,
+				Pid: "webm",
 				Sid: sid,
-				Tid: id,
+				Tid: tid,
 				Eid: "webmsaver",
 			},
 		},
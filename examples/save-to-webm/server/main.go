@@ -6,6 +6,8 @@ import (
 	"net"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	pb "github.com/pion/ion-avp/cmd/signal/grpc/proto"
 	"github.com/pion/ion-avp/cmd/signal/grpc/server"
@@ -18,6 +20,8 @@ import (
 
 type webmsaver struct {
 	Path string `mapstructure:"path"`
+	// split recordings into segments of about this many seconds
+	Segment uint32 `mapstructure:"segment"`
 }
 
 // Config for server
@@ -32,9 +36,35 @@ var (
 	addr string
 )
 
+// pathName returns an id usable as a single path element. Braces are
+// replaced too, the name of the segments is a template.
+func pathName(id string) string {
+	id = strings.NewReplacer("/", "_", "\\", "_", "{", "_", "}", "_").Replace(id)
+	if id == "" || id == "." || id == ".." {
+		return "_" + id
+	}
+	return id
+}
+
 func createWebmSaver(sid, pid, tid string, config []byte) avp.Element {
+	name := fmt.Sprintf("%s-%s-%s", pathName(sid), pathName(pid), pathName(tid))
+
+	if conf.Webmsaver.Segment != 0 {
+		segments := elements.NewSegmentWriter(elements.SegmentWriterConfig{
+			MaxDuration: time.Duration(conf.Webmsaver.Segment) * time.Second,
+			Template:    path.Join(conf.Webmsaver.Path, name+"-{{.Index}}.webm"),
+			BufSize:     4096,
+		}, func() avp.Element {
+			return elements.NewWebmSaver()
+		})
+		segments.OnSegment(func(s elements.Segment) {
+			log.Infof("recorded segment %s: %s, %d bytes", s.Path, s.Duration, s.Size)
+		})
+		return segments
+	}
+
 	filewriter := elements.NewFileWriter(
-		path.Join(conf.Webmsaver.Path, fmt.Sprintf("%s-%s.webm", sid, pid)),
+		path.Join(conf.Webmsaver.Path, name+".webm"),
 		4096,
 	)
 	webm := elements.NewWebmSaver()
@@ -5,10 +5,13 @@ go 1.15
 require (
 	github.com/at-wat/ebml-go v0.16.0
 	github.com/lucsky/cuid v1.0.2
+	github.com/pion/ice/v2 v2.1.7
+	github.com/pion/interceptor v0.0.12
 	github.com/pion/ion-log v1.2.0
 	github.com/pion/ion-sfu v1.9.9
 	github.com/pion/rtcp v1.2.6
 	github.com/pion/rtp v1.6.5
+	github.com/pion/sdp/v3 v3.0.4
 	github.com/pion/transport v0.12.3
 	github.com/pion/webrtc/v3 v3.0.29
 	github.com/spf13/viper v1.7.1
@@ -0,0 +1,148 @@
+package avp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+const firstDynamicPayloadType = 96
+
+// newAPI creates a webrtc api with the configured codecs, header extensions
+// and interceptors. A media engine can't be shared between peer connections,
+// so a new api is created for each of them.
+func (c WebRTCTransportConfig) newAPI() (*webrtc.API, error) {
+	me := &webrtc.MediaEngine{}
+	if err := registerCodecs(me, c.codecs); err != nil {
+		return nil, err
+	}
+
+	for _, ext := range c.headerExtensions {
+		for _, typ := range codecTypes(ext.Kind) {
+			if err := me.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: ext.URI}, typ); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ir := &interceptor.Registry{}
+	if err := registerInterceptors(me, ir, c.interceptors); err != nil {
+		return nil, err
+	}
+
+	return webrtc.NewAPI(
+		webrtc.WithMediaEngine(me),
+		webrtc.WithSettingEngine(c.setting),
+		webrtc.WithInterceptorRegistry(ir),
+	), nil
+}
+
+// registerCodecs registers the configured codecs, or the pion default
+// codecs when none are configured. Codecs samples can't be built of are
+// rejected.
+func registerCodecs(me *webrtc.MediaEngine, codecs []codecconf) error {
+	if len(codecs) == 0 {
+		return me.RegisterDefaultCodecs()
+	}
+
+	used := make(map[uint8]bool)
+	for _, c := range codecs {
+		if c.PayloadType != nil {
+			used[*c.PayloadType] = true
+		}
+	}
+	next := uint8(firstDynamicPayloadType)
+
+	for _, c := range codecs {
+		var typ webrtc.RTPCodecType
+		switch {
+		case strings.HasPrefix(strings.ToLower(c.MimeType), "audio/"):
+			typ = webrtc.RTPCodecTypeAudio
+		case strings.HasPrefix(strings.ToLower(c.MimeType), "video/"):
+			typ = webrtc.RTPCodecTypeVideo
+		default:
+			return fmt.Errorf("invalid codec mime type: %s", c.MimeType)
+		}
+		if !isSupportedCodec(c.MimeType) {
+			return fmt.Errorf("%w: %s", ErrCodecNotSupported, c.MimeType)
+		}
+
+		var pt uint8
+		if c.PayloadType != nil {
+			pt = *c.PayloadType
+		} else {
+			// assign the next free dynamic payload type
+			for used[next] {
+				next++
+			}
+			pt = next
+			used[pt] = true
+		}
+
+		var feedback []webrtc.RTCPFeedback
+		for _, fb := range c.Feedback {
+			parts := strings.SplitN(strings.TrimSpace(fb), " ", 2)
+			f := webrtc.RTCPFeedback{Type: parts[0]}
+			if len(parts) == 2 {
+				f.Parameter = parts[1]
+			}
+			feedback = append(feedback, f)
+		}
+
+		err := me.RegisterCodec(webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:     c.MimeType,
+				ClockRate:    c.ClockRate,
+				Channels:     c.Channels,
+				SDPFmtpLine:  c.FmtpLine,
+				RTCPFeedback: feedback,
+			},
+			PayloadType: webrtc.PayloadType(pt),
+		}, typ)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func registerInterceptors(me *webrtc.MediaEngine, ir *interceptor.Registry, c interceptorconf) error {
+	if c.NACK {
+		if err := webrtc.ConfigureNack(me, ir); err != nil {
+			return err
+		}
+	}
+
+	if c.RTCPReports {
+		if err := webrtc.ConfigureRTCPReports(ir); err != nil {
+			return err
+		}
+	}
+
+	if c.TWCC {
+		for _, typ := range codecTypes("") {
+			me.RegisterFeedback(webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBTransportCC}, typ)
+			if err := me.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: sdp.TransportCCURI}, typ); err != nil {
+				return err
+			}
+		}
+		ir.Add(newTWCCInterceptor())
+	}
+
+	return nil
+}
+
+// codecTypes returns the codec types for kind, both when kind is empty
+func codecTypes(kind string) []webrtc.RTPCodecType {
+	switch strings.ToLower(kind) {
+	case "audio":
+		return []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio}
+	case "video":
+		return []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo}
+	}
+	return []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo}
+}
@@ -0,0 +1,81 @@
+package avp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebRTCTransportConfig_NewAPI(t *testing.T) {
+	opus := uint8(111)
+	cfg := WebRTCTransportConfig{
+		codecs: []codecconf{
+			{MimeType: MimeTypeVP8, ClockRate: 90000, Feedback: []string{"ccm fir"}},
+			{MimeType: MimeTypeOpus, ClockRate: 48000, Channels: 2, FmtpLine: "minptime=10;useinbandfec=1", PayloadType: &opus},
+		},
+		headerExtensions: []headerextconf{
+			{URI: "urn:ietf:params:rtp-hdrext:ssrc-audio-level", Kind: "audio"},
+		},
+		interceptors: interceptorconf{NACK: true, RTCPReports: true, TWCC: true},
+	}
+
+	api, err := cfg.newAPI()
+	assert.NoError(t, err)
+
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	defer pc.Close()
+
+	_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RtpTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+	assert.NoError(t, err)
+	_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RtpTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+	assert.NoError(t, err)
+
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+
+	assert.Contains(t, offer.SDP, "a=rtpmap:96 vp8/90000")
+	assert.Contains(t, offer.SDP, "a=rtpmap:111 opus/48000/2")
+	assert.Contains(t, offer.SDP, "a=rtcp-fb:96 ccm fir")
+	assert.Contains(t, offer.SDP, "a=rtcp-fb:96 nack pli")
+	assert.Contains(t, offer.SDP, "a=rtcp-fb:96 transport-cc")
+	assert.Contains(t, offer.SDP, "ssrc-audio-level")
+	assert.Contains(t, offer.SDP, "transport-wide-cc")
+	assert.False(t, strings.Contains(offer.SDP, "H264"))
+
+	_, err = WebRTCTransportConfig{codecs: []codecconf{{MimeType: "text/plain"}}}.newAPI()
+	assert.Error(t, err)
+	// no samples are built of these codecs
+	_, err = WebRTCTransportConfig{codecs: []codecconf{{MimeType: "video/AV1", ClockRate: 90000}}}.newAPI()
+	assert.True(t, errors.Is(err, ErrCodecNotSupported))
+	_, err = WebRTCTransportConfig{codecs: []codecconf{{MimeType: MimeTypePCMU, ClockRate: 8000}}}.newAPI()
+	assert.True(t, errors.Is(err, ErrCodecNotSupported))
+}
+
+func TestRegisterCodecs_PayloadType(t *testing.T) {
+	zero := uint8(0)
+	api, err := WebRTCTransportConfig{codecs: []codecconf{
+		{MimeType: MimeTypeVP8, ClockRate: 90000},
+		{MimeType: MimeTypeOpus, ClockRate: 48000, Channels: 2, PayloadType: &zero},
+	}}.newAPI()
+	assert.NoError(t, err)
+
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	defer pc.Close()
+
+	_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RtpTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+	assert.NoError(t, err)
+	_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RtpTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly})
+	assert.NoError(t, err)
+
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+
+	// a payload type of 0 is kept, unset ones are assigned
+	assert.Contains(t, offer.SDP, "a=rtpmap:0 opus/48000/2")
+	assert.Contains(t, offer.SDP, "a=rtpmap:96 vp8/90000")
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/pion/interceptor"
 	log "github.com/pion/ion-log"
 	"github.com/pion/rtp"
 	"github.com/pion/rtp/codecs"
@@ -30,8 +31,21 @@ var (
 	ErrCodecNotSupported = errors.New("codec not supported")
 )
 
+// Track is a stream of rtp packets a builder reads samples from,
+// such as a *webrtc.TrackRemote.
+type Track interface {
+	ID() string
+	StreamID() string
+	Kind() webrtc.RTPCodecType
+	SSRC() webrtc.SSRC
+	Codec() webrtc.RTPCodecParameters
+	ReadRTP() (*rtp.Packet, interceptor.Attributes, error)
+}
+
 type BuilderOptions struct {
-	maxLateTime time.Duration
+	maxLateTime  time.Duration
+	audioLevelID uint8
+	resume       *timeline
 }
 
 // BuilderOption configures a BuilderOptions.
@@ -55,6 +69,32 @@ func WithMaxLateTime(maxLateTime time.Duration) BuilderOptionFn {
 	}
 }
 
+// WithAudioLevelExtension sets the id of the audio level header
+// extension, the levels are set on the samples.
+func WithAudioLevelExtension(id uint8) BuilderOptionFn {
+	return func(o *BuilderOptions) error {
+		o.audioLevelID = id
+		return nil
+	}
+}
+
+// withTimeline continues the samples of a detached builder of the track
+func withTimeline(t *timeline) BuilderOptionFn {
+	return func(o *BuilderOptions) error {
+		o.resume = t
+		return nil
+	}
+}
+
+// timeline is the position of the samples of a builder. A builder of a
+// track received again after a reconnect continues the timeline of the
+// detached one, its elements see a gap instead of a new stream.
+type timeline struct {
+	timestamp uint32    // of the last sample
+	sequence  uint16    // of the next sample
+	at        time.Time // the last sample was built
+}
+
 // Builder Module for building video/audio samples from rtp streams
 type Builder struct {
 	mu            sync.RWMutex
@@ -63,8 +103,15 @@ type Builder struct {
 	builder       *samplebuilder.SampleBuilder
 	elements      []Element
 	sequence      uint16
-	track         *webrtc.TrackRemote
+	track         Track
+	typ           int
 	out           chan *Sample
+	audioLevelID  uint8
+	audioLevels   map[uint32]rtp.AudioLevelExtension // by packet timestamp
+	resume        *timeline
+	started       bool
+	offset        uint32 // added to the packet timestamps
+	last          *timeline
 }
 
 // MustBuilder panics if creation of a Builder fails, such as
@@ -77,7 +124,7 @@ func MustBuilder(builder *Builder, err error) *Builder {
 }
 
 // NewBuilder Initialize a new audio sample builder
-func NewBuilder(track *webrtc.TrackRemote, maxLate uint16, opts ...BuilderOption) (*Builder, error) {
+func NewBuilder(track Track, maxLate uint16, opts ...BuilderOption) (*Builder, error) {
 
 	options := BuilderOptions{}
 
@@ -87,26 +134,19 @@ func NewBuilder(track *webrtc.TrackRemote, maxLate uint16, opts ...BuilderOption
 		}
 	}
 
-	var depacketizer rtp.Depacketizer
-	var checker rtp.PartitionHeadChecker
-	switch strings.ToLower(track.Codec().MimeType) {
-	case strings.ToLower(MimeTypeOpus):
-		depacketizer = &codecs.OpusPacket{}
-		checker = &codecs.OpusPartitionHeadChecker{}
-	case strings.ToLower(MimeTypeVP8):
-		depacketizer = &codecs.VP8Packet{}
-		checker = &codecs.VP8PartitionHeadChecker{}
-	case strings.ToLower(MimeTypeVP9):
-		depacketizer = &codecs.VP9Packet{}
-		checker = &codecs.VP9PartitionHeadChecker{}
-	case strings.ToLower(MimeTypeH264):
-		depacketizer = &codecs.H264Packet{}
+	depacketizer, checker, typ, err := newDepacketizer(track.Codec().MimeType)
+	if err != nil {
+		return nil, err
 	}
 
 	b := &Builder{
-		builder: samplebuilder.New(maxLate, depacketizer, track.Codec().ClockRate),
-		track:   track,
-		out:     make(chan *Sample, maxSize),
+		builder:      samplebuilder.New(maxLate, depacketizer, track.Codec().ClockRate),
+		track:        track,
+		typ:          typ,
+		out:          make(chan *Sample, maxSize),
+		audioLevelID: options.audioLevelID,
+		audioLevels:  make(map[uint32]rtp.AudioLevelExtension),
+		resume:       options.resume,
 	}
 
 	if checker != nil {
@@ -123,6 +163,29 @@ func NewBuilder(track *webrtc.TrackRemote, maxLate uint16, opts ...BuilderOption
 	return b, nil
 }
 
+// newDepacketizer returns the depacketizer, partition head checker and
+// sample type of a codec, ErrCodecNotSupported when samples of the codec
+// can't be built.
+func newDepacketizer(mimeType string) (rtp.Depacketizer, rtp.PartitionHeadChecker, int, error) {
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(MimeTypeOpus):
+		return &codecs.OpusPacket{}, &codecs.OpusPartitionHeadChecker{}, TypeOpus, nil
+	case strings.ToLower(MimeTypeVP8):
+		return &codecs.VP8Packet{}, &codecs.VP8PartitionHeadChecker{}, TypeVP8, nil
+	case strings.ToLower(MimeTypeVP9):
+		return &codecs.VP9Packet{}, &codecs.VP9PartitionHeadChecker{}, TypeVP9, nil
+	case strings.ToLower(MimeTypeH264):
+		return &codecs.H264Packet{}, nil, TypeH264, nil
+	}
+	return nil, nil, 0, ErrCodecNotSupported
+}
+
+// isSupportedCodec returns true when samples of the codec can be built
+func isSupportedCodec(mimeType string) bool {
+	_, _, _, err := newDepacketizer(mimeType)
+	return err == nil
+}
+
 // AttachElement attaches a element to a builder
 func (b *Builder) AttachElement(e Element) {
 	b.mu.Lock()
@@ -130,8 +193,17 @@ func (b *Builder) AttachElement(e Element) {
 	b.elements = append(b.elements, e)
 }
 
+// detach removes the elements and stop handler from the builder without
+// closing them, so the elements can be attached to a new builder.
+func (b *Builder) detach() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.elements = nil
+	b.onStopHandler = nil
+}
+
 // Track returns the builders underlying track
-func (b *Builder) Track() *webrtc.TrackRemote {
+func (b *Builder) Track() Track {
 	return b.track
 }
 
@@ -159,6 +231,13 @@ func (b *Builder) build() {
 			continue
 		}
 
+		if b.audioLevelID != 0 {
+			level := rtp.AudioLevelExtension{}
+			if err := level.Unmarshal(pkt.GetExtension(b.audioLevelID)); err == nil {
+				b.audioLevels[pkt.Timestamp] = level
+			}
+		}
+
 		b.builder.Push(pkt)
 
 		for {
@@ -176,10 +255,11 @@ func (b *Builder) build() {
 
 			b.out <- &Sample{
 				ID:                 b.track.ID(),
-				Type:               int(b.track.Kind()),
+				Type:               b.typ,
 				SequenceNumber:     b.sequence,
-				Timestamp:          sample.PacketTimestamp,
+				Timestamp:          b.rebase(sample.PacketTimestamp),
 				PrevDroppedPackets: sample.PrevDroppedPackets,
+				AudioLevel:         b.audioLevel(sample.PacketTimestamp),
 				Payload:            sample.Data,
 			}
 			b.sequence++
@@ -187,6 +267,56 @@ func (b *Builder) build() {
 	}
 }
 
+// rebase returns the timestamp of a sample on the timeline of the
+// builder. The first sample of a resumed builder follows the last one of
+// the detached builder by the time the track was gone.
+func (b *Builder) rebase(timestamp uint32) uint32 {
+	if !b.started {
+		b.started = true
+		if r := b.resume; r != nil {
+			gap := uint32(time.Since(r.at).Seconds()*float64(b.track.Codec().ClockRate)) + 1
+			b.offset = r.timestamp + gap - timestamp
+			b.sequence = r.sequence
+		}
+	}
+	timestamp += b.offset
+
+	b.mu.Lock()
+	b.last = &timeline{
+		timestamp: timestamp,
+		sequence:  b.sequence + 1,
+		at:        time.Now(),
+	}
+	b.mu.Unlock()
+	return timestamp
+}
+
+// timeline returns the position of the last sample, nil before the
+// first sample
+func (b *Builder) timeline() *timeline {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.last
+}
+
+// audioLevel returns the level of the packets of a sample, the levels
+// of the previous packets are dropped
+func (b *Builder) audioLevel(timestamp uint32) *rtp.AudioLevelExtension {
+	if len(b.audioLevels) == 0 {
+		return nil
+	}
+	level, ok := b.audioLevels[timestamp]
+	for ts := range b.audioLevels {
+		if int32(ts-timestamp) <= 0 {
+			delete(b.audioLevels, ts)
+		}
+	}
+	if !ok {
+		return nil
+	}
+	return &level
+}
+
 // Read sample
 func (b *Builder) forward() {
 	for {
@@ -214,14 +344,17 @@ func (b *Builder) stop() {
 	}
 
 	b.mu.Lock()
-	defer b.mu.Unlock()
-
 	b.stopped.set(true)
 	for _, e := range b.elements {
 		e.Close()
 	}
-	if b.onStopHandler != nil {
-		b.onStopHandler()
-	}
+	onStopHandler := b.onStopHandler
 	close(b.out)
+	b.mu.Unlock()
+
+	// the handler takes the session lock, which is held when the
+	// session detaches builders
+	if onStopHandler != nil {
+		onStopHandler()
+	}
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pion/rtp"
 	"github.com/pion/transport/test"
 	"github.com/pion/webrtc/v3"
 	"github.com/pion/webrtc/v3/pkg/media"
@@ -246,3 +247,57 @@ func TestNewBuilder_WithH264Packet(t *testing.T) {
 	assert.NoError(t, err)
 	sendRTPUntilDone(onBuilderFired.Done(), t, []*webrtc.TrackLocalStaticSample{track})
 }
+
+func TestNewBuilder_WithAudioLevelExtension(t *testing.T) {
+	track := &rtpTrack{
+		id:      "audio",
+		kind:    webrtc.RTPCodecTypeAudio,
+		codec:   webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeOpus, ClockRate: 48000}},
+		packets: make(chan *rtp.Packet, 10),
+		done:    make(chan struct{}),
+	}
+	defer close(track.done)
+
+	builder, err := NewBuilder(track, 10, WithAudioLevelExtension(1))
+	assert.NoError(t, err)
+	element := &sampleRecorder{samples: make(chan *Sample, 10)}
+	builder.AttachElement(element)
+
+	for i := 0; i < 4; i++ {
+		pkt := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				SequenceNumber: uint16(i),
+				Timestamp:      uint32(i * 960),
+			},
+			Payload: []byte{0xf8, 0x01},
+		}
+		if i != 1 {
+			assert.NoError(t, pkt.SetExtension(1, []byte{0x80 | byte(30+i)}))
+		}
+		track.packets <- pkt
+	}
+
+	// the last sample is popped with the next packet
+	for i, level := range []*rtp.AudioLevelExtension{{Level: 30, Voice: true}, nil, {Level: 32, Voice: true}} {
+		select {
+		case sample := <-element.samples:
+			assert.Equal(t, uint32(i*960), sample.Timestamp)
+			assert.Equal(t, level, sample.AudioLevel)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no sample")
+		}
+	}
+}
+
+func TestNewBuilder_Unsupported(t *testing.T) {
+	for _, mimeType := range []string{MimeTypePCMU, MimeTypePCMA, MimeTypeG722, "video/AV1"} {
+		track := &rtpTrack{
+			id:    "track",
+			codec: webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeType, ClockRate: 8000}},
+		}
+		builder, err := NewBuilder(track, 10)
+		assert.Nil(t, builder)
+		assert.Equal(t, ErrCodecNotSupported, err, mimeType)
+	}
+}
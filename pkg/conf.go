@@ -12,10 +12,78 @@ type iceconf struct {
 	Credential string   `mapstructure:"credential"`
 }
 
+type reconnectconf struct {
+	ICERestarts int    `mapstructure:"icerestarts"`
+	Attempts    int    `mapstructure:"attempts"`
+	IntervalMs  uint32 `mapstructure:"intervalms"`
+}
+
+type codecconf struct {
+	MimeType    string   `mapstructure:"mime"`
+	ClockRate   uint32   `mapstructure:"clockrate"`
+	Channels    uint16   `mapstructure:"channels"`
+	FmtpLine    string   `mapstructure:"fmtp"`
+	PayloadType *uint8   `mapstructure:"payloadtype"` // nil assigns a dynamic payload type
+	Feedback    []string `mapstructure:"feedback"`
+}
+
+type headerextconf struct {
+	URI  string `mapstructure:"uri"`
+	Kind string `mapstructure:"kind"`
+}
+
+type interceptorconf struct {
+	NACK        bool `mapstructure:"nack"`
+	RTCPReports bool `mapstructure:"rtcpreports"`
+	TWCC        bool `mapstructure:"twcc"`
+}
+
+type candidateconf struct {
+	NAT1To1IPs   []string `mapstructure:"nat1to1"`
+	NAT1To1Type  string   `mapstructure:"nat1to1type"`
+	NetworkTypes []string `mapstructure:"networktypes"`
+	Interfaces   []string `mapstructure:"interfaces"`
+	TCPPort      int      `mapstructure:"tcpport"`
+	MDNS         string   `mapstructure:"mdns"`
+}
+
+type timeoutconf struct {
+	ICEDisconnectedTimeout int `mapstructure:"disconnected"`
+	ICEFailedTimeout       int `mapstructure:"failed"`
+	ICEKeepaliveInterval   int `mapstructure:"keepalive"`
+}
+
 type webrtcconf struct {
-	PLICycle     uint      `mapstructure:"plicycle"`
-	ICEPortRange []uint16  `mapstructure:"portrange"`
-	ICEServers   []iceconf `mapstructure:"iceserver"`
+	PLICycle         uint            `mapstructure:"plicycle"`
+	ICEPortRange     []uint16        `mapstructure:"portrange"`
+	ICESinglePort    int             `mapstructure:"singleport"`
+	ICEServers       []iceconf       `mapstructure:"iceserver"`
+	Candidates       candidateconf   `mapstructure:"candidates"`
+	Timeouts         timeoutconf     `mapstructure:"timeouts"`
+	Reconnect        reconnectconf   `mapstructure:"reconnect"`
+	Codecs           []codecconf     `mapstructure:"codec"`
+	HeaderExtensions []headerextconf `mapstructure:"headerextension"`
+	Interceptors     interceptorconf `mapstructure:"interceptors"`
+}
+
+type processconf struct {
+	PendingTTLMs uint32 `mapstructure:"pendingttlms"`
+}
+
+type rtpstreamconf struct {
+	ID          string `mapstructure:"id"`
+	Addr        string `mapstructure:"addr"`
+	MimeType    string `mapstructure:"mime"`
+	ClockRate   uint32 `mapstructure:"clockrate"`
+	Channels    uint16 `mapstructure:"channels"`
+	FmtpLine    string `mapstructure:"fmtp"`
+	PayloadType uint8  `mapstructure:"payloadtype"`
+}
+
+type rtpconf struct {
+	ID      string          `mapstructure:"id"`
+	SDP     string          `mapstructure:"sdp"`
+	Streams []rtpstreamconf `mapstructure:"stream"`
 }
 
 // Config defines parameters for the logger
@@ -28,4 +96,6 @@ type Config struct {
 	Log           logConf           `mapstructure:"log"`
 	SampleBuilder Samplebuilderconf `mapstructure:"samplebuilder"`
 	WebRTC        webrtcconf        `mapstructure:"webrtc"`
+	Process       processconf       `mapstructure:"process"`
+	RTP           []rtpconf         `mapstructure:"rtp"`
 }
@@ -6,3 +6,41 @@ type Element interface {
 	Attach(Element)
 	Close()
 }
+
+// Publishable is implemented by elements that send media back into
+// the session. The transport binds them to its Publisher when the
+// process is created.
+type Publishable interface {
+	Element
+	Publish(*Publisher) error
+}
+
+// Parent is implemented by elements that write to attached elements
+type Parent interface {
+	Element
+	Children() []Element
+}
+
+// Publishables returns the publishable elements of a process, walking
+// the elements attached to it depth first.
+func Publishables(e Element) []Publishable {
+	var pubs []Publishable
+	seen := make(map[Element]bool)
+	var walk func(Element)
+	walk = func(e Element) {
+		if e == nil || seen[e] {
+			return
+		}
+		seen[e] = true
+		if p, ok := e.(Publishable); ok {
+			pubs = append(pubs, p)
+		}
+		if p, ok := e.(Parent); ok {
+			for _, child := range p.Children() {
+				walk(child)
+			}
+		}
+	}
+	walk(e)
+	return pubs
+}
@@ -0,0 +1,264 @@
+package elements
+
+import "fmt"
+
+// av1 obu types
+const (
+	av1OBUSequenceHeader    = 1
+	av1OBUTemporalDelimiter = 2
+)
+
+// av1SequenceHeader holds the fields of a sequence header the muxers need
+type av1SequenceHeader struct {
+	profile              uint8
+	level                uint8
+	tier                 uint8
+	highBitDepth         bool
+	twelveBit            bool
+	monochrome           bool
+	subsamplingX         bool
+	subsamplingY         bool
+	chromaSamplePosition uint8
+	width                int
+	height               int
+}
+
+// av1OBU is an obu of a temporal unit
+type av1OBU struct {
+	typ  uint8
+	data []byte // complete obu, header included
+	body []byte
+}
+
+// readLEB128 returns a leb128 value and its length
+func readLEB128(data []byte) (uint64, int, bool) {
+	var v uint64
+	for i := 0; i < 8 && i < len(data); i++ {
+		v |= uint64(data[i]&0x7f) << (7 * uint(i))
+		if data[i]&0x80 == 0 {
+			return v, i + 1, true
+		}
+	}
+	return 0, 0, false
+}
+
+// splitAV1OBUs returns the obus of a temporal unit in the low overhead
+// bitstream format. The last obu may omit its size.
+func splitAV1OBUs(payload []byte) ([]av1OBU, bool) {
+	var obus []av1OBU
+	for len(payload) > 0 {
+		header := payload[0]
+		typ := header >> 3 & 0xf
+		headerLen := 1
+		if header&0x4 != 0 {
+			headerLen++ // extension header
+		}
+		if len(payload) < headerLen {
+			return nil, false
+		}
+
+		size := uint64(len(payload) - headerLen)
+		if header&0x2 != 0 {
+			var n int
+			var ok bool
+			if size, n, ok = readLEB128(payload[headerLen:]); !ok {
+				return nil, false
+			}
+			headerLen += n
+		}
+		if uint64(len(payload)-headerLen) < size {
+			return nil, false
+		}
+
+		end := headerLen + int(size)
+		obus = append(obus, av1OBU{
+			typ:  typ,
+			data: payload[:end],
+			body: payload[headerLen:end],
+		})
+		payload = payload[end:]
+	}
+	return obus, true
+}
+
+// av1SequenceHeaderOBU returns the sequence header obu of a temporal unit
+func av1SequenceHeaderOBU(obus []av1OBU) (av1OBU, bool) {
+	for _, obu := range obus {
+		if obu.typ == av1OBUSequenceHeader {
+			return obu, true
+		}
+	}
+	return av1OBU{}, false
+}
+
+// parseAV1SequenceHeader parses the dimensions and format of a sequence
+// header obu
+func parseAV1SequenceHeader(body []byte) (av1SequenceHeader, bool) {
+	r := &bitReader{data: body}
+	var h av1SequenceHeader
+
+	profile, _ := r.read(3)
+	h.profile = uint8(profile)
+	r.read(1) // still_picture
+	reduced, _ := r.read(1)
+
+	if reduced == 1 {
+		level, _ := r.read(5)
+		h.level = uint8(level)
+	} else {
+		var decoderModelInfo uint32
+		var bufferDelayLength int
+		if timingInfo, _ := r.read(1); timingInfo == 1 {
+			r.read(32) // num_units_in_display_tick
+			r.read(32) // time_scale
+			if equalPictureInterval, _ := r.read(1); equalPictureInterval == 1 {
+				r.readUVLC()
+			}
+			decoderModelInfo, _ = r.read(1)
+			if decoderModelInfo == 1 {
+				length, _ := r.read(5)
+				bufferDelayLength = int(length) + 1
+				r.read(32) // num_units_in_decoding_tick
+				r.read(10) // buffer_removal_time_length_minus_1, frame_presentation_time_length_minus_1
+			}
+		}
+		initialDisplayDelay, _ := r.read(1)
+		points, _ := r.read(5)
+		for i := uint32(0); i <= points; i++ {
+			r.read(12) // operating_point_idc
+			level, _ := r.read(5)
+			var tier uint32
+			if level > 7 {
+				tier, _ = r.read(1)
+			}
+			if i == 0 {
+				h.level, h.tier = uint8(level), uint8(tier)
+			}
+			if decoderModelInfo == 1 {
+				if present, _ := r.read(1); present == 1 {
+					r.read(bufferDelayLength) // decoder_buffer_delay
+					r.read(bufferDelayLength) // encoder_buffer_delay
+					r.read(1)                 // low_delay_mode_flag
+				}
+			}
+			if initialDisplayDelay == 1 {
+				if present, _ := r.read(1); present == 1 {
+					r.read(4)
+				}
+			}
+		}
+	}
+
+	widthBits, _ := r.read(4)
+	heightBits, _ := r.read(4)
+	width, _ := r.read(int(widthBits) + 1)
+	height, _ := r.read(int(heightBits) + 1)
+	h.width, h.height = int(width)+1, int(height)+1
+
+	if reduced == 0 {
+		if frameIDs, _ := r.read(1); frameIDs == 1 {
+			r.read(7) // delta_frame_id_length_minus_2, additional_frame_id_length_minus_1
+		}
+	}
+	r.read(3) // use_128x128_superblock, enable_filter_intra, enable_intra_edge_filter
+	if reduced == 0 {
+		r.read(4) // enable_interintra_compound, enable_masked_compound, enable_warped_motion, enable_dual_filter
+		orderHint, _ := r.read(1)
+		if orderHint == 1 {
+			r.read(2) // enable_jnt_comp, enable_ref_frame_mvs
+		}
+		forceScreenContentTools := uint32(2)
+		if choose, _ := r.read(1); choose == 0 {
+			forceScreenContentTools, _ = r.read(1)
+		}
+		if forceScreenContentTools > 0 {
+			if choose, _ := r.read(1); choose == 0 {
+				r.read(1) // seq_force_integer_mv
+			}
+		}
+		if orderHint == 1 {
+			r.read(3) // order_hint_bits_minus_1
+		}
+	}
+	r.read(3) // enable_superres, enable_cdef, enable_restoration
+
+	// color config
+	highBitDepth, _ := r.read(1)
+	h.highBitDepth = highBitDepth == 1
+	if h.profile == 2 && h.highBitDepth {
+		twelveBit, _ := r.read(1)
+		h.twelveBit = twelveBit == 1
+	}
+	if h.profile != 1 {
+		monochrome, _ := r.read(1)
+		h.monochrome = monochrome == 1
+	}
+	primaries, transfer, matrix := uint32(2), uint32(2), uint32(2)
+	if description, _ := r.read(1); description == 1 {
+		primaries, _ = r.read(8)
+		transfer, _ = r.read(8)
+		matrix, _ = r.read(8)
+	}
+	switch {
+	case h.monochrome:
+		r.read(1) // color_range
+		h.subsamplingX, h.subsamplingY = true, true
+	case primaries == 1 && transfer == 13 && matrix == 0:
+		// srgb
+	default:
+		r.read(1) // color_range
+		switch {
+		case h.profile == 0:
+			h.subsamplingX, h.subsamplingY = true, true
+		case h.profile == 1:
+		case h.twelveBit:
+			x, _ := r.read(1)
+			h.subsamplingX = x == 1
+			if h.subsamplingX {
+				y, _ := r.read(1)
+				h.subsamplingY = y == 1
+			}
+		default:
+			h.subsamplingX = true
+		}
+		if h.subsamplingX && h.subsamplingY {
+			position, _ := r.read(2)
+			h.chromaSamplePosition = uint8(position)
+		}
+	}
+
+	return h, !r.overrun
+}
+
+func (r *bitReader) readUVLC() uint32 {
+	zeros := 0
+	for {
+		bit, ok := r.read(1)
+		if !ok || bit == 1 {
+			break
+		}
+		zeros++
+	}
+	if zeros >= 32 {
+		return 0xffffffff
+	}
+	v, _ := r.read(zeros)
+	return v + (1 << uint(zeros)) - 1
+}
+
+// av1Codec returns the rfc 6381 codec of a sequence header,
+// av01.<profile>.<level><tier>.<bit depth>
+func av1Codec(h av1SequenceHeader) string {
+	tier := "M"
+	if h.tier == 1 {
+		tier = "H"
+	}
+	bitDepth := 8
+	switch {
+	case h.twelveBit:
+		bitDepth = 12
+	case h.highBitDepth:
+		bitDepth = 10
+	}
+	return fmt.Sprintf("av01.%d.%02d%s.%02d", h.profile, h.level, tier, bitDepth)
+}
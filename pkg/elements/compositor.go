@@ -0,0 +1,438 @@
+package elements
+
+import (
+	"image"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+)
+
+// CompositorLayout is the arrangement of the tracks of a Compositor
+type CompositorLayout int
+
+// Layouts of a Compositor
+const (
+	// LayoutGrid tiles the tracks in a grid of equal cells
+	LayoutGrid CompositorLayout = iota
+	// LayoutActiveSpeaker shows the active speaker above a row of the
+	// other tracks
+	LayoutActiveSpeaker
+	// LayoutPictureInPicture shows the active speaker on the canvas and
+	// the other tracks in small tiles over its bottom right corner
+	LayoutPictureInPicture
+)
+
+const (
+	defaultCompositorID      = "composite"
+	defaultCompositorWidth   = 1280
+	defaultCompositorHeight  = 720
+	defaultCompositorFPS     = 30
+	defaultCompositorTimeout = 2 * time.Second
+
+	// tracks without frames for this long are removed
+	compositorTrackTimeout = 30 * time.Second
+	// margin of the picture in picture tiles
+	compositorMargin = 16
+)
+
+// colors of the background and of the placeholder in ycbcr
+var (
+	compositorBackground  = [3]uint8{16, 128, 128}
+	compositorPlaceholder = [3]uint8{64, 128, 128}
+)
+
+// CompositorConfig configures a Compositor
+type CompositorConfig struct {
+	// ID of the composited samples. Defaults to composite.
+	ID string
+	// Width and Height of the canvas. Default to 1280x720.
+	Width  int
+	Height int
+	// FPS of the composited samples. Defaults to 30.
+	FPS int
+	// Layout of the tracks. Defaults to LayoutGrid.
+	Layout CompositorLayout
+	// Timeout after which the last frame of a track is replaced by the
+	// placeholder. Defaults to 2s.
+	Timeout time.Duration
+	// Placeholder drawn for the tracks without recent frames. Defaults
+	// to a gray tile.
+	Placeholder *image.YCbCr
+	// Speakers maps the audio track ids of the VADEvent samples to the
+	// video track ids of their tiles, e.g. the tracks of a stream.
+	Speakers map[string]string
+}
+
+type compositorTrack struct {
+	frame   *image.YCbCr
+	updated time.Time
+	order   int
+}
+
+// Compositor instance
+type Compositor struct {
+	Node
+	mu       sync.Mutex
+	config   CompositorConfig
+	tracks   map[string]*compositorTrack
+	order    int
+	active   string
+	speakers map[string]string // video track ids by audio track id
+	frames   int64
+	running  bool
+	closed   bool
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewCompositor instance. Compositor draws the last TypeYCbCr frame of
+// each track on a canvas, e.g. decoded by a Decoder, and writes the
+// canvas as TypeYCbCr samples at a fixed frame rate. Frames are scaled
+// to fit their tile. The active speaker of the layouts is set with
+// SetActiveSpeaker or by the VADEvent samples of a VAD, and defaults to
+// the first track. The audio tracks of the VAD are mapped to the video
+// tracks with the Speakers config or SetSpeakerTrack.
+func NewCompositor(config CompositorConfig) *Compositor {
+	if config.ID == "" {
+		config.ID = defaultCompositorID
+	}
+	if config.Width == 0 {
+		config.Width = defaultCompositorWidth
+	}
+	if config.Height == 0 {
+		config.Height = defaultCompositorHeight
+	}
+	if config.FPS == 0 {
+		config.FPS = defaultCompositorFPS
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultCompositorTimeout
+	}
+	// the chroma planes are subsampled
+	config.Width &^= 1
+	config.Height &^= 1
+	speakers := make(map[string]string)
+	for audio, video := range config.Speakers {
+		speakers[audio] = video
+	}
+	return &Compositor{
+		config:   config,
+		tracks:   make(map[string]*compositorTrack),
+		speakers: speakers,
+		done:     make(chan struct{}),
+	}
+}
+
+func (c *Compositor) Write(sample *avp.Sample) error {
+	switch sample.Type {
+	case TypeYCbCr:
+		img, ok := sample.Payload.(*image.YCbCr)
+		if !ok {
+			return ErrUnsupportedPayload
+		}
+		if img.Rect.Empty() {
+			return nil
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.closed {
+			return nil
+		}
+		t := c.track(sample.ID)
+		// the frame is drawn after the writer may have reused its buffer
+		t.frame = copyYCbCr(t.frame, img)
+		t.updated = time.Now()
+
+		if !c.running {
+			c.running = true
+			c.wg.Add(1)
+			go c.run()
+		}
+
+	case TypeMetadata:
+		if event, ok := sample.Payload.(VADEvent); ok && event.Speaking {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			id := sample.ID
+			if video, ok := c.speakers[id]; ok {
+				id = video
+			}
+			// audio tracks without a tile are ignored
+			if c.tracks[id] != nil {
+				c.active = id
+			}
+		}
+	}
+	return nil
+}
+
+// track returns the track id, created when it doesn't exist. Must be
+// called with the lock held.
+func (c *Compositor) track(id string) *compositorTrack {
+	t := c.tracks[id]
+	if t == nil {
+		t = &compositorTrack{order: c.order}
+		c.order++
+		c.tracks[id] = t
+		if c.active == "" {
+			c.active = id
+		}
+	}
+	return t
+}
+
+// SetLayout changes the layout of the tracks
+func (c *Compositor) SetLayout(layout CompositorLayout) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config.Layout = layout
+}
+
+// SetActiveSpeaker sets the track shown in the main tile of the layouts
+func (c *Compositor) SetActiveSpeaker(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active = id
+}
+
+// SetSpeakerTrack maps the audio track of the VADEvent samples to the
+// video track of its tile
+func (c *Compositor) SetSpeakerTrack(audio, video string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.speakers[audio] = video
+}
+
+// RemoveTrack removes the tile of the track id
+func (c *Compositor) RemoveTrack(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tracks, id)
+}
+
+// ids returns the ids of the tracks in their order, the active speaker
+// first in the layouts with a main tile. Idle tracks are removed.
+func (c *Compositor) ids() []string {
+	var ids []string
+	for id, t := range c.tracks {
+		if time.Since(t.updated) > compositorTrackTimeout {
+			delete(c.tracks, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return c.tracks[ids[i]].order < c.tracks[ids[j]].order
+	})
+	if c.config.Layout == LayoutGrid {
+		return ids
+	}
+	for i, id := range ids {
+		if id == c.active {
+			copy(ids[1:i+1], ids[:i])
+			ids[0] = id
+			break
+		}
+	}
+	return ids
+}
+
+// tiles returns the rectangles of n tiles of the layout
+func (c *Compositor) tiles(n int) []image.Rectangle {
+	w, h := c.config.Width, c.config.Height
+	if n == 0 {
+		return nil
+	}
+	if n == 1 {
+		return []image.Rectangle{image.Rect(0, 0, w, h)}
+	}
+
+	var tiles []image.Rectangle
+	switch c.config.Layout {
+	case LayoutActiveSpeaker:
+		main := h * 3 / 4
+		tiles = append(tiles, image.Rect(0, 0, w, main))
+		// the others in a row below, at most as wide as the canvas ratio
+		tw, th := w/(n-1), h-main
+		if tw > th*w/h {
+			tw = th * w / h
+		}
+		x := (w - tw*(n-1)) / 2
+		for i := 1; i < n; i++ {
+			tiles = append(tiles, image.Rect(x, main, x+tw, h))
+			x += tw
+		}
+
+	case LayoutPictureInPicture:
+		tiles = append(tiles, image.Rect(0, 0, w, h))
+		tw, th := w/4, h/4
+		x := w - compositorMargin - tw
+		for i := 1; i < n; i++ {
+			tiles = append(tiles, image.Rect(x, h-compositorMargin-th, x+tw, h-compositorMargin))
+			x -= tw + compositorMargin
+		}
+
+	default:
+		cols := int(math.Ceil(math.Sqrt(float64(n))))
+		rows := (n + cols - 1) / cols
+		tw, th := w/cols, h/rows
+		for i := 0; i < n; i++ {
+			row, col := i/cols, i%cols
+			x := col * tw
+			// the last row is centered
+			if row == rows-1 {
+				x += (cols*rows - n) * tw / 2
+			}
+			tiles = append(tiles, image.Rect(x, row*th, x+tw, (row+1)*th))
+		}
+	}
+	return tiles
+}
+
+// compose returns the next frame of the canvas
+func (c *Compositor) compose() *avp.Sample {
+	canvas := image.NewYCbCr(image.Rect(0, 0, c.config.Width, c.config.Height), image.YCbCrSubsampleRatio420)
+	fillYCbCr(canvas, canvas.Rect, compositorBackground)
+
+	ids := c.ids()
+	tiles := c.tiles(len(ids))
+	for i, id := range ids {
+		t, tile := c.tracks[id], tiles[i]
+		switch {
+		case time.Since(t.updated) <= c.config.Timeout:
+			drawYCbCr(canvas, tile, t.frame)
+		case c.config.Placeholder != nil:
+			drawYCbCr(canvas, tile, c.config.Placeholder)
+		default:
+			fillYCbCr(canvas, tile, compositorPlaceholder)
+		}
+	}
+
+	sample := &avp.Sample{
+		ID:        c.config.ID,
+		Type:      TypeYCbCr,
+		Timestamp: uint32(c.frames * videoClockRate / int64(c.config.FPS)),
+		Payload:   canvas,
+	}
+	c.frames++
+	return sample
+}
+
+func (c *Compositor) run() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(time.Second / time.Duration(c.config.FPS))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			sample := c.compose()
+			c.mu.Unlock()
+
+			if err := c.Node.Write(sample); err != nil {
+				log.Errorf("Compositor error writing sample: %s", err)
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close stops the composition
+func (c *Compositor) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	close(c.done)
+	c.mu.Unlock()
+
+	c.wg.Wait()
+	c.Node.Close()
+}
+
+// copyYCbCr copies src to dst, dst is allocated when it is nil or has
+// another size
+func copyYCbCr(dst, src *image.YCbCr) *image.YCbCr {
+	if dst == nil || dst.Rect.Size() != src.Rect.Size() || dst.SubsampleRatio != src.SubsampleRatio {
+		dst = image.NewYCbCr(image.Rectangle{Max: src.Rect.Size()}, src.SubsampleRatio)
+	}
+	for y := 0; y < src.Rect.Dy(); y++ {
+		i := src.YOffset(src.Rect.Min.X, src.Rect.Min.Y+y)
+		copy(dst.Y[y*dst.YStride:], src.Y[i:i+src.Rect.Dx()])
+	}
+	// the chroma planes of dst have the size of the chroma of src
+	for y := 0; y < len(dst.Cb)/dst.CStride; y++ {
+		i := src.COffset(src.Rect.Min.X, src.Rect.Min.Y) + y*src.CStride
+		copy(dst.Cb[y*dst.CStride:], src.Cb[i:i+dst.CStride])
+		copy(dst.Cr[y*dst.CStride:], src.Cr[i:i+dst.CStride])
+	}
+	return dst
+}
+
+// fillYCbCr fills a rectangle of a 4:2:0 image with a color
+func fillYCbCr(dst *image.YCbCr, r image.Rectangle, color [3]uint8) {
+	r = r.Intersect(dst.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := dst.YOffset(r.Min.X, y)
+		for x := 0; x < r.Dx(); x++ {
+			dst.Y[i+x] = color[0]
+		}
+	}
+	for y := r.Min.Y; y < r.Max.Y; y += 2 {
+		for x := r.Min.X; x < r.Max.X; x += 2 {
+			i := dst.COffset(x, y)
+			dst.Cb[i] = color[1]
+			dst.Cr[i] = color[2]
+		}
+	}
+}
+
+// drawYCbCr draws src centered in a rectangle of a 4:2:0 image, scaled
+// to fit
+func drawYCbCr(dst *image.YCbCr, r image.Rectangle, src *image.YCbCr) {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	w, h := r.Dx(), r.Dy()
+	if sw*h > sh*w {
+		h = sh * w / sw
+	} else {
+		w = sw * h / sh
+	}
+	// aligned on the chroma samples
+	x := (r.Min.X + (r.Dx()-w)/2) &^ 1
+	y := (r.Min.Y + (r.Dy()-h)/2) &^ 1
+	scaleYCbCr(dst, image.Rect(x, y, x+w&^1, y+h&^1), src)
+}
+
+// scaleYCbCr draws src in a rectangle of a 4:2:0 image with the nearest
+// samples, the rectangle is aligned on the chroma samples
+func scaleYCbCr(dst *image.YCbCr, r image.Rectangle, src *image.YCbCr) {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	w, h := r.Dx(), r.Dy()
+
+	for y := 0; y < h; y++ {
+		sy := src.Rect.Min.Y + y*sh/h
+		i := dst.YOffset(r.Min.X, r.Min.Y+y)
+		for x := 0; x < w; x++ {
+			dst.Y[i+x] = src.Y[src.YOffset(src.Rect.Min.X+x*sw/w, sy)]
+		}
+	}
+	for y := 0; y < h; y += 2 {
+		sy := src.Rect.Min.Y + y*sh/h
+		for x := 0; x < w; x += 2 {
+			i := dst.COffset(r.Min.X+x, r.Min.Y+y)
+			j := src.COffset(src.Rect.Min.X+x*sw/w, sy)
+			dst.Cb[i] = src.Cb[j]
+			dst.Cr[i] = src.Cr[j]
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package elements
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// frame returns a 4:2:0 frame of a luma
+func frame(width, height int, luma uint8) *image.YCbCr {
+	img := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	fillYCbCr(img, img.Rect, [3]uint8{luma, 128, 128})
+	return img
+}
+
+func TestCompositor(t *testing.T) {
+	c := NewCompositor(CompositorConfig{Width: 64, Height: 36, FPS: 50})
+	recorder := &sampleCollector{}
+	c.Attach(recorder)
+
+	// other samples are ignored
+	assert.NoError(t, c.Write(&avp.Sample{ID: "a", Type: avp.TypeVP8, Payload: []byte{0x00}}))
+	assert.Equal(t, ErrUnsupportedPayload, c.Write(&avp.Sample{ID: "a", Type: TypeYCbCr, Payload: "frame"}))
+	assert.NoError(t, c.Write(&avp.Sample{ID: "a", Type: TypeYCbCr, Payload: frame(32, 18, 200)}))
+	assert.NoError(t, c.Write(&avp.Sample{ID: "b", Type: TypeYCbCr, Payload: frame(32, 18, 100)}))
+
+	assert.Eventually(t, func() bool {
+		recorder.Lock()
+		defer recorder.Unlock()
+		return len(recorder.samples) >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+	c.Close()
+	assert.True(t, recorder.closed)
+
+	for i, sample := range recorder.samples {
+		assert.Equal(t, "composite", sample.ID)
+		assert.Equal(t, TypeYCbCr, sample.Type)
+		assert.Equal(t, uint32(i*1800), sample.Timestamp)
+	}
+	canvas := recorder.samples[len(recorder.samples)-1].Payload.(*image.YCbCr)
+	assert.Equal(t, image.Rect(0, 0, 64, 36), canvas.Rect)
+	// side by side in the middle row
+	assert.Equal(t, uint8(200), canvas.YCbCrAt(16, 18).Y)
+	assert.Equal(t, uint8(100), canvas.YCbCrAt(48, 18).Y)
+	assert.Equal(t, uint8(16), canvas.YCbCrAt(16, 2).Y)
+}
+
+func TestCompositor_Tiles(t *testing.T) {
+	c := NewCompositor(CompositorConfig{Width: 1280, Height: 720})
+	assert.Equal(t, []image.Rectangle{image.Rect(0, 0, 1280, 720)}, c.tiles(1))
+	assert.Equal(t, []image.Rectangle{
+		image.Rect(0, 0, 640, 360),
+		image.Rect(640, 0, 1280, 360),
+		// the last row is centered
+		image.Rect(320, 360, 960, 720),
+	}, c.tiles(3))
+
+	c.SetLayout(LayoutActiveSpeaker)
+	assert.Equal(t, []image.Rectangle{
+		image.Rect(0, 0, 1280, 540),
+		image.Rect(320, 540, 640, 720),
+		image.Rect(640, 540, 960, 720),
+	}, c.tiles(3))
+
+	c.SetLayout(LayoutPictureInPicture)
+	assert.Equal(t, []image.Rectangle{
+		image.Rect(0, 0, 1280, 720),
+		image.Rect(944, 524, 1264, 704),
+		image.Rect(608, 524, 928, 704),
+	}, c.tiles(3))
+}
+
+func TestCompositor_ActiveSpeaker(t *testing.T) {
+	c := NewCompositor(CompositorConfig{
+		Width:    64,
+		Height:   36,
+		Layout:   LayoutPictureInPicture,
+		Speakers: map[string]string{"audio-c": "c"},
+	})
+	defer c.Close()
+	for i, id := range []string{"a", "b", "c"} {
+		assert.NoError(t, c.Write(&avp.Sample{ID: id, Type: TypeYCbCr, Payload: frame(64, 36, uint8(50*(i+1)))}))
+	}
+
+	c.mu.Lock()
+	assert.Equal(t, []string{"a", "b", "c"}, c.ids())
+	c.mu.Unlock()
+
+	// the video track of the speaking audio track of a vad is the
+	// main tile
+	assert.NoError(t, c.Write(&avp.Sample{ID: "audio-c", Type: TypeMetadata, Payload: VADEvent{Speaking: true}}))
+	assert.NoError(t, c.Write(&avp.Sample{ID: "audio-a", Type: TypeMetadata, Payload: VADEvent{Speaking: false}}))
+	// audio tracks without a tile are ignored
+	assert.NoError(t, c.Write(&avp.Sample{ID: "audio-b", Type: TypeMetadata, Payload: VADEvent{Speaking: true}}))
+
+	c.mu.Lock()
+	assert.Equal(t, []string{"c", "a", "b"}, c.ids())
+	c.mu.Unlock()
+
+	c.SetSpeakerTrack("audio-b", "b")
+	assert.NoError(t, c.Write(&avp.Sample{ID: "audio-b", Type: TypeMetadata, Payload: VADEvent{Speaking: true}}))
+	c.mu.Lock()
+	assert.Equal(t, []string{"b", "a", "c"}, c.ids())
+	c.mu.Unlock()
+
+	c.SetActiveSpeaker("c")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// stale tracks are replaced by the placeholder, then removed
+	c.tracks["a"].updated = time.Now().Add(-time.Minute)
+	c.tracks["b"].updated = time.Now().Add(-3 * time.Second)
+	canvas := c.compose().Payload.(*image.YCbCr)
+	assert.Equal(t, uint8(150), canvas.YCbCrAt(8, 8).Y)
+	assert.Equal(t, uint8(64), canvas.YCbCrAt(40, 15).Y)
+	assert.Equal(t, []string{"c", "b"}, c.ids())
+}
+
+func TestCopyYCbCr(t *testing.T) {
+	src := frame(32, 18, 10)
+	fillYCbCr(src, image.Rect(16, 8, 32, 18), [3]uint8{20, 30, 40})
+
+	dst := copyYCbCr(nil, src.SubImage(image.Rect(16, 8, 32, 18)).(*image.YCbCr))
+	assert.Equal(t, image.Rect(0, 0, 16, 10), dst.Rect)
+	for _, v := range dst.Y {
+		assert.Equal(t, uint8(20), v)
+	}
+	for i := range dst.Cb {
+		assert.Equal(t, uint8(30), dst.Cb[i])
+		assert.Equal(t, uint8(40), dst.Cr[i])
+	}
+	// reused with the same size
+	assert.Same(t, dst, copyYCbCr(dst, frame(16, 10, 0)))
+}
@@ -4,50 +4,238 @@ import (
 	"bytes"
 	"errors"
 	"image"
-	"image/color"
+	"image/draw"
 	"image/jpeg"
+	"image/png"
 
 	avp "github.com/pion/ion-avp/pkg"
 )
 
+var errUnsupportedDestType = errors.New("unsupported dest type")
+
+// ConverterConfig configures a Converter
+type ConverterConfig struct {
+	// Type of the output, TypeYCbCr, TypeRGBA, TypeRGB24, TypeJPEG or
+	// TypePNG.
+	Type int
+	// Quality of the jpeg output from 1 to 100. Defaults to 75.
+	Quality int
+}
+
 // Converter instance
 type Converter struct {
 	Node
-	typ int
+	config ConverterConfig
 }
 
 // NewConverter instance. Converter converts between
-// media types.
+// media types. YCbCr frames are 4:2:0 with the bt.601 studio range of
+// the decoder and encoder, jpeg images use the full range.
 //
 // Currently supports:
-//     - YCbCR -> JPEG
+//   - YCbCr, RGBA, RGB24, JPEG, PNG -> YCbCr, RGBA, RGB24, JPEG, PNG
 func NewConverter(typ int) *Converter {
+	return NewConverterWithConfig(ConverterConfig{Type: typ})
+}
+
+// NewConverterWithConfig instance, see NewConverter
+func NewConverterWithConfig(config ConverterConfig) *Converter {
+	if config.Quality == 0 {
+		config.Quality = jpeg.DefaultQuality
+	}
 	return &Converter{
-		typ: typ,
+		config: config,
 	}
 }
 
 func (c *Converter) Write(sample *avp.Sample) error {
-	var out []byte
-	img := sample.Payload.(image.Image)
-	switch img.ColorModel() {
-	case color.YCbCrModel:
-		switch c.typ {
-		case TypeJPEG:
-			buf := new(bytes.Buffer)
-			if err := jpeg.Encode(buf, img, nil); err != nil {
-				return err
-			}
-			out = buf.Bytes()
-		default:
-			return errors.New("unsupported dest type")
+	var img image.Image
+	switch sample.Type {
+	case TypeYCbCr, TypeRGBA, TypeRGB24:
+		var ok bool
+		if img, ok = sample.Payload.(image.Image); !ok {
+			return ErrUnsupportedPayload
 		}
+	case TypeJPEG, TypePNG:
+		payload, ok := sample.Payload.([]byte)
+		if !ok {
+			return ErrUnsupportedPayload
+		}
+		decoded, _, err := image.Decode(bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		// the full range ycbcr of a jpeg isn't a YCbCr frame
+		img = drawRGBA(decoded)
 	default:
-		return errors.New("unsupported source type")
+		return nil
+	}
+
+	var out interface{}
+	switch c.config.Type {
+	case TypeYCbCr:
+		out = toYCbCr(img)
+	case TypeRGBA:
+		out = toRGBA(img)
+	case TypeRGB24:
+		out = toRGB24(img)
+	case TypeJPEG:
+		buf := new(bytes.Buffer)
+		if err := jpeg.Encode(buf, toRGBA(img), &jpeg.Options{Quality: c.config.Quality}); err != nil {
+			return err
+		}
+		out = buf.Bytes()
+	case TypePNG:
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, toRGBA(img)); err != nil {
+			return err
+		}
+		out = buf.Bytes()
+	default:
+		return errUnsupportedDestType
 	}
 
 	return c.Node.Write(&avp.Sample{
-		Type:    c.typ,
-		Payload: out,
+		ID:        sample.ID,
+		Type:      c.config.Type,
+		Timestamp: sample.Timestamp,
+		Payload:   out,
 	})
 }
+
+// studioLuma returns the bt.601 studio range luma of a rgb color
+func studioLuma(r, g, b int) uint8 {
+	return uint8((66*r+129*g+25*b+128)>>8 + 16)
+}
+
+// studioChroma returns the bt.601 studio range chroma of a rgb color
+func studioChroma(r, g, b int) (uint8, uint8) {
+	return uint8((-38*r-74*g+112*b+128)>>8 + 128), uint8((112*r-94*g-18*b+128)>>8 + 128)
+}
+
+// studioRGB returns the rgb color of a bt.601 studio range color
+func studioRGB(y, cb, cr uint8) (uint8, uint8, uint8) {
+	c, d, e := 298*(int(y)-16), int(cb)-128, int(cr)-128
+	clamp := func(v int) uint8 {
+		v = (v + 128) >> 8
+		if v < 0 {
+			return 0
+		} else if v > 0xff {
+			return 0xff
+		}
+		return uint8(v)
+	}
+	return clamp(c + 409*e), clamp(c - 100*d - 208*e), clamp(c + 516*d)
+}
+
+// toYCbCr returns a 4:2:0 image of img, the chroma of 2x2 pixels is
+// averaged
+func toYCbCr(img image.Image) *image.YCbCr {
+	if src, ok := img.(*image.YCbCr); ok {
+		if src.SubsampleRatio == image.YCbCrSubsampleRatio420 {
+			return src
+		}
+		return subsampleYCbCr(src)
+	}
+	src := toRGBA(img)
+	b := src.Rect
+	dst := image.NewYCbCr(image.Rectangle{Max: b.Size()}, image.YCbCrSubsampleRatio420)
+	for y := 0; y < b.Dy(); y += 2 {
+		for x := 0; x < b.Dx(); x += 2 {
+			var sr, sg, sb, n int
+			for dy := 0; dy < 2 && y+dy < b.Dy(); dy++ {
+				for dx := 0; dx < 2 && x+dx < b.Dx(); dx++ {
+					p := src.Pix[src.PixOffset(b.Min.X+x+dx, b.Min.Y+y+dy):]
+					r, g, b := int(p[0]), int(p[1]), int(p[2])
+					dst.Y[dst.YOffset(x+dx, y+dy)] = studioLuma(r, g, b)
+					sr, sg, sb, n = sr+r, sg+g, sb+b, n+1
+				}
+			}
+			i := dst.COffset(x, y)
+			dst.Cb[i], dst.Cr[i] = studioChroma(sr/n, sg/n, sb/n)
+		}
+	}
+	return dst
+}
+
+// subsampleYCbCr returns a 4:2:0 image of a YCbCr image of another
+// subsample ratio, the chroma of 2x2 pixels is averaged
+func subsampleYCbCr(src *image.YCbCr) *image.YCbCr {
+	b := src.Rect
+	dst := image.NewYCbCr(image.Rectangle{Max: b.Size()}, image.YCbCrSubsampleRatio420)
+	for y := 0; y < b.Dy(); y++ {
+		copy(dst.Y[dst.YOffset(0, y):dst.YOffset(0, y)+b.Dx()], src.Y[src.YOffset(b.Min.X, b.Min.Y+y):])
+	}
+	for y := 0; y < b.Dy(); y += 2 {
+		for x := 0; x < b.Dx(); x += 2 {
+			var scb, scr, n int
+			for dy := 0; dy < 2 && y+dy < b.Dy(); dy++ {
+				for dx := 0; dx < 2 && x+dx < b.Dx(); dx++ {
+					i := src.COffset(b.Min.X+x+dx, b.Min.Y+y+dy)
+					scb, scr, n = scb+int(src.Cb[i]), scr+int(src.Cr[i]), n+1
+				}
+			}
+			i := dst.COffset(x, y)
+			dst.Cb[i], dst.Cr[i] = uint8(scb/n), uint8(scr/n)
+		}
+	}
+	return dst
+}
+
+// toRGBA returns an RGBA image of img
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	switch src := img.(type) {
+	case *RGB24:
+		dst := image.NewRGBA(image.Rectangle{Max: b.Size()})
+		for i := 0; i < len(src.Pix)/3; i++ {
+			copy(dst.Pix[i*4:], src.Pix[i*3:i*3+3])
+			dst.Pix[i*4+3] = 0xff
+		}
+		return dst
+	case *image.YCbCr:
+		dst := image.NewRGBA(image.Rectangle{Max: b.Size()})
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				i := src.COffset(b.Min.X+x, b.Min.Y+y)
+				r, g, bb := studioRGB(src.Y[src.YOffset(b.Min.X+x, b.Min.Y+y)], src.Cb[i], src.Cr[i])
+				copy(dst.Pix[dst.PixOffset(x, y):], []byte{r, g, bb, 0xff})
+			}
+		}
+		return dst
+	}
+	return drawRGBA(img)
+}
+
+// drawRGBA returns an RGBA image of img with the conversions of the
+// image package, e.g. of the full range ycbcr of a jpeg
+func drawRGBA(img image.Image) *image.RGBA {
+	if src, ok := img.(*image.RGBA); ok {
+		return src
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rectangle{Max: b.Size()})
+	draw.Draw(dst, dst.Rect, img, b.Min, draw.Src)
+	return dst
+}
+
+// toRGB24 returns an RGB24 image of img, the alpha is dropped
+func toRGB24(img image.Image) *RGB24 {
+	if src, ok := img.(*RGB24); ok {
+		return src
+	}
+	src := toRGBA(img)
+	b := src.Rect
+	dst := &RGB24{
+		Pix:    make([]byte, b.Dx()*b.Dy()*3),
+		Width:  b.Dx(),
+		Height: b.Dy(),
+	}
+	for y := 0; y < b.Dy(); y++ {
+		row := src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x := 0; x < b.Dx(); x++ {
+			copy(dst.Pix[(y*b.Dx()+x)*3:], row[x*4:x*4+3])
+		}
+	}
+	return dst
+}
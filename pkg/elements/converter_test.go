@@ -0,0 +1,149 @@
+package elements
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// convert writes a sample to a converter and returns its output
+func convert(t *testing.T, config ConverterConfig, sample *avp.Sample) *avp.Sample {
+	c := NewConverterWithConfig(config)
+	recorder := &sampleCollector{}
+	c.Attach(recorder)
+	assert.NoError(t, c.Write(sample))
+	if !assert.Len(t, recorder.samples, 1) {
+		t.FailNow()
+	}
+	return recorder.samples[0]
+}
+
+func TestConverter(t *testing.T) {
+	src := &avp.Sample{ID: "video", Type: TypeYCbCr, Timestamp: 3000, Payload: frame(4, 2, 100)}
+
+	// YCbCr -> RGBA -> RGB24 -> YCbCr, the studio range luma 100 is rgb 98
+	rgba := convert(t, ConverterConfig{Type: TypeRGBA}, src)
+	assert.Equal(t, TypeRGBA, rgba.Type)
+	assert.Equal(t, "video", rgba.ID)
+	assert.Equal(t, uint32(3000), rgba.Timestamp)
+	img := rgba.Payload.(*image.RGBA)
+	assert.Equal(t, image.Rect(0, 0, 4, 2), img.Rect)
+	assert.Equal(t, color.RGBA{98, 98, 98, 0xff}, img.At(3, 1))
+
+	rgb := convert(t, ConverterConfig{Type: TypeRGB24}, rgba)
+	assert.Equal(t, TypeRGB24, rgb.Type)
+	assert.Equal(t, uint32(3000), rgb.Timestamp)
+	rgb24 := rgb.Payload.(*RGB24)
+	assert.Equal(t, 4, rgb24.Width)
+	assert.Equal(t, 2, rgb24.Height)
+	assert.Equal(t, bytes.Repeat([]byte{98}, 4*2*3), rgb24.Pix)
+
+	ycbcr := convert(t, ConverterConfig{Type: TypeYCbCr}, rgb)
+	yuv := ycbcr.Payload.(*image.YCbCr)
+	assert.Equal(t, image.YCbCrSubsampleRatio420, yuv.SubsampleRatio)
+	assert.Equal(t, bytes.Repeat([]byte{100}, 8), yuv.Y)
+	assert.Equal(t, []byte{128, 128}, yuv.Cb)
+	assert.Equal(t, []byte{128, 128}, yuv.Cr)
+
+	// the chroma of 2x2 pixels is averaged
+	pix := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	copy(pix.Pix, []byte{255, 0, 0, 255, 255, 0, 0, 255, 0, 0, 255, 255, 0, 0, 255, 255})
+	yuv = convert(t, ConverterConfig{Type: TypeYCbCr}, &avp.Sample{Type: TypeRGBA, Payload: pix}).Payload.(*image.YCbCr)
+	cb, cr := studioChroma(127, 0, 127)
+	assert.Equal(t, []byte{cb}, yuv.Cb)
+	assert.Equal(t, []byte{cr}, yuv.Cr)
+	assert.Equal(t, []byte{82, 82, 41, 41}, yuv.Y)
+}
+
+func TestConverter_YCbCr(t *testing.T) {
+	// 4:4:4 frames are subsampled, the values are kept
+	src := image.NewYCbCr(image.Rect(0, 0, 2, 2), image.YCbCrSubsampleRatio444)
+	copy(src.Y, []byte{50, 60, 70, 80})
+	copy(src.Cb, []byte{100, 110, 120, 130})
+	copy(src.Cr, []byte{140, 150, 160, 170})
+	yuv := convert(t, ConverterConfig{Type: TypeYCbCr}, &avp.Sample{Type: TypeYCbCr, Payload: src}).Payload.(*image.YCbCr)
+	assert.Equal(t, image.YCbCrSubsampleRatio420, yuv.SubsampleRatio)
+	assert.Equal(t, []byte{50, 60, 70, 80}, yuv.Y)
+	assert.Equal(t, []byte{115}, yuv.Cb)
+	assert.Equal(t, []byte{155}, yuv.Cr)
+
+	// the full range of a jpeg is converted to the studio range
+	gray := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range gray.Pix {
+		gray.Pix[i] = 255
+	}
+	buf := new(bytes.Buffer)
+	assert.NoError(t, jpeg.Encode(buf, gray, nil))
+	yuv = convert(t, ConverterConfig{Type: TypeYCbCr}, &avp.Sample{Type: TypeJPEG, Payload: buf.Bytes()}).Payload.(*image.YCbCr)
+	assert.Equal(t, image.YCbCrSubsampleRatio420, yuv.SubsampleRatio)
+	assert.InDelta(t, 235, yuv.Y[0], 1)
+	assert.InDelta(t, 128, yuv.Cb[0], 1)
+
+	// and back to the full range
+	out := convert(t, ConverterConfig{Type: TypeJPEG}, &avp.Sample{Type: TypeYCbCr, Payload: yuv})
+	img, err := jpeg.Decode(bytes.NewReader(out.Payload.([]byte)))
+	assert.NoError(t, err)
+	r, _, _, _ := img.At(8, 8).RGBA()
+	assert.InDelta(t, 255, r>>8, 2)
+}
+
+func TestConverter_Encode(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 7)
+		if i%4 == 3 {
+			src.Pix[i] = 0xff
+		}
+	}
+	sample := &avp.Sample{ID: "video", Type: TypeRGBA, Timestamp: 90000, Payload: src}
+
+	// quality defaults to 75
+	low := convert(t, ConverterConfig{Type: TypeJPEG, Quality: 10}, sample)
+	def := convert(t, ConverterConfig{Type: TypeJPEG}, sample)
+	assert.Equal(t, TypeJPEG, def.Type)
+	assert.Equal(t, "video", def.ID)
+	assert.Equal(t, uint32(90000), def.Timestamp)
+	assert.Less(t, len(low.Payload.([]byte)), len(def.Payload.([]byte)))
+	config, err := jpeg.DecodeConfig(bytes.NewReader(def.Payload.([]byte)))
+	assert.NoError(t, err)
+	assert.Equal(t, 64, config.Width)
+
+	// png is lossless
+	out := convert(t, ConverterConfig{Type: TypePNG}, sample)
+	assert.Equal(t, TypePNG, out.Type)
+	img, err := png.Decode(bytes.NewReader(out.Payload.([]byte)))
+	assert.NoError(t, err)
+	r, g, b, a := img.At(10, 10).RGBA()
+	assert.Equal(t, src.At(10, 10), color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)})
+
+	// and decoded back to rgb24
+	rgb := convert(t, ConverterConfig{Type: TypeRGB24}, out).Payload.(*RGB24)
+	assert.Equal(t, src.Pix[:3], rgb.Pix[:3])
+
+	// rgb24 to jpeg
+	rgb24 := &avp.Sample{Type: TypeRGB24, Payload: &RGB24{Pix: make([]byte, 16*16*3), Width: 16, Height: 16}}
+	out = convert(t, ConverterConfig{Type: TypeJPEG}, rgb24)
+	_, err = jpeg.Decode(bytes.NewReader(out.Payload.([]byte)))
+	assert.NoError(t, err)
+}
+
+func TestConverter_Errors(t *testing.T) {
+	c := NewConverter(TypeJPEG)
+	recorder := &sampleCollector{}
+	c.Attach(recorder)
+
+	// other samples are ignored
+	assert.NoError(t, c.Write(&avp.Sample{Type: avp.TypeVP8, Payload: []byte{0x00}}))
+	assert.Equal(t, ErrUnsupportedPayload, c.Write(&avp.Sample{Type: TypeYCbCr, Payload: []byte{0x00}}))
+	assert.Error(t, c.Write(&avp.Sample{Type: TypePNG, Payload: []byte{0x00}}))
+	assert.Empty(t, recorder.samples)
+
+	c = NewConverter(TypeWebM)
+	assert.Error(t, c.Write(&avp.Sample{Type: TypeYCbCr, Payload: frame(2, 2, 0)}))
+}
@@ -0,0 +1,109 @@
+package elements
+
+import (
+	"encoding/json"
+	"sync"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/pion/webrtc/v3"
+)
+
+const defaultDataChannelLabel = "avp"
+
+// DataChannelConfig configures a DataChannelWriter
+type DataChannelConfig struct {
+	// Label of the data channel. Defaults to "avp", apart from the api
+	// channel of the sfu.
+	Label string
+	// Unordered allows messages to be delivered out of order
+	Unordered bool
+	// MaxRetransmits and MaxPacketLifeTime (ms) make the channel
+	// unreliable. At most one of them should be set.
+	MaxRetransmits    *uint16
+	MaxPacketLifeTime *uint16
+	// Binary sends raw []byte payloads instead of json encoded samples
+	Binary bool
+}
+
+// dataChannelMessage is the json representation of a sample
+type dataChannelMessage struct {
+	ID             string      `json:"id"`
+	Type           int         `json:"type"`
+	Timestamp      uint32      `json:"timestamp"`
+	SequenceNumber uint16      `json:"sequenceNumber"`
+	Payload        interface{} `json:"payload"`
+}
+
+// DataChannelWriter instance
+type DataChannelWriter struct {
+	Leaf
+	config DataChannelConfig
+	mu     sync.Mutex          // guards dc
+	dc     *webrtc.DataChannel // of the last publisher, a reconnect opens another
+}
+
+// NewDataChannelWriter instance. DataChannelWriter sends samples to the
+// clients of the session over a publisher data channel. Samples are json
+// encoded unless the writer is configured as binary.
+func NewDataChannelWriter(config DataChannelConfig) *DataChannelWriter {
+	if config.Label == "" {
+		config.Label = defaultDataChannelLabel
+	}
+	return &DataChannelWriter{
+		config: config,
+	}
+}
+
+// Publish opens the data channel on the transport publisher
+func (w *DataChannelWriter) Publish(pub *avp.Publisher) error {
+	ordered := !w.config.Unordered
+	dc, err := pub.DataChannel(w.config.Label, &webrtc.DataChannelInit{
+		Ordered:           &ordered,
+		MaxRetransmits:    w.config.MaxRetransmits,
+		MaxPacketLifeTime: w.config.MaxPacketLifeTime,
+	})
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.dc = dc
+	w.mu.Unlock()
+	return nil
+}
+
+// channel returns the data channel of the current publisher
+func (w *DataChannelWriter) channel() *webrtc.DataChannel {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dc
+}
+
+func (w *DataChannelWriter) Write(sample *avp.Sample) error {
+	dc := w.channel()
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		// not connected yet, drop the sample
+		return nil
+	}
+
+	if w.config.Binary {
+		switch payload := sample.Payload.(type) {
+		case []byte:
+			return dc.Send(payload)
+		case string:
+			return dc.SendText(payload)
+		}
+		return ErrUnsupportedPayload
+	}
+
+	msg, err := json.Marshal(dataChannelMessage{
+		ID:             sample.ID,
+		Type:           sample.Type,
+		Timestamp:      sample.Timestamp,
+		SequenceNumber: sample.SequenceNumber,
+		Payload:        sample.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	return dc.SendText(string(msg))
+}
@@ -0,0 +1,124 @@
+package elements
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func connectPublisher(t *testing.T, pub *avp.Publisher, remote *webrtc.PeerConnection) {
+	pub.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c != nil {
+			assert.NoError(t, remote.AddICECandidate(c.ToJSON()))
+		}
+	})
+
+	offer, err := pub.CreateOffer()
+	assert.NoError(t, err)
+	assert.NoError(t, remote.SetRemoteDescription(offer))
+	answer, err := remote.CreateAnswer(nil)
+	assert.NoError(t, err)
+	gatherComplete := webrtc.GatheringCompletePromise(remote)
+	assert.NoError(t, remote.SetLocalDescription(answer))
+	<-gatherComplete
+	assert.NoError(t, pub.SetRemoteDescription(*remote.LocalDescription()))
+}
+
+func TestDataChannelWriter_Write(t *testing.T) {
+	pub, err := avp.NewPublisher(avp.WebRTCTransportConfig{})
+	assert.NoError(t, err)
+	defer pub.Close()
+
+	remote, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+	defer remote.Close()
+
+	received := make(chan webrtc.DataChannelMessage, 1)
+	remote.OnDataChannel(func(dc *webrtc.DataChannel) {
+		if dc.Label() != "results" {
+			return
+		}
+		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+			received <- msg
+		})
+	})
+
+	writer := NewDataChannelWriter(DataChannelConfig{Label: "results"})
+	assert.NoError(t, writer.Publish(pub))
+
+	opened := make(chan struct{})
+	writer.channel().OnOpen(func() {
+		close(opened)
+	})
+
+	// Samples are dropped until the channel is open
+	assert.NoError(t, writer.Write(&avp.Sample{Type: TypeMetadata, Payload: "dropped"}))
+
+	connectPublisher(t, pub, remote)
+
+	select {
+	case <-opened:
+	case <-time.After(10 * time.Second):
+		t.Fatal("data channel not opened")
+	}
+
+	assert.NoError(t, writer.Write(&avp.Sample{ID: "tid", Type: TypeMetadata, Timestamp: 10, Payload: map[string]bool{"speaking": true}}))
+
+	select {
+	case msg := <-received:
+		assert.True(t, msg.IsString)
+		var decoded dataChannelMessage
+		assert.NoError(t, json.Unmarshal(msg.Data, &decoded))
+		assert.Equal(t, "tid", decoded.ID)
+		assert.Equal(t, TypeMetadata, decoded.Type)
+		assert.Equal(t, uint32(10), decoded.Timestamp)
+		assert.Equal(t, map[string]interface{}{"speaking": true}, decoded.Payload)
+	case <-time.After(10 * time.Second):
+		t.Fatal("message not received")
+	}
+}
+
+func TestDataChannelWriter_Republish(t *testing.T) {
+	writer := NewDataChannelWriter(DataChannelConfig{Label: "results"})
+
+	var pubs []*avp.Publisher
+	for i := 0; i < 2; i++ {
+		pub, err := avp.NewPublisher(avp.WebRTCTransportConfig{})
+		assert.NoError(t, err)
+		defer pub.Close()
+		pubs = append(pubs, pub)
+	}
+	assert.NoError(t, writer.Publish(pubs[0]))
+	first := writer.channel()
+
+	// the transport publishes on the new publisher of a reconnect
+	// while samples are written
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, writer.Publish(pubs[1]))
+	}()
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, writer.Write(&avp.Sample{Type: TypeMetadata, Payload: "dropped"}))
+	}
+	<-done
+
+	assert.NotEqual(t, first, writer.channel())
+}
+
+func TestDataChannelWriter_DefaultLabel(t *testing.T) {
+	pub, err := avp.NewPublisher(avp.WebRTCTransportConfig{})
+	assert.NoError(t, err)
+	defer pub.Close()
+
+	writer := NewDataChannelWriter(DataChannelConfig{})
+	assert.NoError(t, writer.Publish(pub))
+
+	// the samples aren't sent on the api channel of the sfu
+	assert.Equal(t, "avp", writer.channel().Label())
+	assert.NotEqual(t, avp.APIChannelLabel, writer.channel().Label())
+}
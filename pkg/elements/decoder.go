@@ -21,6 +21,8 @@ type Decoder struct {
 	typ   int
 	run   bool
 	async bool
+	id    string
+	ts    uint32
 }
 
 // NewDecoder instance. Decoder takes as input VPX streams
@@ -62,6 +64,8 @@ func (dec *Decoder) Write(sample *avp.Sample) error {
 		}
 
 		dec.Lock()
+		dec.id = sample.ID
+		dec.ts = sample.Timestamp
 		err := vpx.Error(vpx.CodecDecode(dec.ctx, string(payload), uint32(len(payload)), nil, 0))
 		dec.Unlock()
 		if err != nil {
@@ -92,13 +96,17 @@ func (dec *Decoder) write() error {
 
 		if dec.typ == TypeYCbCr {
 			return dec.Node.Write(&avp.Sample{
-				Type:    TypeYCbCr,
-				Payload: img.ImageYCbCr(),
+				ID:        dec.id,
+				Type:      TypeYCbCr,
+				Timestamp: dec.ts,
+				Payload:   img.ImageYCbCr(),
 			})
 		} else if dec.typ == TypeRGBA {
 			return dec.Node.Write(&avp.Sample{
-				Type:    TypeRGBA,
-				Payload: img.ImageRGBA(),
+				ID:        dec.id,
+				Type:      TypeRGBA,
+				Timestamp: dec.ts,
+				Payload:   img.ImageRGBA(),
 			})
 		}
 	}
@@ -2,6 +2,8 @@ package elements
 
 import (
 	"errors"
+	"image"
+	"image/color"
 
 	avp "github.com/pion/ion-avp/pkg"
 	log "github.com/pion/ion-log"
@@ -16,13 +18,59 @@ const (
 	TypeYCbCr    = 104
 	TypeJPEG     = 105
 	TypeRGBA     = 106
+	TypePatch    = 107
+	TypePCM      = 108
+	TypePNG      = 109
 )
 
+// Patch is the payload of a TypePatch sample. It overwrites data
+// previously written at an offset of the output, e.g. to fix up the
+// header of a container on close.
+type Patch struct {
+	Offset int64
+	Data   []byte
+}
+
+// PCM is the payload of a TypePCM sample, interleaved signed 16-bit
+// samples of all channels
+type PCM struct {
+	Data       []int16
+	SampleRate int
+	Channels   int
+}
+
+// RGB24 is the payload of a TypeRGB24 sample, packed 8-bit red, green
+// and blue pixels without padding
+type RGB24 struct {
+	Pix    []byte
+	Width  int
+	Height int
+}
+
+// ColorModel of the image
+func (p *RGB24) ColorModel() color.Model { return color.RGBAModel }
+
+// Bounds of the image
+func (p *RGB24) Bounds() image.Rectangle { return image.Rect(0, 0, p.Width, p.Height) }
+
+// At returns the color of the pixel at x, y
+func (p *RGB24) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Bounds())) {
+		return color.RGBA{}
+	}
+	i := (y*p.Width + x) * 3
+	return color.RGBA{p.Pix[i], p.Pix[i+1], p.Pix[i+2], 0xff}
+}
+
 var (
 	// ErrAttachNotSupported returned when attaching elements is not supported
 	ErrAttachNotSupported = errors.New("attach not supported")
 	// ErrElementAlreadyAttached returned when attaching an element that is already attached
 	ErrElementAlreadyAttached = errors.New("element already attached")
+	// ErrUnsupportedPayload returned when a sample payload can't be handled by an element
+	ErrUnsupportedPayload = errors.New("unsupported payload")
+	// ErrUnsupportedFormat returned when a file container or codec can't be read
+	ErrUnsupportedFormat = errors.New("unsupported format")
 )
 
 type Node struct {
@@ -49,6 +97,11 @@ func (e *Node) Close() {
 	}
 }
 
+// Children returns the attached elements
+func (e *Node) Children() []avp.Element {
+	return append([]avp.Element{}, e.children...)
+}
+
 type Leaf struct{}
 
 func (e *Leaf) Write(sample *avp.Sample) error {
@@ -92,3 +145,8 @@ func (p *Pipeline) Attach(el avp.Element) {
 func (p *Pipeline) Close() {
 	p.head.Close()
 }
+
+// Children returns the head of the pipeline
+func (p *Pipeline) Children() []avp.Element {
+	return []avp.Element{p.head}
+}
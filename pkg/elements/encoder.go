@@ -0,0 +1,357 @@
+// +build libvpx
+
+package elements
+
+/*
+#cgo pkg-config: vpx
+#include <vpx/vpx_encoder.h>
+#include <vpx/vp8cx.h>
+
+// the control and the frames of packets aren't in the bindings of vpx
+
+static vpx_codec_err_t encoder_set_cpuused(void *ctx, int speed) {
+	return vpx_codec_control((vpx_codec_ctx_t *)ctx, VP8E_SET_CPUUSED, speed);
+}
+
+// packet_frame reads a packet of the kind VPX_CODEC_CX_FRAME_PKT
+static void packet_frame(const void *pkt, void **buf, size_t *sz, vpx_codec_pts_t *pts, int *key) {
+	const vpx_codec_cx_pkt_t *p = pkt;
+	*buf = p->data.frame.buf;
+	*sz = p->data.frame.sz;
+	*pts = p->data.frame.pts;
+	*key = (p->data.frame.flags & VPX_FRAME_IS_KEY) != 0;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"image"
+	"sync"
+	"time"
+	"unsafe"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+const (
+	defaultEncoderBitrate          = 1000000
+	defaultEncoderKeyframeInterval = 2 * time.Second
+
+	// duration of the first frame in the video clock, 30 fps
+	encoderFrameDuration = videoClockRate / 30
+	// cpu usage of the realtime encoding, faster with higher values
+	encoderRealtimeSpeed = 8
+)
+
+// EncoderConfig configures an Encoder
+type EncoderConfig struct {
+	// Codec of the output, avp.TypeVP8 or avp.TypeVP9. Defaults to
+	// avp.TypeVP8.
+	Codec int
+	// Bitrate of the output in bits per second. Defaults to 1Mbps.
+	Bitrate int
+	// KeyframeInterval is the maximum duration between keyframes.
+	// Defaults to 2s.
+	KeyframeInterval time.Duration
+	// Deadline of the encoding of a frame, longer deadlines improve the
+	// quality. Defaults to realtime.
+	Deadline time.Duration
+}
+
+// Encoder instance
+type Encoder struct {
+	sync.Mutex
+	Node
+	config    EncoderConfig
+	ctx       *vpx.CodecCtx
+	cfg       *vpx.CodecEncCfg
+	img       *vpx.Image
+	width     int
+	height    int
+	id        string
+	started   bool
+	origin    uint32 // timestamp of the first frame
+	timestamp uint32 // timestamp of the last frame
+	pts       int64  // unwrapped timestamp from the origin
+	duration  int64  // of the last frame
+	keyframe  int64  // pts of the last keyframe
+	forceKey  bool
+	closed    bool
+}
+
+// NewEncoder instance. Encoder takes as input the TypeYCbCr or TypeRGBA
+// frames of a track, e.g. of a Decoder or Compositor, and encodes them
+// into VP8 or VP9 samples. Frames with a timestamp not after the last
+// frame are dropped. A change of the frame size restarts the encoding
+// with a keyframe.
+func NewEncoder(config EncoderConfig) *Encoder {
+	if config.Codec == 0 {
+		config.Codec = avp.TypeVP8
+	}
+	if config.Bitrate == 0 {
+		config.Bitrate = defaultEncoderBitrate
+	}
+	if config.KeyframeInterval == 0 {
+		config.KeyframeInterval = defaultEncoderKeyframeInterval
+	}
+	return &Encoder{
+		config: config,
+	}
+}
+
+func (e *Encoder) Write(sample *avp.Sample) error {
+	var bounds image.Rectangle
+	switch img := sample.Payload.(type) {
+	case *image.YCbCr:
+		bounds = img.Rect
+	case *image.RGBA:
+		bounds = img.Rect
+	default:
+		if sample.Type == TypeYCbCr || sample.Type == TypeRGBA {
+			return ErrUnsupportedPayload
+		}
+		return nil
+	}
+	if bounds.Empty() {
+		return nil
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	if e.closed {
+		return nil
+	}
+
+	if e.started {
+		delta := int32(sample.Timestamp - e.timestamp)
+		if delta <= 0 {
+			return nil
+		}
+		e.pts += int64(delta)
+		e.duration = int64(delta)
+	} else {
+		e.started = true
+		e.origin = sample.Timestamp
+		e.duration = encoderFrameDuration
+	}
+	e.timestamp = sample.Timestamp
+	e.id = sample.ID
+
+	if e.ctx == nil || bounds.Dx() != e.width || bounds.Dy() != e.height {
+		if err := e.init(bounds.Dx(), bounds.Dy()); err != nil {
+			return err
+		}
+		log.Infof("Encoder has started with video width=%d, height=%d", e.width, e.height)
+	}
+
+	switch img := sample.Payload.(type) {
+	case *image.YCbCr:
+		e.copyYCbCr(img)
+	case *image.RGBA:
+		e.copyRGBA(img)
+	}
+
+	var flags vpx.EncFrameFlags
+	if e.forceKey || time.Duration(e.pts-e.keyframe)*time.Second/videoClockRate >= e.config.KeyframeInterval {
+		flags |= vpx.EflagForceKf
+		e.forceKey = false
+	}
+	if err := vpx.Error(vpx.CodecEncode(e.ctx, e.img, vpx.CodecPts(e.pts), uint(e.duration), flags, e.deadline())); err != nil {
+		return err
+	}
+	return e.write()
+}
+
+// RequestKeyframe encodes the next frame as a keyframe
+func (e *Encoder) RequestKeyframe() {
+	e.Lock()
+	defer e.Unlock()
+	e.forceKey = true
+}
+
+func (e *Encoder) deadline() uint {
+	if e.config.Deadline == 0 {
+		return vpx.DlRealtime
+	}
+	return uint(e.config.Deadline / time.Microsecond)
+}
+
+// init starts the encoding of frames of a size
+func (e *Encoder) init(width, height int) error {
+	e.destroy()
+
+	iface := vpx.EncoderIfaceVP8()
+	if e.config.Codec == avp.TypeVP9 {
+		iface = vpx.EncoderIfaceVP9()
+	}
+
+	// the defaults are read from their c copy, which is freed to copy the
+	// config again with the settings when the encoder is initialized. The
+	// encoder keeps that copy until it is destroyed.
+	cfg := &vpx.CodecEncCfg{}
+	err := vpx.Error(vpx.CodecEncConfigDefault(iface, cfg, 0))
+	cfg.Deref()
+	cfg.Free()
+	if err != nil {
+		return err
+	}
+	cfg.GW = uint32(width)
+	cfg.GH = uint32(height)
+	cfg.GTimebase = vpx.Rational{Num: 1, Den: videoClockRate}
+	cfg.GErrorResilient = vpx.ErrorResilientDefault
+	cfg.GLagInFrames = 0
+	cfg.RcEndUsage = vpx.Cbr
+	cfg.RcTargetBitrate = uint32(e.config.Bitrate / 1000)
+	cfg.RcTwopassStatsIn = vpx.FixedBuf{}
+	cfg.RcFirstpassMbStatsIn = vpx.FixedBuf{}
+	// keyframes are forced at the interval
+	cfg.KfMode = vpx.KfDisabled
+	e.cfg = cfg
+
+	e.ctx = vpx.NewCodecCtx()
+	if err := vpx.Error(vpx.CodecEncInitVer(e.ctx, iface, e.cfg, 0, vpx.EncoderABIVersion)); err != nil {
+		e.ctx.Free()
+		e.ctx = nil
+		e.destroy()
+		return err
+	}
+	if e.config.Deadline == 0 {
+		if err := vpx.Error(vpx.CodecErr(C.encoder_set_cpuused(unsafe.Pointer(e.ctx), encoderRealtimeSpeed))); err != nil {
+			log.Warnf("Encoder error setting speed: %s", err)
+		}
+	}
+
+	e.img = vpx.ImageAlloc(nil, vpx.ImageFormatI420, uint32(width), uint32(height), 1)
+	if e.img == nil {
+		e.destroy()
+		return fmt.Errorf("vpx: error allocating image of %dx%d", width, height)
+	}
+	e.img.Deref()
+	e.width, e.height = width, height
+	e.keyframe = e.pts
+	return nil
+}
+
+// plane returns the data of a plane of the image and its stride
+func (e *Encoder) plane(i, rows int) ([]byte, int) {
+	stride := int(e.img.Stride[i])
+	return (*[1 << 30]byte)(unsafe.Pointer(e.img.Planes[i]))[: stride*rows : stride*rows], stride
+}
+
+// copyYCbCr copies a frame to the i420 image of the encoder
+func (e *Encoder) copyYCbCr(img *image.YCbCr) {
+	y, ys := e.plane(0, e.height)
+	for row := 0; row < e.height; row++ {
+		i := img.YOffset(img.Rect.Min.X, img.Rect.Min.Y+row)
+		copy(y[row*ys:row*ys+e.width], img.Y[i:])
+	}
+
+	cw, ch := (e.width+1)/2, (e.height+1)/2
+	u, us := e.plane(1, ch)
+	v, vs := e.plane(2, ch)
+	for row := 0; row < ch; row++ {
+		for col := 0; col < cw; col++ {
+			i := img.COffset(img.Rect.Min.X+2*col, img.Rect.Min.Y+2*row)
+			u[row*us+col] = img.Cb[i]
+			v[row*vs+col] = img.Cr[i]
+		}
+	}
+}
+
+// copyRGBA converts a frame to the i420 image of the encoder with the
+// bt.601 studio range of the YCbCr frames, the chroma of 2x2 pixels is
+// averaged
+func (e *Encoder) copyRGBA(img *image.RGBA) {
+	y, ys := e.plane(0, e.height)
+	cw, ch := (e.width+1)/2, (e.height+1)/2
+	u, us := e.plane(1, ch)
+	v, vs := e.plane(2, ch)
+
+	for row := 0; row < ch; row++ {
+		for col := 0; col < cw; col++ {
+			var sr, sg, sb, n int
+			for dy := 0; dy < 2 && 2*row+dy < e.height; dy++ {
+				for dx := 0; dx < 2 && 2*col+dx < e.width; dx++ {
+					px, py := 2*col+dx, 2*row+dy
+					p := img.Pix[img.PixOffset(img.Rect.Min.X+px, img.Rect.Min.Y+py):]
+					r, g, b := int(p[0]), int(p[1]), int(p[2])
+					y[py*ys+px] = studioLuma(r, g, b)
+					sr, sg, sb, n = sr+r, sg+g, sb+b, n+1
+				}
+			}
+			u[row*us+col], v[row*vs+col] = studioChroma(sr/n, sg/n, sb/n)
+		}
+	}
+}
+
+// write writes the encoded frames
+func (e *Encoder) write() error {
+	var iter vpx.CodecIter
+	for {
+		pkt := vpx.CodecGetCxData(e.ctx, &iter)
+		if pkt == nil {
+			return nil
+		}
+		pkt.Deref()
+		if pkt.Kind != vpx.CodecCxFramePkt {
+			continue
+		}
+
+		var buf unsafe.Pointer
+		var size C.size_t
+		var pts C.vpx_codec_pts_t
+		var key C.int
+		C.packet_frame(unsafe.Pointer(pkt.Ref()), &buf, &size, &pts, &key)
+		if key != 0 {
+			e.keyframe = int64(pts)
+		}
+
+		if err := e.Node.Write(&avp.Sample{
+			ID:        e.id,
+			Type:      e.config.Codec,
+			Timestamp: e.origin + uint32(pts),
+			Payload:   C.GoBytes(buf, C.int(size)),
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// destroy frees the encoder and its image
+func (e *Encoder) destroy() {
+	if e.ctx != nil {
+		vpx.CodecDestroy(e.ctx)
+		e.ctx.Free()
+		e.ctx = nil
+	}
+	if e.cfg != nil {
+		e.cfg.Free()
+		e.cfg = nil
+	}
+	if e.img != nil {
+		vpx.ImageFree(e.img)
+		e.img = nil
+	}
+}
+
+// Close writes the frames buffered by the encoder and closes the
+// children
+func (e *Encoder) Close() {
+	e.Lock()
+	if !e.closed && e.ctx != nil {
+		if err := vpx.Error(vpx.CodecEncode(e.ctx, nil, -1, 1, 0, e.deadline())); err != nil {
+			log.Errorf("Encoder error flushing: %s", err)
+		} else if err := e.write(); err != nil {
+			log.Errorf("Encoder error writing sample: %s", err)
+		}
+		e.destroy()
+	}
+	e.closed = true
+	e.Unlock()
+
+	e.Node.Close()
+}
@@ -0,0 +1,63 @@
+// +build libvpx
+
+package elements
+
+import (
+	"image"
+	"testing"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoder(t *testing.T) {
+	encoder := NewEncoder(EncoderConfig{Codec: avp.TypeVP8})
+	encoded := &sampleCollector{}
+	encoder.Attach(encoded)
+	decoder := NewDecoder(0, TypeYCbCr)
+	encoder.Attach(decoder)
+	decoded := &sampleCollector{}
+	decoder.Attach(decoded)
+
+	// other samples are ignored
+	assert.NoError(t, encoder.Write(&avp.Sample{Type: avp.TypeVP8, Payload: rawVP8KeyframePkt}))
+	assert.Equal(t, ErrUnsupportedPayload, encoder.Write(&avp.Sample{Type: TypeYCbCr, Payload: "frame"}))
+
+	for i, ts := range []uint32{90000, 93000, 96000} {
+		if i == 2 {
+			encoder.RequestKeyframe()
+		}
+		assert.NoError(t, encoder.Write(&avp.Sample{ID: "video", Type: TypeYCbCr, Timestamp: ts, Payload: frame(64, 48, 100)}))
+	}
+	// frames not after the last one are dropped
+	assert.NoError(t, encoder.Write(&avp.Sample{ID: "video", Type: TypeYCbCr, Timestamp: 96000, Payload: frame(64, 48, 100)}))
+	// a new size restarts the encoding with a keyframe
+	assert.NoError(t, encoder.Write(&avp.Sample{ID: "video", Type: TypeYCbCr, Timestamp: 99000, Payload: frame(32, 24, 100)}))
+	encoder.Close()
+
+	var timestamps []uint32
+	var keyframes []bool
+	for _, sample := range encoded.samples {
+		assert.Equal(t, "video", sample.ID)
+		assert.Equal(t, avp.TypeVP8, sample.Type)
+		timestamps = append(timestamps, sample.Timestamp)
+		keyframes = append(keyframes, isKeyframe(avp.TypeVP8, sample.Payload.([]byte)))
+	}
+	assert.Equal(t, []uint32{90000, 93000, 96000, 99000}, timestamps)
+	assert.Equal(t, []bool{true, false, true, true}, keyframes)
+
+	// the frames decode to their size and luma
+	assert.Len(t, decoded.samples, 4)
+	for i, sample := range decoded.samples {
+		assert.Equal(t, TypeYCbCr, sample.Type)
+		assert.Equal(t, timestamps[i], sample.Timestamp)
+		img := sample.Payload.(*image.YCbCr)
+		size := image.Pt(64, 48)
+		if i == 3 {
+			size = image.Pt(32, 24)
+		}
+		assert.Equal(t, size, img.Rect.Size())
+		assert.InDelta(t, 100, img.Y[img.YOffset(img.Rect.Min.X+8, img.Rect.Min.Y+8)], 4)
+	}
+	assert.True(t, decoded.closed)
+}
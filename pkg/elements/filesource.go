@@ -0,0 +1,440 @@
+package elements
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/at-wat/ebml-go"
+	"github.com/at-wat/ebml-go/webm"
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+)
+
+const (
+	opusClockRate  = 48000
+	videoClockRate = 90000
+
+	oggPageHeaderLen = 27
+
+	webmDefaultTimecodeScale = uint64(time.Millisecond)
+)
+
+var (
+	errInvalidOggPage = errors.New("invalid ogg page")
+	webmMagic         = []byte{0x1a, 0x45, 0xdf, 0xa3}
+	ivfMagic          = []byte("DKIF")
+	oggMagic          = []byte("OggS")
+	opusHeadSignature = []byte("OpusHead")
+	opusTagsSignature = []byte("OpusTags")
+)
+
+// sampleReader returns the next sample of a file and its time
+// from the start of the file
+type sampleReader func() (*avp.Sample, time.Duration, error)
+
+// FileSourceConfig configures a FileSource
+type FileSourceConfig struct {
+	// Realtime paces the samples with their timestamps, otherwise
+	// they are written as fast as the elements accept them.
+	Realtime bool
+}
+
+// FileSource replays the samples of a webm, ivf or ogg file into its
+// attached elements, e.g. to reprocess recordings written by WebmSaver.
+// Sample timestamps use the rtp clock rate of the codec, as the samples
+// of a live track do.
+type FileSource struct {
+	Node
+	path   string
+	config FileSourceConfig
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// NewFileSource instance
+func NewFileSource(path string, config FileSourceConfig) *FileSource {
+	return &FileSource{
+		path:   path,
+		config: config,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Run writes the samples of the file to the attached elements until the
+// end of the file or until the source is closed. The attached elements
+// are closed when it returns.
+func (s *FileSource) Run() error {
+	defer s.Node.Close()
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	next, err := newSampleReader(bufio.NewReader(f), done)
+	if err != nil {
+		return err
+	}
+
+	var start time.Time
+	sequences := make(map[string]uint16)
+	for {
+		select {
+		case <-s.stop:
+			return nil
+		default:
+		}
+
+		sample, at, err := next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if s.config.Realtime {
+			if start.IsZero() {
+				start = time.Now().Add(-at)
+			}
+			if wait := time.Until(start.Add(at)); wait > 0 {
+				select {
+				case <-s.stop:
+					return nil
+				case <-time.After(wait):
+				}
+			}
+		}
+
+		sample.SequenceNumber = sequences[sample.ID]
+		sequences[sample.ID]++
+
+		if err := s.Node.Write(sample); err != nil {
+			log.Errorf("error writing sample: %s", err)
+		}
+	}
+}
+
+// Close stops the replay
+func (s *FileSource) Close() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+}
+
+// newSampleReader detects the container of the file, done is closed
+// when the file isn't read anymore
+func newSampleReader(r *bufio.Reader, done <-chan struct{}) (sampleReader, error) {
+	magic, err := r.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Equal(magic, webmMagic):
+		return newWebMReader(r, done), nil
+	case bytes.Equal(magic, ivfMagic):
+		return newIVFReader(r)
+	case bytes.Equal(magic, oggMagic):
+		return newOggReader(r), nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+type webmTrack struct {
+	id        string
+	typ       int
+	clockRate uint32
+	// h264 nal unit length size and parameter sets of the codec private data
+	lengthSize int
+	params     [][]byte
+}
+
+type webmBlock struct {
+	track webmTrack
+	at    time.Duration
+	data  []byte
+}
+
+// webmReader reads the blocks of a webm file cluster by cluster, so only
+// the cluster being replayed is held in memory.
+type webmReader struct {
+	stream struct {
+		Header  webm.EBMLHeader `ebml:"EBML"`
+		Segment struct {
+			Info    webm.Info         `ebml:"Info"`
+			Tracks  webm.Tracks       `ebml:"Tracks"`
+			Cluster chan webm.Cluster `ebml:"Cluster"`
+		} `ebml:"Segment"`
+	}
+	clusters chan webm.Cluster
+	errc     chan error
+	tracks   map[uint64]webmTrack
+	scale    uint64
+	blocks   []webmBlock
+}
+
+// newWebMReader decodes the file in the background. Once done is closed
+// the remaining clusters are dropped until the decoding fails on the
+// closed file.
+func newWebMReader(r io.Reader, done <-chan struct{}) sampleReader {
+	w := &webmReader{
+		clusters: make(chan webm.Cluster),
+		errc:     make(chan error, 1),
+	}
+	w.stream.Segment.Cluster = w.clusters
+
+	go func() {
+		err := ebml.Unmarshal(r, &w.stream, ebml.WithIgnoreUnknown(true))
+		close(w.clusters)
+		w.errc <- err
+		close(w.errc)
+	}()
+	go func() {
+		<-done
+		for range w.clusters {
+		}
+	}()
+	return w.next
+}
+
+func (w *webmReader) next() (*avp.Sample, time.Duration, error) {
+	for len(w.blocks) == 0 {
+		cluster, ok := <-w.clusters
+		if !ok {
+			if err := <-w.errc; err != nil {
+				return nil, 0, err
+			}
+			return nil, 0, io.EOF
+		}
+		if w.tracks == nil {
+			// the tracks precede the clusters
+			w.readTracks()
+		}
+		w.readCluster(cluster)
+	}
+
+	b := w.blocks[0]
+	w.blocks = w.blocks[1:]
+
+	data := b.data
+	if b.track.typ == avp.TypeH264 {
+		data = h264AnnexB(data, b.track.lengthSize, b.track.params)
+	}
+	return &avp.Sample{
+		ID:        b.track.id,
+		Type:      b.track.typ,
+		Timestamp: uint32(int64(b.at) * int64(b.track.clockRate) / int64(time.Second)),
+		Payload:   data,
+	}, b.at, nil
+}
+
+func (w *webmReader) readTracks() {
+	w.tracks = make(map[uint64]webmTrack)
+	for _, entry := range w.stream.Segment.Tracks.TrackEntry {
+		track := webmTrack{id: entry.Name, clockRate: videoClockRate}
+		switch entry.CodecID {
+		case "A_OPUS":
+			track.typ, track.clockRate = avp.TypeOpus, opusClockRate
+		case "V_VP8":
+			track.typ = avp.TypeVP8
+		case "V_VP9":
+			track.typ = avp.TypeVP9
+		case "V_MPEG4/ISO/AVC":
+			track.typ = avp.TypeH264
+			track.lengthSize, track.params = avccParameterSets(entry.CodecPrivate)
+		case "V_AV1":
+			track.typ = avp.TypeAV1
+		default:
+			log.Debugf("skipping webm track %d with codec %s", entry.TrackNumber, entry.CodecID)
+			continue
+		}
+		if track.id == "" {
+			track.id = "video"
+			if track.typ == avp.TypeOpus {
+				track.id = "audio"
+			}
+		}
+		w.tracks[entry.TrackNumber] = track
+	}
+
+	w.scale = w.stream.Segment.Info.TimecodeScale
+	if w.scale == 0 {
+		w.scale = webmDefaultTimecodeScale
+	}
+}
+
+func (w *webmReader) readCluster(cluster webm.Cluster) {
+	blocks := cluster.SimpleBlock
+	for _, group := range cluster.BlockGroup {
+		blocks = append(blocks, group.Block)
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].Timecode < blocks[j].Timecode
+	})
+
+	for _, b := range blocks {
+		track, ok := w.tracks[b.TrackNumber]
+		if !ok {
+			continue
+		}
+		at := time.Duration((int64(cluster.Timecode) + int64(b.Timecode)) * int64(w.scale))
+		for _, data := range b.Data {
+			w.blocks = append(w.blocks, webmBlock{track: track, at: at, data: data})
+		}
+	}
+}
+
+func newIVFReader(r io.Reader) (sampleReader, error) {
+	reader, header, err := ivfreader.NewWith(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var typ int
+	switch header.FourCC {
+	case "VP80":
+		typ = avp.TypeVP8
+	case "VP90":
+		typ = avp.TypeVP9
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	return func() (*avp.Sample, time.Duration, error) {
+		frame, frameHeader, err := reader.ParseNextFrame()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		ticks := frameHeader.Timestamp * uint64(header.TimebaseNumerator)
+		den := uint64(header.TimebaseDenominator)
+		return &avp.Sample{
+			ID:        "video",
+			Type:      typ,
+			Timestamp: uint32(ticks * videoClockRate / den),
+			Payload:   frame,
+		}, time.Duration(ticks * uint64(time.Second) / den), nil
+	}, nil
+}
+
+// oggReader reads the opus packets of an ogg file. Unlike the pion ogg
+// reader it splits the pages in packets.
+type oggReader struct {
+	r         io.Reader
+	packets   [][]byte
+	partial   []byte
+	timestamp uint32 // in 48khz samples
+	started   bool
+}
+
+func newOggReader(r io.Reader) sampleReader {
+	o := &oggReader{r: r}
+	return o.next
+}
+
+func (o *oggReader) next() (*avp.Sample, time.Duration, error) {
+	for {
+		for len(o.packets) > 0 {
+			packet := o.packets[0]
+			o.packets = o.packets[1:]
+
+			if !o.started {
+				if !bytes.HasPrefix(packet, opusHeadSignature) {
+					return nil, 0, ErrUnsupportedFormat
+				}
+				o.started = true
+				continue
+			}
+			if bytes.HasPrefix(packet, opusTagsSignature) {
+				continue
+			}
+
+			timestamp := o.timestamp
+			o.timestamp += opusPacketDuration(packet)
+			return &avp.Sample{
+				ID:        "audio",
+				Type:      avp.TypeOpus,
+				Timestamp: timestamp,
+				Payload:   packet,
+			}, time.Duration(timestamp) * time.Second / opusClockRate, nil
+		}
+
+		if err := o.readPage(); err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+func (o *oggReader) readPage() error {
+	header := make([]byte, oggPageHeaderLen)
+	if _, err := io.ReadFull(o.r, header); err != nil {
+		return err
+	}
+	if !bytes.Equal(header[:4], oggMagic) {
+		return errInvalidOggPage
+	}
+
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(o.r, segments); err != nil {
+		return err
+	}
+
+	for _, size := range segments {
+		segment := make([]byte, size)
+		if _, err := io.ReadFull(o.r, segment); err != nil {
+			return err
+		}
+		o.partial = append(o.partial, segment...)
+
+		// a packet continues in the next segment when a segment is full
+		if size < 255 {
+			o.packets = append(o.packets, o.partial)
+			o.partial = nil
+		}
+	}
+	return nil
+}
+
+// opusPacketDuration returns the duration of an opus packet in 48khz
+// samples from its toc byte
+func opusPacketDuration(packet []byte) uint32 {
+	if len(packet) == 0 {
+		return 0
+	}
+
+	config := packet[0] >> 3
+	var frameSize uint32
+	switch {
+	case config < 12:
+		// silk 10, 20, 40 or 60ms
+		frameSize = []uint32{480, 960, 1920, 2880}[config%4]
+	case config < 16:
+		// hybrid 10 or 20ms
+		frameSize = []uint32{480, 960}[config%2]
+	default:
+		// celt 2.5, 5, 10 or 20ms
+		frameSize = []uint32{120, 240, 480, 960}[config%4]
+	}
+
+	frames := uint32(1)
+	switch packet[0] & 0x3 {
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0
+		}
+		frames = uint32(packet[1] & 0x3f)
+	}
+	return frameSize * frames
+}
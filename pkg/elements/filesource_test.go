@@ -0,0 +1,221 @@
+package elements
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// sampleCollector collects the samples written to it
+type sampleCollector struct {
+	sync.Mutex
+	samples []*avp.Sample
+	closed  bool
+}
+
+func (c *sampleCollector) Write(sample *avp.Sample) error {
+	c.Lock()
+	defer c.Unlock()
+	c.samples = append(c.samples, sample)
+	return nil
+}
+func (c *sampleCollector) Attach(e avp.Element) {}
+func (c *sampleCollector) Close() {
+	c.Lock()
+	defer c.Unlock()
+	c.closed = true
+}
+
+func writeTempFile(t *testing.T, name string, data []byte) string {
+	dir, err := ioutil.TempDir("", "filesource")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	path := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(path, data, 0600))
+	return path
+}
+
+func runFileSource(t *testing.T, path string) *sampleCollector {
+	collector := &sampleCollector{}
+	source := NewFileSource(path, FileSourceConfig{})
+	source.Attach(collector)
+	assert.NoError(t, source.Run())
+	assert.True(t, collector.closed)
+	return collector
+}
+
+func TestFileSource_WebM(t *testing.T) {
+	saver := NewWebmSaver()
+	writer := NewBufWriter()
+	saver.Attach(writer)
+
+	for i := uint32(0); i < 3; i++ {
+		assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeVP8, Timestamp: 90000 + i*3000, Payload: rawKeyframePkt}))
+		assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeOpus, Timestamp: 48000 + i*960, Payload: rawOpusPkt}))
+	}
+	saver.Close()
+
+	collector := runFileSource(t, writeTempFile(t, "test.webm", writer.buf.Bytes()))
+
+	var audio, video []*avp.Sample
+	for _, s := range collector.samples {
+		switch s.Type {
+		case avp.TypeOpus:
+			audio = append(audio, s)
+		case avp.TypeVP8:
+			video = append(video, s)
+		}
+	}
+	assert.Len(t, audio, 3)
+	assert.Len(t, video, 3)
+	assert.Equal(t, "Audio", audio[0].ID)
+	assert.Equal(t, rawOpusPkt, audio[0].Payload)
+	assert.Equal(t, uint32(960), audio[1].Timestamp-audio[0].Timestamp)
+	assert.Equal(t, uint16(2), audio[2].SequenceNumber)
+	assert.Equal(t, "Video", video[0].ID)
+	assert.Equal(t, rawKeyframePkt, video[0].Payload)
+	assert.Equal(t, uint32(2970), video[1].Timestamp-video[0].Timestamp) // millisecond precision
+}
+
+func TestFileSource_WebMH264(t *testing.T) {
+	saver := NewWebmSaver()
+	writer := NewBufWriter()
+	saver.Attach(writer)
+
+	frames := [][]byte{
+		annexB(rawH264SPS, rawH264PPS, rawH264IDR),
+		annexB(rawH264P),
+		annexB(rawH264P),
+	}
+	for i, frame := range frames {
+		assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeH264, Timestamp: 90000 + uint32(i)*3000, Payload: frame}))
+		assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeOpus, Timestamp: 48000 + uint32(i)*960, Payload: rawOpusPkt}))
+	}
+	saver.Close()
+
+	collector := runFileSource(t, writeTempFile(t, "test.mkv", writer.buf.Bytes()))
+
+	var video [][]byte
+	for _, s := range collector.samples {
+		if s.Type == avp.TypeH264 {
+			video = append(video, s.Payload.([]byte))
+		}
+	}
+	// the length prefixed nal units are replayed as annex b
+	assert.Equal(t, frames, video)
+}
+
+func TestH264AnnexB(t *testing.T) {
+	avcc := mp4Avcc(rawH264SPS, rawH264PPS, h264SPS{profile: 66, compatibility: 0xc0, level: 30})[8:]
+	lengthSize, params := avccParameterSets(avcc)
+	assert.Equal(t, 4, lengthSize)
+	assert.Equal(t, [][]byte{rawH264SPS, rawH264PPS}, params)
+
+	// parameter sets of the codec private data are added to idr frames
+	assert.Equal(t, annexB(rawH264SPS, rawH264PPS, rawH264IDR), h264AnnexB(mp4SampleData(avp.TypeH264, annexB(rawH264IDR)), lengthSize, params))
+	assert.Equal(t, annexB(rawH264P), h264AnnexB(mp4SampleData(avp.TypeH264, annexB(rawH264P)), lengthSize, params))
+}
+
+func TestFileSource_IVF(t *testing.T) {
+	buf := &bytes.Buffer{}
+	header := make([]byte, 32)
+	copy(header, "DKIF")
+	binary.LittleEndian.PutUint16(header[6:], 32)
+	copy(header[8:], "VP80")
+	binary.LittleEndian.PutUint32(header[16:], 30) // timebase denominator
+	binary.LittleEndian.PutUint32(header[20:], 1)  // timebase numerator
+	binary.LittleEndian.PutUint32(header[24:], 2)
+	buf.Write(header)
+	for i := uint64(0); i < 2; i++ {
+		frame := make([]byte, 12)
+		binary.LittleEndian.PutUint32(frame, uint32(len(rawKeyframePkt)))
+		binary.LittleEndian.PutUint64(frame[4:], i)
+		buf.Write(frame)
+		buf.Write(rawKeyframePkt)
+	}
+
+	collector := runFileSource(t, writeTempFile(t, "test.ivf", buf.Bytes()))
+	assert.Len(t, collector.samples, 2)
+	assert.Equal(t, avp.TypeVP8, collector.samples[0].Type)
+	assert.Equal(t, rawKeyframePkt, collector.samples[0].Payload)
+	assert.Equal(t, uint32(3000), collector.samples[1].Timestamp)
+}
+
+// oggPage builds an ogg page with the packets, without checksum
+func oggPage(packets ...[]byte) []byte {
+	var segments, data []byte
+	for _, p := range packets {
+		n := len(p)
+		for ; n >= 255; n -= 255 {
+			segments = append(segments, 255)
+		}
+		segments = append(segments, byte(n))
+		data = append(data, p...)
+	}
+
+	header := make([]byte, 27)
+	copy(header, "OggS")
+	header[26] = byte(len(segments))
+	return append(append(header, segments...), data...)
+}
+
+func TestFileSource_Ogg(t *testing.T) {
+	opusHead := append([]byte("OpusHead"), 1, 2, 0, 0, 0x80, 0xbb, 0, 0, 0, 0, 0)
+	// celt 20ms and a two frames 20ms packet of 300 bytes
+	single := []byte{0xf8, 0x01, 0x02}
+	double := append([]byte{0xf9}, make([]byte, 299)...)
+
+	var buf []byte
+	buf = append(buf, oggPage(opusHead)...)
+	buf = append(buf, oggPage([]byte("OpusTags"))...)
+	buf = append(buf, oggPage(single, double, single)...)
+
+	collector := runFileSource(t, writeTempFile(t, "test.ogg", buf))
+	assert.Len(t, collector.samples, 3)
+	assert.Equal(t, single, collector.samples[0].Payload)
+	assert.Equal(t, double, collector.samples[1].Payload)
+	assert.Equal(t, uint32(960), collector.samples[1].Timestamp)
+	assert.Equal(t, uint32(2880), collector.samples[2].Timestamp)
+	assert.Equal(t, "audio", collector.samples[2].ID)
+}
+
+func TestFileSource_Realtime(t *testing.T) {
+	opusHead := append([]byte("OpusHead"), 1, 2, 0, 0, 0x80, 0xbb, 0, 0, 0, 0, 0)
+	packet := []byte{0xf8, 0x01, 0x02}
+
+	buf := oggPage(opusHead)
+	for i := 0; i < 10; i++ {
+		buf = append(buf, oggPage(packet)...)
+	}
+	path := writeTempFile(t, "test.ogg", buf)
+
+	collector := &sampleCollector{}
+	source := NewFileSource(path, FileSourceConfig{Realtime: true})
+	source.Attach(collector)
+
+	start := time.Now()
+	assert.NoError(t, source.Run())
+	assert.Len(t, collector.samples, 10)
+	assert.True(t, time.Since(start) >= 180*time.Millisecond)
+
+	// closing stops the replay
+	source = NewFileSource(path, FileSourceConfig{Realtime: true})
+	source.Close()
+	assert.NoError(t, source.Run())
+}
+
+func TestFileSource_Unsupported(t *testing.T) {
+	source := NewFileSource(writeTempFile(t, "test.bin", []byte("not a media file")), FileSourceConfig{})
+	assert.Equal(t, ErrUnsupportedFormat, source.Run())
+}
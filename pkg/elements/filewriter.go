@@ -12,6 +12,7 @@ import (
 // FileWriter instance
 type FileWriter struct {
 	Leaf
+	f  *os.File
 	wr io.Writer
 }
 
@@ -25,7 +26,7 @@ func NewFileWriter(path string, bufSize int) *FileWriter {
 		return nil
 	}
 
-	fw := &FileWriter{}
+	fw := &FileWriter{f: f}
 	if bufSize > 0 {
 		fw.wr = bufio.NewWriterSize(f, bufSize)
 	} else {
@@ -35,16 +36,32 @@ func NewFileWriter(path string, bufSize int) *FileWriter {
 }
 
 func (w *FileWriter) Write(sample *avp.Sample) error {
-	_, err := w.wr.Write(sample.Payload.([]byte))
+	if patch, ok := sample.Payload.(Patch); ok {
+		// flush the buffered data before overwriting it
+		if c, ok := w.wr.(*bufio.Writer); ok {
+			if err := c.Flush(); err != nil {
+				return err
+			}
+		}
+		_, err := w.f.WriteAt(patch.Data, patch.Offset)
+		return err
+	}
+
+	payload, ok := sample.Payload.([]byte)
+	if !ok {
+		return ErrUnsupportedPayload
+	}
+	_, err := w.wr.Write(payload)
 	return err
 }
 
 func (w *FileWriter) Close() {
 	if c, ok := w.wr.(*bufio.Writer); ok {
-		c.Flush()
-		return
+		if err := c.Flush(); err != nil {
+			log.Errorf("error flushing filewriter: %s", err)
+		}
 	}
-	if c, ok := w.wr.(io.Closer); ok {
-		c.Close()
+	if err := w.f.Close(); err != nil {
+		log.Errorf("error closing filewriter: %s", err)
 	}
 }
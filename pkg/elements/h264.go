@@ -0,0 +1,284 @@
+package elements
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// h264 nal unit types
+const (
+	h264NALUIDR = 5
+	h264NALUSPS = 7
+	h264NALUPPS = 8
+	h264NALUAUD = 9
+)
+
+var annexBStartCode = []byte{0x00, 0x00, 0x01}
+
+// h264SPS holds the fields of a sequence parameter set the muxers need
+type h264SPS struct {
+	profile       uint8
+	compatibility uint8
+	level         uint8
+	chromaFormat  uint32
+	bitDepthLuma  uint32
+	bitDepthCroma uint32
+	width         int
+	height        int
+}
+
+// splitAnnexB returns the nal units of an annex b access unit. A
+// payload without start code is a single nal unit.
+func splitAnnexB(payload []byte) [][]byte {
+	var nalus [][]byte
+	for {
+		start := bytes.Index(payload, annexBStartCode)
+		if start < 0 {
+			if len(payload) > 0 {
+				nalus = append(nalus, payload)
+			}
+			return nalus
+		}
+
+		// trailing zero of a 4 byte start code
+		end := start
+		if end > 0 && payload[end-1] == 0 {
+			end--
+		}
+		if end > 0 {
+			nalus = append(nalus, payload[:end])
+		}
+		payload = payload[start+len(annexBStartCode):]
+	}
+}
+
+// h264ParameterSets returns the first sps and pps of an access unit
+func h264ParameterSets(nalus [][]byte) (sps, pps []byte) {
+	for _, nalu := range nalus {
+		switch nalu[0] & 0x1f {
+		case h264NALUSPS:
+			if sps == nil {
+				sps = nalu
+			}
+		case h264NALUPPS:
+			if pps == nil {
+				pps = nalu
+			}
+		}
+	}
+	return sps, pps
+}
+
+// unescapeRBSP removes the emulation prevention bytes of a nal unit
+func unescapeRBSP(nalu []byte) []byte {
+	rbsp := make([]byte, 0, len(nalu))
+	zeros := 0
+	for _, b := range nalu {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, b)
+	}
+	return rbsp
+}
+
+func (r *bitReader) readUE() (uint32, bool) {
+	zeros := 0
+	for {
+		bit, ok := r.read(1)
+		if !ok || zeros > 31 {
+			return 0, false
+		}
+		if bit == 1 {
+			break
+		}
+		zeros++
+	}
+	v, ok := r.read(zeros)
+	return (1 << uint(zeros)) - 1 + v, ok
+}
+
+func (r *bitReader) readSE() (int32, bool) {
+	v, ok := r.readUE()
+	if v&0x1 == 1 {
+		return int32(v+1) / 2, ok
+	}
+	return -int32(v / 2), ok
+}
+
+func (r *bitReader) skipScalingList(size int) {
+	last, next := int32(8), int32(8)
+	for i := 0; i < size; i++ {
+		if next != 0 {
+			delta, _ := r.readSE()
+			next = (last + delta + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+// parseH264SPS parses the dimensions and format of a sequence parameter set
+func parseH264SPS(nalu []byte) (h264SPS, bool) {
+	rbsp := unescapeRBSP(nalu)
+	if len(rbsp) < 4 {
+		return h264SPS{}, false
+	}
+
+	sps := h264SPS{
+		profile:       rbsp[1],
+		compatibility: rbsp[2],
+		level:         rbsp[3],
+		chromaFormat:  1,
+	}
+	r := &bitReader{data: rbsp[4:]}
+	r.readUE() // seq_parameter_set_id
+
+	switch sps.profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		sps.chromaFormat, _ = r.readUE()
+		if sps.chromaFormat == 3 {
+			r.read(1) // separate_colour_plane_flag
+		}
+		sps.bitDepthLuma, _ = r.readUE()
+		sps.bitDepthCroma, _ = r.readUE()
+		r.read(1) // qpprime_y_zero_transform_bypass_flag
+		if present, _ := r.read(1); present == 1 {
+			lists := 8
+			if sps.chromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if listPresent, _ := r.read(1); listPresent == 1 {
+					if i < 6 {
+						r.skipScalingList(16)
+					} else {
+						r.skipScalingList(64)
+					}
+				}
+			}
+		}
+	}
+
+	r.readUE() // log2_max_frame_num_minus4
+	pocType, _ := r.readUE()
+	switch pocType {
+	case 0:
+		r.readUE() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.read(1)  // delta_pic_order_always_zero_flag
+		r.readSE() // offset_for_non_ref_pic
+		r.readSE() // offset_for_top_to_bottom_field
+		cycle, _ := r.readUE()
+		for i := uint32(0); i < cycle; i++ {
+			r.readSE()
+		}
+	}
+	r.readUE() // max_num_ref_frames
+	r.read(1)  // gaps_in_frame_num_value_allowed_flag
+
+	widthMbs, _ := r.readUE()
+	heightMapUnits, _ := r.readUE()
+	frameMbsOnly, _ := r.read(1)
+	if frameMbsOnly == 0 {
+		r.read(1) // mb_adaptive_frame_field_flag
+	}
+	r.read(1) // direct_8x8_inference_flag
+
+	var cropLeft, cropRight, cropTop, cropBottom uint32
+	if cropping, _ := r.read(1); cropping == 1 {
+		cropLeft, _ = r.readUE()
+		cropRight, _ = r.readUE()
+		cropTop, _ = r.readUE()
+		cropBottom, _ = r.readUE()
+	}
+	cropX, cropY := uint32(1), 2-frameMbsOnly
+	if sps.chromaFormat == 1 {
+		cropX, cropY = 2, 2*(2-frameMbsOnly)
+	} else if sps.chromaFormat == 2 {
+		cropX = 2
+	}
+
+	width := (widthMbs+1)*16 - (cropLeft+cropRight)*cropX
+	height := (2-frameMbsOnly)*(heightMapUnits+1)*16 - (cropTop+cropBottom)*cropY
+	if r.overrun || int32(width) <= 0 || int32(height) <= 0 {
+		return h264SPS{}, false
+	}
+	sps.width, sps.height = int(width), int(height)
+	return sps, true
+}
+
+// avccParameterSets returns the nal unit length size and the sps and pps
+// of an avc decoder configuration
+func avccParameterSets(avcc []byte) (int, [][]byte) {
+	if len(avcc) < 6 {
+		return 4, nil
+	}
+	lengthSize := int(avcc[4]&0x3) + 1
+
+	var sets [][]byte
+	data := avcc[5:]
+	// sps count in the low 5 bits, then the pps count
+	for _, mask := range []byte{0x1f, 0xff} {
+		if len(data) < 1 {
+			break
+		}
+		count := int(data[0] & mask)
+		data = data[1:]
+		for i := 0; i < count; i++ {
+			if len(data) < 2 {
+				return lengthSize, sets
+			}
+			size := int(binary.BigEndian.Uint16(data))
+			if len(data) < 2+size {
+				return lengthSize, sets
+			}
+			sets = append(sets, data[2:2+size])
+			data = data[2+size:]
+		}
+	}
+	return lengthSize, sets
+}
+
+// h264AnnexB converts length prefixed nal units to an annex b access
+// unit. The parameter sets are prepended to idr access units without them.
+func h264AnnexB(data []byte, lengthSize int, params [][]byte) []byte {
+	var nalus [][]byte
+	hasIDR, hasSPS := false, false
+	for len(data) > lengthSize {
+		size := 0
+		for _, b := range data[:lengthSize] {
+			size = size<<8 | int(b)
+		}
+		data = data[lengthSize:]
+		if size == 0 || size > len(data) {
+			break
+		}
+		nalu := data[:size]
+		data = data[size:]
+
+		switch nalu[0] & 0x1f {
+		case h264NALUIDR:
+			hasIDR = true
+		case h264NALUSPS:
+			hasSPS = true
+		}
+		nalus = append(nalus, nalu)
+	}
+	if hasIDR && !hasSPS {
+		nalus = append(append([][]byte{}, params...), nalus...)
+	}
+
+	var b []byte
+	for _, nalu := range nalus {
+		b = append(append(b, 0x00, 0x00, 0x00, 0x01), nalu...)
+	}
+	return b
+}
@@ -0,0 +1,143 @@
+package elements
+
+import (
+	"encoding/binary"
+	"sync"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+)
+
+const (
+	ivfHeaderSize      = 32
+	ivfFrameHeaderSize = 12
+	ivfFrameCountAt    = 24
+)
+
+// IVFWriterConfig configures an IVFWriter
+type IVFWriterConfig struct {
+	// ClockRate of the sample timestamps, used as ivf timebase.
+	// Defaults to 90000.
+	ClockRate uint32
+}
+
+// IVFWriter writes the vp8 or vp9 samples of a track as an ivf stream.
+// Frames are dropped until the first keyframe, which sets the codec and
+// dimensions of the header. The frame count of the header is patched
+// on close.
+type IVFWriter struct {
+	Node
+	mu        sync.Mutex
+	config    IVFWriterConfig
+	typ       int
+	timestamp uint32
+	elapsed   uint64
+	frames    uint32
+	closed    bool
+}
+
+// NewIVFWriter instance
+func NewIVFWriter(config IVFWriterConfig) *IVFWriter {
+	if config.ClockRate == 0 {
+		config.ClockRate = videoClockRate
+	}
+	return &IVFWriter{
+		config: config,
+	}
+}
+
+func (w *IVFWriter) Write(sample *avp.Sample) error {
+	if sample.Type != avp.TypeVP8 && sample.Type != avp.TypeVP9 {
+		return nil
+	}
+	payload, ok := sample.Payload.([]byte)
+	if !ok {
+		return ErrUnsupportedPayload
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+
+	if w.typ == 0 {
+		width, height, ok := frameSize(sample.Type, payload)
+		if !ok {
+			// wait for a keyframe
+			return nil
+		}
+		w.typ = sample.Type
+		w.timestamp = sample.Timestamp
+		log.Infof("IVF writer has started with video width=%d, height=%d", width, height)
+		if err := w.writeHeader(width, height); err != nil {
+			return err
+		}
+	} else if sample.Type != w.typ {
+		log.Warnf("IVF writer dropped sample of another codec: %d", sample.Type)
+		return nil
+	}
+
+	// rtp timestamps wrap around
+	w.elapsed += uint64(sample.Timestamp - w.timestamp)
+	w.timestamp = sample.Timestamp
+
+	frame := make([]byte, ivfFrameHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:], uint32(len(payload)))
+	binary.LittleEndian.PutUint64(frame[4:], w.elapsed)
+	copy(frame[ivfFrameHeaderSize:], payload)
+	w.frames++
+
+	return w.Node.Write(&avp.Sample{
+		ID:        sample.ID,
+		Type:      TypeBinary,
+		Timestamp: sample.Timestamp,
+		Payload:   frame,
+	})
+}
+
+func (w *IVFWriter) writeHeader(width, height int) error {
+	header := make([]byte, ivfHeaderSize)
+	copy(header[0:], ivfMagic)
+	binary.LittleEndian.PutUint16(header[4:], 0) // version
+	binary.LittleEndian.PutUint16(header[6:], ivfHeaderSize)
+	if w.typ == avp.TypeVP9 {
+		copy(header[8:], "VP90")
+	} else {
+		copy(header[8:], "VP80")
+	}
+	binary.LittleEndian.PutUint16(header[12:], uint16(width))
+	binary.LittleEndian.PutUint16(header[14:], uint16(height))
+	binary.LittleEndian.PutUint32(header[16:], w.config.ClockRate) // timebase denominator
+	binary.LittleEndian.PutUint32(header[20:], 1)                  // timebase numerator
+
+	return w.Node.Write(&avp.Sample{
+		Type:    TypeBinary,
+		Payload: header,
+	})
+}
+
+// Close patches the frame count of the header and closes the children
+func (w *IVFWriter) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+
+	if w.typ != 0 {
+		count := make([]byte, 4)
+		binary.LittleEndian.PutUint32(count, w.frames)
+		if err := w.Node.Write(&avp.Sample{
+			Type:    TypePatch,
+			Payload: Patch{Offset: ivfFrameCountAt, Data: count},
+		}); err != nil {
+			log.Errorf("ivf frame count patch err: %s", err)
+		}
+	}
+	w.mu.Unlock()
+
+	w.Node.Close()
+}
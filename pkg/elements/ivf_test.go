@@ -0,0 +1,75 @@
+package elements
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+	"github.com/stretchr/testify/assert"
+)
+
+// VP8 and VP9 keyframe headers of a 640x480 frame
+var rawVP8KeyframePkt = []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02, 0xe0, 0x01}
+var rawVP9KeyframePkt = []byte{0x82, 0x49, 0x83, 0x42, 0x20, 0x27, 0xf0, 0x1d, 0xf0}
+
+func TestFrameSize(t *testing.T) {
+	width, height, ok := frameSize(avp.TypeVP8, rawVP8KeyframePkt)
+	assert.True(t, ok)
+	assert.Equal(t, 640, width)
+	assert.Equal(t, 480, height)
+
+	width, height, ok = frameSize(avp.TypeVP9, rawVP9KeyframePkt)
+	assert.True(t, ok)
+	assert.Equal(t, 640, width)
+	assert.Equal(t, 480, height)
+
+	// inter frames
+	assert.False(t, isKeyframe(avp.TypeVP8, []byte{0x01, 0x00}))
+	assert.False(t, isKeyframe(avp.TypeVP9, []byte{0x86, 0x00}))
+}
+
+func TestIVFWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.ivf")
+	writer := NewIVFWriter(IVFWriterConfig{})
+	writer.Attach(NewFileWriter(path, 1024))
+
+	// dropped until the first keyframe
+	assert.NoError(t, writer.Write(&avp.Sample{Type: avp.TypeVP9, Timestamp: 100, Payload: []byte{0x86, 0x00}}))
+	// other codecs are ignored
+	assert.NoError(t, writer.Write(&avp.Sample{Type: avp.TypeOpus, Timestamp: 100, Payload: rawOpusPkt}))
+
+	timestamps := []uint32{4294964296, 0, 3000}
+	for i, ts := range timestamps {
+		payload := []byte{0x86, byte(i)}
+		if i == 0 {
+			payload = rawVP9KeyframePkt
+		}
+		assert.NoError(t, writer.Write(&avp.Sample{Type: avp.TypeVP9, Timestamp: ts, Payload: payload}))
+	}
+	writer.Close()
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	reader, header, err := ivfreader.NewWith(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "VP90", header.FourCC)
+	assert.Equal(t, uint16(640), header.Width)
+	assert.Equal(t, uint16(480), header.Height)
+	assert.Equal(t, uint32(videoClockRate), header.TimebaseDenominator)
+	assert.Equal(t, uint32(1), header.TimebaseNumerator)
+	assert.Equal(t, uint32(3), header.NumFrames)
+
+	// timestamps are unwrapped from the first frame
+	for _, ts := range []uint64{0, 3000, 6000} {
+		frame, frameHeader, err := reader.ParseNextFrame()
+		assert.NoError(t, err)
+		assert.Equal(t, ts, frameHeader.Timestamp)
+		assert.Equal(t, int(frameHeader.FrameSize), len(frame))
+	}
+	_, _, err = reader.ParseNextFrame()
+	assert.Error(t, err)
+}
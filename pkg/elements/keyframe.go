@@ -0,0 +1,134 @@
+package elements
+
+import (
+	avp "github.com/pion/ion-avp/pkg"
+)
+
+const vp9SyncCode = 0x498342
+
+// bitReader reads the big endian bits of a frame header
+type bitReader struct {
+	data    []byte
+	pos     int
+	overrun bool // set when reading past the end of the data
+}
+
+func (r *bitReader) read(n int) (uint32, bool) {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.overrun = true
+			return 0, false
+		}
+		bit := r.data[r.pos/8] >> (7 - uint(r.pos%8)) & 0x1
+		v = v<<1 | uint32(bit)
+		r.pos++
+	}
+	return v, true
+}
+
+// isKeyframe returns true when the payload of a video sample is a keyframe
+func isKeyframe(typ int, payload []byte) bool {
+	switch typ {
+	case avp.TypeVP8:
+		return len(payload) > 0 && payload[0]&0x1 == 0
+	case avp.TypeVP9:
+		_, _, ok := vp9KeyframeSize(payload)
+		return ok
+	case avp.TypeH264:
+		for _, nalu := range splitAnnexB(payload) {
+			if nalu[0]&0x1f == h264NALUIDR {
+				return true
+			}
+		}
+	case avp.TypeAV1:
+		// encoders repeat the sequence header on keyframes
+		obus, ok := splitAV1OBUs(payload)
+		if ok {
+			_, ok = av1SequenceHeaderOBU(obus)
+		}
+		return ok
+	}
+	return false
+}
+
+// frameSize returns the dimensions of a keyframe
+func frameSize(typ int, payload []byte) (width, height int, ok bool) {
+	switch typ {
+	case avp.TypeVP8:
+		if len(payload) < 10 || payload[0]&0x1 != 0 {
+			return 0, 0, false
+		}
+		raw := uint(payload[6]) | uint(payload[7])<<8 | uint(payload[8])<<16 | uint(payload[9])<<24
+		return int(raw & 0x3FFF), int((raw >> 16) & 0x3FFF), true
+	case avp.TypeVP9:
+		return vp9KeyframeSize(payload)
+	case avp.TypeH264:
+		if !isKeyframe(typ, payload) {
+			return 0, 0, false
+		}
+		if sps, _ := h264ParameterSets(splitAnnexB(payload)); sps != nil {
+			if parsed, ok := parseH264SPS(sps); ok {
+				return parsed.width, parsed.height, true
+			}
+		}
+	case avp.TypeAV1:
+		if obus, ok := splitAV1OBUs(payload); ok {
+			if obu, ok := av1SequenceHeaderOBU(obus); ok {
+				if h, ok := parseAV1SequenceHeader(obu.body); ok {
+					return h.width, h.height, true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// vp9KeyframeSize parses the uncompressed header of a vp9 keyframe
+func vp9KeyframeSize(payload []byte) (width, height int, ok bool) {
+	r := &bitReader{data: payload}
+
+	if marker, ok := r.read(2); !ok || marker != 0x2 {
+		return 0, 0, false
+	}
+	low, _ := r.read(1)
+	high, _ := r.read(1)
+	profile := high<<1 | low
+	if profile == 3 {
+		r.read(1) // reserved
+	}
+	if showExisting, ok := r.read(1); !ok || showExisting == 1 {
+		return 0, 0, false
+	}
+	if frameType, ok := r.read(1); !ok || frameType != 0 {
+		return 0, 0, false
+	}
+	r.read(2) // show_frame, error_resilient_mode
+	if sync, ok := r.read(24); !ok || sync != vp9SyncCode {
+		return 0, 0, false
+	}
+
+	// color config
+	if profile >= 2 {
+		r.read(1) // ten_or_twelve_bit
+	}
+	colorSpace, _ := r.read(3)
+	if colorSpace != 7 { // not sRGB
+		r.read(1) // color_range
+		if profile == 1 || profile == 3 {
+			r.read(3) // subsampling_x, subsampling_y, reserved
+		}
+	} else if profile == 1 || profile == 3 {
+		r.read(1) // reserved
+	}
+
+	w, ok := r.read(16)
+	if !ok {
+		return 0, 0, false
+	}
+	h, ok := r.read(16)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(w) + 1, int(h) + 1, true
+}
@@ -0,0 +1,336 @@
+package elements
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+)
+
+const (
+	defaultMixerID            = "mix"
+	defaultMixerSampleRate    = 48000
+	defaultMixerChannels      = 2
+	defaultMixerFrameDuration = 20 * time.Millisecond
+	defaultMixerDelay         = 100 * time.Millisecond
+
+	// inputs without samples for this long are removed
+	mixerInputTimeout = 10 * time.Second
+	// inputs further ahead of the output are resynchronized
+	mixerMaxBuffer = 2 * time.Second
+	// gain recovery of the limiter per frame
+	mixerLimiterRelease = 1.02
+)
+
+// MixerConfig configures a Mixer
+type MixerConfig struct {
+	// ID of the mixed samples. Defaults to mix.
+	ID string
+	// SampleRate and Channels of the mix, inputs must have the sample
+	// rate. Default to 48000 and 2.
+	SampleRate int
+	Channels   int
+	// FrameDuration of the mixed samples. Defaults to 20ms.
+	FrameDuration time.Duration
+	// Delay of the mix to the first sample of an input, late samples
+	// within the delay are mixed. Defaults to 100ms.
+	Delay time.Duration
+}
+
+type mixerInput struct {
+	gain    float64
+	started bool
+	origin  int64  // timeline position of the first sample
+	elapsed int64  // unwrapped timestamp from the first sample
+	last    uint32 // timestamp of the last sample
+	start   int64  // timeline position of buf
+	buf     []int16
+	updated time.Time
+	warned  bool
+}
+
+// Mixer instance
+type Mixer struct {
+	Node
+	mu       sync.Mutex
+	config   MixerConfig
+	inputs   map[string]*mixerInput
+	position int64   // timeline position of the next frame
+	gain     float64 // limiter gain
+	running  bool
+	closed   bool
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewMixer instance. Mixer mixes the PCM samples of its inputs, the
+// tracks of the samples written to it or the inputs it returns, and
+// writes PCM samples of the mix every frame duration, silent when no
+// input has samples. The first sample of an input is mixed after the
+// delay, later samples are aligned with their timestamps.
+func NewMixer(config MixerConfig) *Mixer {
+	if config.ID == "" {
+		config.ID = defaultMixerID
+	}
+	if config.SampleRate == 0 {
+		config.SampleRate = defaultMixerSampleRate
+	}
+	if config.Channels == 0 {
+		config.Channels = defaultMixerChannels
+	}
+	if config.FrameDuration == 0 {
+		config.FrameDuration = defaultMixerFrameDuration
+	}
+	if config.Delay == 0 {
+		config.Delay = defaultMixerDelay
+	}
+	return &Mixer{
+		config: config,
+		inputs: make(map[string]*mixerInput),
+		gain:   1,
+		done:   make(chan struct{}),
+	}
+}
+
+// MixerInput is an input of a Mixer
+type MixerInput struct {
+	Leaf
+	m      *Mixer
+	id     string
+	closed bool // guarded by the lock of the mixer
+}
+
+func (i *MixerInput) Write(sample *avp.Sample) error {
+	i.m.mu.Lock()
+	closed := i.closed
+	i.m.mu.Unlock()
+	if closed {
+		return nil
+	}
+	return i.m.write(i.id, sample)
+}
+
+// Close removes the input from the mix, later samples are dropped
+func (i *MixerInput) Close() {
+	i.m.mu.Lock()
+	defer i.m.mu.Unlock()
+	i.closed = true
+	delete(i.m.inputs, i.id)
+}
+
+// Input returns the input id of the mixer
+func (m *Mixer) Input(id string) *MixerInput {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.input(id)
+	return &MixerInput{m: m, id: id}
+}
+
+// SetGain sets the gain of the input id, 1 by default
+func (m *Mixer) SetGain(id string, gain float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.input(id).gain = gain
+}
+
+// input returns the input id, created when it doesn't exist. Must be
+// called with the lock held.
+func (m *Mixer) input(id string) *mixerInput {
+	in := m.inputs[id]
+	if in == nil {
+		in = &mixerInput{
+			gain:    1,
+			updated: time.Now(),
+		}
+		m.inputs[id] = in
+	}
+	return in
+}
+
+// frames returns the number of samples per channel of a duration
+func (m *Mixer) frames(d time.Duration) int64 {
+	return int64(d) * int64(m.config.SampleRate) / int64(time.Second)
+}
+
+func (m *Mixer) Write(sample *avp.Sample) error {
+	return m.write(sample.ID, sample)
+}
+
+func (m *Mixer) write(id string, sample *avp.Sample) error {
+	if sample.Type != TypePCM {
+		return nil
+	}
+	pcm, ok := sample.Payload.(PCM)
+	if !ok {
+		return ErrUnsupportedPayload
+	}
+	if pcm.Channels == 0 || len(pcm.Data) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil
+	}
+	in := m.input(id)
+	in.updated = time.Now()
+
+	if pcm.SampleRate != m.config.SampleRate {
+		if !in.warned {
+			log.Warnf("Mixer dropped samples of input %s with sample rate %d", id, pcm.SampleRate)
+			in.warned = true
+		}
+		return nil
+	}
+
+	if in.started {
+		in.elapsed += int64(int32(sample.Timestamp - in.last))
+	}
+	in.last = sample.Timestamp
+	// timestamps are in the opus clock
+	pos := in.origin + in.elapsed*int64(m.config.SampleRate)/opusClockRate
+	data := remix(pcm.Data, pcm.Channels, m.config.Channels)
+	n := int64(len(data) / m.config.Channels)
+	// inputs running ahead, or behind by more than the delay after the
+	// timestamps jumped back or the clock of the sender drifted, are
+	// aligned again
+	if !in.started || pos > m.position+m.frames(mixerMaxBuffer) || pos+n <= m.position-m.frames(m.config.Delay) {
+		in.started = true
+		in.origin = m.position + m.frames(m.config.Delay)
+		in.elapsed = 0
+		in.buf = in.buf[:0]
+		pos = in.origin
+	}
+
+	if pos+n <= m.position {
+		log.Debugf("Mixer dropped late sample of input %s", id)
+		return nil
+	}
+	m.add(in, pos, data)
+
+	if !m.running {
+		m.running = true
+		m.wg.Add(1)
+		go m.run()
+	}
+	return nil
+}
+
+// add writes data at a timeline position of the buffer of an input
+func (m *Mixer) add(in *mixerInput, pos int64, data []int16) {
+	ch := int64(m.config.Channels)
+	if len(in.buf) == 0 {
+		in.start = pos
+	}
+	if pos < in.start {
+		in.buf = append(make([]int16, (in.start-pos)*ch), in.buf...)
+		in.start = pos
+	}
+	if end := (pos-in.start)*ch + int64(len(data)); end > int64(len(in.buf)) {
+		in.buf = append(in.buf, make([]int16, end-int64(len(in.buf)))...)
+	}
+	copy(in.buf[(pos-in.start)*ch:], data)
+}
+
+// mix returns the next frame of the mix
+func (m *Mixer) mix() *avp.Sample {
+	ch := int64(m.config.Channels)
+	frames := m.frames(m.config.FrameDuration)
+	acc := make([]float64, frames*ch)
+
+	for id, in := range m.inputs {
+		if time.Since(in.updated) > mixerInputTimeout {
+			delete(m.inputs, id)
+			continue
+		}
+
+		offset := m.position - in.start
+		for i := int64(0); i < frames; i++ {
+			idx := (offset + i) * ch
+			if idx < 0 {
+				continue
+			}
+			if idx >= int64(len(in.buf)) {
+				break
+			}
+			for c := int64(0); c < ch; c++ {
+				acc[i*ch+c] += float64(in.buf[idx+c]) * in.gain
+			}
+		}
+
+		// drop the mixed samples
+		if consumed := (offset + frames) * ch; consumed >= int64(len(in.buf)) {
+			in.buf = in.buf[:0]
+		} else if consumed > 0 {
+			in.buf = in.buf[consumed:]
+			in.start += offset + frames
+		}
+	}
+
+	// the limiter lowers the gain of the frames that would clip
+	peak := 0.0
+	for _, v := range acc {
+		peak = math.Max(peak, math.Abs(v))
+	}
+	if peak*m.gain > math.MaxInt16 {
+		m.gain = math.MaxInt16 / peak
+	}
+	data := make([]int16, len(acc))
+	for i, v := range acc {
+		data[i] = int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(v*m.gain))))
+	}
+	m.gain = math.Min(1, m.gain*mixerLimiterRelease)
+
+	sample := &avp.Sample{
+		ID:        m.config.ID,
+		Type:      TypePCM,
+		Timestamp: uint32(m.position * opusClockRate / int64(m.config.SampleRate)),
+		Payload: PCM{
+			Data:       data,
+			SampleRate: m.config.SampleRate,
+			Channels:   m.config.Channels,
+		},
+	}
+	m.position += frames
+	return sample
+}
+
+func (m *Mixer) run() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.config.FrameDuration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.mu.Lock()
+			sample := m.mix()
+			m.mu.Unlock()
+
+			if err := m.Node.Write(sample); err != nil {
+				log.Errorf("Mixer error writing sample: %s", err)
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// Close stops the mix
+func (m *Mixer) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	close(m.done)
+	m.mu.Unlock()
+
+	m.wg.Wait()
+	m.Node.Close()
+}
@@ -0,0 +1,140 @@
+package elements
+
+import (
+	"testing"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// constant returns a 10ms mono 48khz pcm frame of a value
+func constant(v int16) PCM {
+	data := make([]int16, 480)
+	for i := range data {
+		data[i] = v
+	}
+	return PCM{Data: data, SampleRate: 48000, Channels: 1}
+}
+
+// mixed returns the samples of the mix after the recorder received n
+// frames
+func mixed(t *testing.T, m *Mixer, recorder *sampleCollector, n int) []int16 {
+	assert.Eventually(t, func() bool {
+		recorder.Lock()
+		defer recorder.Unlock()
+		return len(recorder.samples) >= n
+	}, 5*time.Second, 10*time.Millisecond)
+	m.Close()
+	assert.True(t, recorder.closed)
+
+	var data []int16
+	for i, sample := range recorder.samples {
+		assert.Equal(t, TypePCM, sample.Type)
+		assert.Equal(t, uint32(i*480), sample.Timestamp)
+		pcm := sample.Payload.(PCM)
+		assert.Equal(t, 1, pcm.Channels)
+		assert.Equal(t, 48000, pcm.SampleRate)
+		data = append(data, pcm.Data...)
+	}
+	return data
+}
+
+func TestMixer(t *testing.T) {
+	m := NewMixer(MixerConfig{
+		Channels:      1,
+		FrameDuration: 10 * time.Millisecond,
+		Delay:         20 * time.Millisecond,
+	})
+	recorder := &sampleCollector{}
+	m.Attach(recorder)
+	m.SetGain("b", 0.5)
+
+	stereo := PCM{Data: make([]int16, 960), SampleRate: 48000, Channels: 2}
+	for i := range stereo.Data {
+		stereo.Data[i] = int16(1000 * (i % 2))
+	}
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, m.Write(&avp.Sample{ID: "a", Type: TypePCM, Timestamp: uint32(1000 + i*480), Payload: constant(1000)}))
+		// inputs are aligned on their first sample
+		assert.NoError(t, m.Write(&avp.Sample{ID: "b", Type: TypePCM, Timestamp: uint32(i * 480), Payload: constant(4000)}))
+	}
+	// the channels are mixed down
+	assert.NoError(t, m.Write(&avp.Sample{ID: "a", Type: TypePCM, Timestamp: 1000 + 4*480, Payload: stereo}))
+	// other sample rates are dropped
+	assert.NoError(t, m.Write(&avp.Sample{ID: "c", Type: TypePCM, Payload: PCM{Data: make([]int16, 160), SampleRate: 16000, Channels: 1}}))
+
+	data := mixed(t, m, recorder, 10)
+
+	// silent until the delay
+	for _, v := range data[:960] {
+		assert.Equal(t, int16(0), v)
+	}
+	for _, v := range data[960 : 960+4*480] {
+		assert.Equal(t, int16(3000), v)
+	}
+	for _, v := range data[960+4*480 : 960+5*480] {
+		assert.Equal(t, int16(500), v)
+	}
+	// and once the inputs are silent
+	for _, v := range data[960+5*480:] {
+		assert.Equal(t, int16(0), v)
+	}
+}
+
+func TestMixer_Limiter(t *testing.T) {
+	m := NewMixer(MixerConfig{
+		Channels:      1,
+		FrameDuration: 10 * time.Millisecond,
+		Delay:         10 * time.Millisecond,
+	})
+	recorder := &sampleCollector{}
+	m.Attach(recorder)
+
+	a, b := m.Input("a"), m.Input("b")
+	removed := m.Input("c")
+	removed.Close()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, a.Write(&avp.Sample{Type: TypePCM, Timestamp: uint32(i * 480), Payload: constant(30000)}))
+		assert.NoError(t, b.Write(&avp.Sample{Type: TypePCM, Timestamp: uint32(i * 480), Payload: constant(30000)}))
+	}
+	assert.NoError(t, removed.Write(&avp.Sample{Type: TypePCM, Payload: constant(30000)}))
+
+	m.mu.Lock()
+	assert.Len(t, m.inputs, 2)
+	m.mu.Unlock()
+
+	data := mixed(t, m, recorder, 6)
+	for _, v := range data[480 : 4*480] {
+		// lowered instead of clipped
+		assert.True(t, v > 30000, v)
+	}
+	assert.Equal(t, int16(32767), data[480])
+}
+
+func TestMixer_Resync(t *testing.T) {
+	m := NewMixer(MixerConfig{
+		Channels:      1,
+		FrameDuration: 10 * time.Millisecond,
+		Delay:         20 * time.Millisecond,
+	})
+	recorder := &sampleCollector{}
+	m.Attach(recorder)
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, m.Write(&avp.Sample{ID: "a", Type: TypePCM, Timestamp: uint32(480000 + i*480), Payload: constant(1000)}))
+	}
+	// the sender restarted, its timestamps jumped back
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, m.Write(&avp.Sample{ID: "a", Type: TypePCM, Timestamp: uint32(i * 480), Payload: constant(2000)}))
+	}
+
+	data := mixed(t, m, recorder, 10)
+	played := 0
+	for _, v := range data {
+		if v == 2000 {
+			played++
+		}
+	}
+	assert.Equal(t, 4*480, played)
+}
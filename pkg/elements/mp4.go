@@ -0,0 +1,634 @@
+package elements
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+)
+
+const (
+	defaultFragmentDuration = time.Second
+	mp4CopyBufferSize       = 64 * 1024
+
+	// sample flags of the track fragment runs
+	mp4SyncSampleFlags    = 0x02000000 // depends on no other sample
+	mp4NonSyncSampleFlags = 0x01010000 // depends on others, non sync
+)
+
+// MP4MuxerConfig configures an MP4Muxer
+type MP4MuxerConfig struct {
+	// AudioOnly or VideoOnly is the kind of the tracks received before
+	// the init segment is written. Both kinds are expected by default.
+	AudioOnly bool
+	VideoOnly bool
+	// FragmentDuration cuts the fragments of audio only streams, video
+	// fragments start on keyframes. Defaults to 1s.
+	FragmentDuration time.Duration
+	// Finalize writes a progressive download mp4 on close, with the
+	// moov box before the media data, instead of fragments.
+	Finalize bool
+	// TempDir holds the media data buffered when finalizing. Defaults
+	// to the os temp dir.
+	TempDir string
+}
+
+type mp4Sample struct {
+	data     []byte
+	time     uint64 // decode time in the track timescale
+	duration uint32
+	key      bool
+}
+
+type mp4TrackKey struct {
+	id  string
+	typ int
+}
+
+type mp4Track struct {
+	id        uint32
+	typ       int
+	timescale uint32
+	codec     string // rfc 6381 codec of the track
+	width     int
+	height    int
+	entry     []byte // sample entry
+	timestamp uint32 // rtp timestamp of the last sample
+	time      uint64 // decode time of the last sample
+	samples   []*mp4Sample
+
+	// sample tables of a finalized mp4
+	durations []uint32
+	sizes     []uint32
+	offsets   []uint64
+	syncs     []uint32
+	duration  uint64
+}
+
+func (t *mp4Track) audio() bool {
+	return t.typ == avp.TypeOpus
+}
+
+// MP4Muxer muxes the h264, vp8, vp9, av1 and opus samples of tracks as
+// fragmented mp4. Samples are buffered until a track of each expected
+// kind was received, video tracks start on a keyframe. Fragments are
+// cut on the video keyframes.
+type MP4Muxer struct {
+	Node
+	mu       sync.Mutex
+	config   MP4MuxerConfig
+	tracks   []*mp4Track
+	byKey    map[mp4TrackKey]*mp4Track
+	started  bool
+	closed   bool
+	buffered int
+	sequence uint32
+	mdat     *os.File
+	mdatSize uint64
+	// duration of the last fragment, of its video run when there is one
+	fragmentDuration time.Duration
+}
+
+// NewMP4Muxer instance
+func NewMP4Muxer(config MP4MuxerConfig) *MP4Muxer {
+	if config.FragmentDuration == 0 {
+		config.FragmentDuration = defaultFragmentDuration
+	}
+	return &MP4Muxer{
+		config: config,
+		byKey:  make(map[mp4TrackKey]*mp4Track),
+	}
+}
+
+func (m *MP4Muxer) Write(sample *avp.Sample) error {
+	switch sample.Type {
+	case avp.TypeOpus, avp.TypeVP8, avp.TypeVP9, avp.TypeH264, avp.TypeAV1:
+	default:
+		return nil
+	}
+	payload, ok := sample.Payload.([]byte)
+	if !ok {
+		return ErrUnsupportedPayload
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil
+	}
+
+	key := mp4TrackKey{id: sample.ID, typ: sample.Type}
+	t := m.byKey[key]
+	if t == nil {
+		if m.started {
+			log.Debugf("MP4 muxer dropped sample of track %s received after the init segment", sample.ID)
+			return nil
+		}
+		if t = m.newTrack(sample.Type, payload); t == nil {
+			// wait for a keyframe
+			return nil
+		}
+		t.timestamp = sample.Timestamp
+		m.byKey[key] = t
+		m.tracks = append(m.tracks, t)
+	}
+
+	if len(t.samples) > 0 {
+		delta := int32(sample.Timestamp - t.timestamp)
+		if delta <= 0 {
+			log.Debugf("MP4 muxer dropped late sample of track %s", sample.ID)
+			return nil
+		}
+		t.samples[len(t.samples)-1].duration = uint32(delta)
+		t.time += uint64(delta)
+	}
+	t.timestamp = sample.Timestamp
+
+	s := &mp4Sample{
+		data: mp4SampleData(t.typ, payload),
+		time: t.time,
+		key:  t.audio() || isKeyframe(t.typ, payload),
+	}
+
+	if m.started && s.key && !t.audio() {
+		if err := m.cut(false); err != nil {
+			return err
+		}
+	}
+	t.samples = append(t.samples, s)
+
+	if !m.started {
+		m.buffered++
+		if m.ready() || m.buffered >= maxBufferedSamples {
+			return m.start()
+		}
+		return nil
+	}
+
+	if !m.hasVideo() {
+		last := t.samples[len(t.samples)-1]
+		if time.Duration(last.time-t.samples[0].time)*time.Second/time.Duration(t.timescale) >= m.config.FragmentDuration {
+			return m.cut(false)
+		}
+	}
+	return nil
+}
+
+// newTrack creates the track of a sample, nil until a video keyframe
+// with the codec configuration is received
+func (m *MP4Muxer) newTrack(typ int, payload []byte) *mp4Track {
+	t := &mp4Track{
+		id:        uint32(len(m.tracks) + 1),
+		typ:       typ,
+		timescale: videoClockRate,
+	}
+
+	switch typ {
+	case avp.TypeOpus:
+		t.timescale = opusClockRate
+		t.codec = "opus"
+		t.entry = mp4AudioSampleEntry("Opus", 2, opusClockRate, mp4Dops(2))
+		return t
+
+	case avp.TypeVP8, avp.TypeVP9:
+		width, height, ok := frameSize(typ, payload)
+		if !ok {
+			return nil
+		}
+		t.width, t.height = width, height
+		if typ == avp.TypeVP8 {
+			t.codec = "vp8"
+			t.entry = mp4VisualSampleEntry("vp08", width, height, mp4Vpcc(0, width, height))
+		} else {
+			profile := (payload[0]>>4&0x1)<<1 | payload[0]>>5&0x1
+			bitDepth := 8
+			if profile >= 2 {
+				bitDepth = 10
+			}
+			t.codec = fmt.Sprintf("vp09.%02d.%02d.%02d", profile, vpLevel(width, height), bitDepth)
+			t.entry = mp4VisualSampleEntry("vp09", width, height, mp4Vpcc(profile, width, height))
+		}
+
+	case avp.TypeH264:
+		if !isKeyframe(typ, payload) {
+			return nil
+		}
+		sps, pps := h264ParameterSets(splitAnnexB(payload))
+		if sps == nil || pps == nil {
+			return nil
+		}
+		parsed, ok := parseH264SPS(sps)
+		if !ok {
+			return nil
+		}
+		t.width, t.height = parsed.width, parsed.height
+		t.codec = fmt.Sprintf("avc1.%02x%02x%02x", parsed.profile, parsed.compatibility, parsed.level)
+		t.entry = mp4VisualSampleEntry("avc1", t.width, t.height, mp4Avcc(sps, pps, parsed))
+
+	case avp.TypeAV1:
+		obus, ok := splitAV1OBUs(payload)
+		if !ok {
+			return nil
+		}
+		obu, ok := av1SequenceHeaderOBU(obus)
+		if !ok {
+			return nil
+		}
+		h, ok := parseAV1SequenceHeader(obu.body)
+		if !ok {
+			return nil
+		}
+		t.width, t.height = h.width, h.height
+		t.codec = av1Codec(h)
+		t.entry = mp4VisualSampleEntry("av01", t.width, t.height, mp4Av1c(h, obu.data))
+	}
+
+	log.Infof("MP4 muxer added track %d with video width=%d, height=%d", t.id, t.width, t.height)
+	return t
+}
+
+// mp4SampleData converts a sample payload to the mp4 sample format
+func mp4SampleData(typ int, payload []byte) []byte {
+	switch typ {
+	case avp.TypeH264:
+		// length prefixed nal units
+		var data []byte
+		for _, nalu := range splitAnnexB(payload) {
+			if nalu[0]&0x1f == h264NALUAUD {
+				continue
+			}
+			data = append(append(data, u32(uint32(len(nalu)))...), nalu...)
+		}
+		return data
+
+	case avp.TypeAV1:
+		obus, ok := splitAV1OBUs(payload)
+		if !ok {
+			return payload
+		}
+		var data []byte
+		for _, obu := range obus {
+			if obu.typ != av1OBUTemporalDelimiter {
+				data = append(data, obu.data...)
+			}
+		}
+		return data
+	}
+	return payload
+}
+
+func (m *MP4Muxer) hasVideo() bool {
+	for _, t := range m.tracks {
+		if !t.audio() {
+			return true
+		}
+	}
+	return false
+}
+
+// ready returns true when a track of each expected kind was received
+func (m *MP4Muxer) ready() bool {
+	audio := false
+	for _, t := range m.tracks {
+		if t.audio() {
+			audio = true
+		}
+	}
+	video := m.hasVideo()
+
+	switch {
+	case m.config.AudioOnly:
+		return audio
+	case m.config.VideoOnly:
+		return video
+	}
+	return audio && video
+}
+
+// start writes the init segment, or opens the buffer of the media data
+// when finalizing
+func (m *MP4Muxer) start() error {
+	if m.config.Finalize {
+		f, err := ioutil.TempFile(m.config.TempDir, "mp4muxer")
+		if err != nil {
+			return err
+		}
+		m.mdat = f
+		m.started = true
+		return nil
+	}
+
+	m.started = true
+	return m.Node.Write(&avp.Sample{
+		Type:    TypeBinary,
+		Payload: append(mp4Ftyp(m.brands()...), m.moov(0, false)...),
+	})
+}
+
+func (m *MP4Muxer) brands() []string {
+	var brands []string
+	for _, t := range m.tracks {
+		if t.typ == avp.TypeAV1 {
+			brands = append(brands, "av01")
+		}
+	}
+	return brands
+}
+
+// cut writes the samples of known duration, all of them when closing,
+// as a fragment
+func (m *MP4Muxer) cut(closing bool) error {
+	runs := make([][]*mp4Sample, len(m.tracks))
+	count := 0
+	for i, t := range m.tracks {
+		n := len(t.samples)
+		if n == 0 {
+			continue
+		}
+		if last := t.samples[n-1]; last.duration == 0 {
+			// the duration of the last sample is known with the next one
+			switch {
+			case !closing:
+				n--
+			case n > 1:
+				last.duration = t.samples[n-2].duration
+			case t.audio():
+				last.duration = opusPacketDuration(last.data)
+			default:
+				last.duration = t.timescale / 30
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		runs[i] = t.samples[:n]
+		t.samples = t.samples[n:]
+		count += n
+	}
+	if count == 0 {
+		return nil
+	}
+
+	m.fragmentDuration = 0
+	video := false
+	for i, run := range runs {
+		t := m.tracks[i]
+		var ticks uint64
+		for _, s := range run {
+			ticks += uint64(s.duration)
+		}
+		d := time.Duration(ticks) * time.Second / time.Duration(t.timescale)
+		switch {
+		case !t.audio() && len(run) > 0:
+			video = true
+			m.fragmentDuration = d
+		case !video && d > m.fragmentDuration:
+			m.fragmentDuration = d
+		}
+	}
+
+	if m.config.Finalize {
+		return m.buffer(runs)
+	}
+	return m.Node.Write(&avp.Sample{
+		Type:    TypeBinary,
+		Payload: m.fragment(runs),
+	})
+}
+
+// fragment returns the moof and mdat boxes of the sample runs
+func (m *MP4Muxer) fragment(runs [][]*mp4Sample) []byte {
+	m.sequence++
+
+	moof := func(offset uint32) []byte {
+		children := [][]byte{mp4FullBox("mfhd", 0, 0, u32(m.sequence))}
+		for i, run := range runs {
+			if len(run) == 0 {
+				continue
+			}
+			entries := make([]byte, 0, 12*len(run))
+			size := uint32(0)
+			for _, s := range run {
+				flags := uint32(mp4SyncSampleFlags)
+				if !s.key {
+					flags = mp4NonSyncSampleFlags
+				}
+				entries = append(entries, u32(s.duration, uint32(len(s.data)), flags)...)
+				size += uint32(len(s.data))
+			}
+			children = append(children, mp4Box("traf",
+				mp4FullBox("tfhd", 0, 0x020000, u32(m.tracks[i].id)), // default base is moof
+				mp4FullBox("tfdt", 1, 0, u64(run[0].time)),
+				mp4FullBox("trun", 0, 0x000701, u32(uint32(len(run)), offset), entries),
+			))
+			offset += size
+		}
+		return mp4Box("moof", children...)
+	}
+
+	var data []byte
+	for _, run := range runs {
+		for _, s := range run {
+			data = append(data, s.data...)
+		}
+	}
+
+	header := mp4MdatHeader(uint64(len(data)))
+	size := len(moof(0))
+	fragment := moof(uint32(size + len(header)))
+	return append(append(fragment, header...), data...)
+}
+
+// buffer writes the sample runs to the media data of a finalized mp4
+func (m *MP4Muxer) buffer(runs [][]*mp4Sample) error {
+	for i, run := range runs {
+		t := m.tracks[i]
+		for _, s := range run {
+			if _, err := m.mdat.Write(s.data); err != nil {
+				return err
+			}
+			t.durations = append(t.durations, s.duration)
+			t.sizes = append(t.sizes, uint32(len(s.data)))
+			t.offsets = append(t.offsets, m.mdatSize)
+			if s.key {
+				t.syncs = append(t.syncs, uint32(len(t.sizes)))
+			}
+			t.duration += uint64(s.duration)
+			m.mdatSize += uint64(len(s.data))
+		}
+	}
+	return nil
+}
+
+// moov returns the movie box. Finalized movies have the sample tables
+// of the media data at offset, fragmented ones are extended by the
+// fragments.
+func (m *MP4Muxer) moov(offset uint64, finalized bool) []byte {
+	var duration uint32
+	var traks [][]byte
+	var trexs [][]byte
+	for _, t := range m.tracks {
+		trackDuration := uint32(t.duration * 1000 / uint64(t.timescale))
+		if trackDuration > duration {
+			duration = trackDuration
+		}
+
+		stsd := mp4FullBox("stsd", 0, 0, u32(1), t.entry)
+		stbl := mp4Box("stbl", stsd,
+			mp4FullBox("stts", 0, 0, u32(0)),
+			mp4FullBox("stsc", 0, 0, u32(0)),
+			mp4FullBox("stsz", 0, 0, u32(0, 0)),
+			mp4FullBox("stco", 0, 0, u32(0)),
+		)
+		if finalized {
+			stbl = mp4Box("stbl", append([][]byte{stsd}, t.sampleTables(offset)...)...)
+		}
+
+		traks = append(traks, mp4Box("trak",
+			mp4Tkhd(t, trackDuration),
+			mp4Box("mdia",
+				mp4Mdhd(t.timescale, t.duration),
+				mp4Hdlr(t),
+				mp4Minf(t, stbl),
+			),
+		))
+		trexs = append(trexs, mp4FullBox("trex", 0, 0, u32(t.id, 1, 0, 0, 0)))
+	}
+
+	children := append([][]byte{mp4Mvhd(duration, uint32(len(m.tracks)+1))}, traks...)
+	if !finalized {
+		children = append(children, mp4Box("mvex", trexs...))
+	}
+	return mp4Box("moov", children...)
+}
+
+// sampleTables returns the sample tables of a finalized track, each
+// sample is a chunk
+func (t *mp4Track) sampleTables(offset uint64) [][]byte {
+	var stts []byte
+	entries := uint32(0)
+	for i := 0; i < len(t.durations); {
+		j := i
+		for j < len(t.durations) && t.durations[j] == t.durations[i] {
+			j++
+		}
+		stts = append(stts, u32(uint32(j-i), t.durations[i])...)
+		entries++
+		i = j
+	}
+
+	chunks := [][]byte{u32(uint32(len(t.offsets)))}
+	co64 := offset+t.lastOffset() > math.MaxUint32
+	for _, o := range t.offsets {
+		if co64 {
+			chunks = append(chunks, u64(offset+o))
+		} else {
+			chunks = append(chunks, u32(uint32(offset+o)))
+		}
+	}
+	stco := mp4FullBox("stco", 0, 0, chunks...)
+	if co64 {
+		stco = mp4FullBox("co64", 0, 0, chunks...)
+	}
+
+	tables := [][]byte{
+		mp4FullBox("stts", 0, 0, u32(entries), stts),
+		mp4FullBox("stsc", 0, 0, u32(1, 1, 1, 1)),
+		mp4FullBox("stsz", 0, 0, u32(0, uint32(len(t.sizes))), u32(t.sizes...)),
+		stco,
+	}
+	if !t.audio() {
+		// audio samples are all sync samples
+		tables = append(tables, mp4FullBox("stss", 0, 0, u32(uint32(len(t.syncs))), u32(t.syncs...)))
+	}
+	return tables
+}
+
+func (t *mp4Track) lastOffset() uint64 {
+	if len(t.offsets) == 0 {
+		return 0
+	}
+	return t.offsets[len(t.offsets)-1]
+}
+
+// finalize writes the progressive mp4 of the buffered media data
+func (m *MP4Muxer) finalize() error {
+	ftyp := mp4Ftyp(m.brands()...)
+	header := mp4MdatHeader(m.mdatSize)
+
+	// the moov size only depends on the chunk offset box type
+	offset := uint64(len(ftyp) + len(m.moov(0, true)) + len(header))
+	moov := m.moov(offset, true)
+	if uint64(len(ftyp)+len(moov)+len(header)) != offset {
+		offset = uint64(len(ftyp) + len(moov) + len(header))
+		moov = m.moov(offset, true)
+	}
+
+	if err := m.Node.Write(&avp.Sample{
+		Type:    TypeBinary,
+		Payload: append(append(ftyp, moov...), header...),
+	}); err != nil {
+		return err
+	}
+
+	if _, err := m.mdat.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	buf := make([]byte, mp4CopyBufferSize)
+	for {
+		n, err := m.mdat.Read(buf)
+		if n > 0 {
+			if werr := m.Node.Write(&avp.Sample{
+				Type:    TypeBinary,
+				Payload: append([]byte{}, buf[:n]...),
+			}); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close writes the last fragment, or the finalized mp4, and closes
+// the children
+func (m *MP4Muxer) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+
+	if !m.started && len(m.tracks) > 0 {
+		if err := m.start(); err != nil {
+			log.Errorf("mp4 muxer start err: %s", err)
+		}
+	}
+	if m.started {
+		if err := m.cut(true); err != nil {
+			log.Errorf("mp4 muxer fragment err: %s", err)
+		}
+	}
+	if m.mdat != nil {
+		if err := m.finalize(); err != nil {
+			log.Errorf("mp4 muxer finalize err: %s", err)
+		}
+		m.mdat.Close()
+		os.Remove(m.mdat.Name())
+	}
+	m.mu.Unlock()
+
+	m.Node.Close()
+}
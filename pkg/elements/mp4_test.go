@@ -0,0 +1,242 @@
+package elements
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	// baseline sps of a 320x240 stream, pps, idr and non idr slices
+	rawH264SPS = []byte{0x67, 0x42, 0xc0, 0x1e, 0xda, 0x05, 0x07, 0xe4}
+	rawH264PPS = []byte{0x68, 0xce, 0x38, 0x80}
+	rawH264IDR = []byte{0x65, 0x88, 0x84, 0x00}
+	rawH264P   = []byte{0x41, 0x9a, 0x02, 0x00}
+
+	// reduced still picture sequence header obu of a 640x480 stream
+	rawAV1SequenceHeader = []byte{0x0a, 0x07, 0x1a, 0x26, 0x27, 0xfe, 0xf8, 0x00, 0x10}
+)
+
+func annexB(nalus ...[]byte) []byte {
+	var b []byte
+	for _, nalu := range nalus {
+		b = append(append(b, 0x00, 0x00, 0x00, 0x01), nalu...)
+	}
+	return b
+}
+
+// mp4Node is a parsed box
+type mp4Node struct {
+	typ      string
+	payload  []byte
+	children []*mp4Node
+}
+
+func (n *mp4Node) find(path ...string) *mp4Node {
+	if len(path) == 0 {
+		return n
+	}
+	for _, c := range n.children {
+		if c.typ == path[0] {
+			if found := c.find(path[1:]...); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+func (n *mp4Node) types() []string {
+	var types []string
+	for _, c := range n.children {
+		types = append(types, c.typ)
+	}
+	return types
+}
+
+func parseMP4(t *testing.T, data []byte) *mp4Node {
+	containers := map[string]int{
+		"moov": 0, "trak": 0, "mdia": 0, "minf": 0, "stbl": 0, "mvex": 0,
+		"moof": 0, "traf": 0, "dinf": 0, "stsd": 8, "avc1": 78, "Opus": 28,
+		"av01": 78,
+	}
+	root := &mp4Node{}
+	var parse func(n *mp4Node, data []byte)
+	parse = func(n *mp4Node, data []byte) {
+		for len(data) > 0 {
+			if !assert.True(t, len(data) >= 8) {
+				return
+			}
+			size := int(binary.BigEndian.Uint32(data))
+			if !assert.True(t, size >= 8 && size <= len(data), "box size") {
+				return
+			}
+			child := &mp4Node{typ: string(data[4:8]), payload: data[8:size]}
+			if skip, ok := containers[child.typ]; ok {
+				parse(child, child.payload[skip:])
+			}
+			n.children = append(n.children, child)
+			data = data[size:]
+		}
+	}
+	parse(root, data)
+	return root
+}
+
+func TestParseH264SPS(t *testing.T) {
+	sps, ok := parseH264SPS(rawH264SPS)
+	assert.True(t, ok)
+	assert.Equal(t, uint8(66), sps.profile)
+	assert.Equal(t, uint8(30), sps.level)
+	assert.Equal(t, 320, sps.width)
+	assert.Equal(t, 240, sps.height)
+
+	assert.Equal(t, [][]byte{rawH264SPS, rawH264PPS}, splitAnnexB(annexB(rawH264SPS, rawH264PPS)))
+	assert.True(t, isKeyframe(avp.TypeH264, annexB(rawH264SPS, rawH264PPS, rawH264IDR)))
+	assert.False(t, isKeyframe(avp.TypeH264, annexB(rawH264P)))
+}
+
+func TestParseAV1SequenceHeader(t *testing.T) {
+	obus, ok := splitAV1OBUs(append([]byte{0x12, 0x00}, rawAV1SequenceHeader...))
+	assert.True(t, ok)
+	assert.Len(t, obus, 2)
+	assert.Equal(t, uint8(av1OBUTemporalDelimiter), obus[0].typ)
+
+	obu, ok := av1SequenceHeaderOBU(obus)
+	assert.True(t, ok)
+	h, ok := parseAV1SequenceHeader(obu.body)
+	assert.True(t, ok)
+	assert.Equal(t, uint8(8), h.level)
+	assert.Equal(t, 640, h.width)
+	assert.Equal(t, 480, h.height)
+	assert.True(t, h.subsamplingX && h.subsamplingY)
+}
+
+func writeMP4Samples(t *testing.T, muxer *MP4Muxer) {
+	// audio before the video keyframe is buffered
+	for i := uint32(0); i < 3; i++ {
+		assert.NoError(t, muxer.Write(&avp.Sample{ID: "audio", Type: avp.TypeOpus, Timestamp: i * 960, Payload: rawOpusFrame}))
+	}
+	// dropped until the first keyframe
+	assert.NoError(t, muxer.Write(&avp.Sample{ID: "video", Type: avp.TypeH264, Timestamp: 0, Payload: annexB(rawH264P)}))
+
+	for i, payload := range [][]byte{
+		annexB(rawH264SPS, rawH264PPS, rawH264IDR),
+		annexB(rawH264P),
+		annexB(rawH264P),
+		annexB(rawH264SPS, rawH264PPS, rawH264IDR),
+		annexB(rawH264P),
+	} {
+		ts := uint32(1000 + i*3000)
+		assert.NoError(t, muxer.Write(&avp.Sample{ID: "video", Type: avp.TypeH264, Timestamp: ts, Payload: payload}))
+		assert.NoError(t, muxer.Write(&avp.Sample{ID: "audio", Type: avp.TypeOpus, Timestamp: uint32(3+i) * 960, Payload: rawOpusFrame}))
+	}
+	muxer.Close()
+}
+
+func TestMP4Muxer_Fragmented(t *testing.T) {
+	muxer := NewMP4Muxer(MP4MuxerConfig{})
+	writer := &sampleCollector{}
+	muxer.Attach(writer)
+	writeMP4Samples(t, muxer)
+	assert.True(t, writer.closed)
+
+	var data []byte
+	for _, s := range writer.samples {
+		data = append(data, s.Payload.([]byte)...)
+	}
+	root := parseMP4(t, data)
+	assert.Equal(t, []string{"ftyp", "moov", "moof", "mdat", "moof", "mdat"}, root.types())
+	assert.NotNil(t, root.find("moov", "mvex", "trex"))
+
+	moov := root.find("moov")
+	assert.Len(t, moov.find("trak").find("mdia", "minf", "stbl", "stsd").children, 1)
+	avc1 := moov.children[2].find("mdia", "minf", "stbl", "stsd", "avc1")
+	if assert.NotNil(t, avc1) {
+		assert.Equal(t, uint16(320), binary.BigEndian.Uint16(avc1.payload[24:]))
+		assert.Equal(t, uint16(240), binary.BigEndian.Uint16(avc1.payload[26:]))
+		avcc := avc1.find("avcC")
+		assert.Equal(t, rawH264SPS, avcc.payload[8:8+len(rawH264SPS)])
+	}
+	assert.NotNil(t, moov.find("trak", "mdia", "minf", "stbl", "stsd", "Opus", "dOps"))
+
+	// the first fragment ends before the second keyframe
+	var runs []uint32
+	var times []uint64
+	for _, moof := range []*mp4Node{root.children[2], root.children[4]} {
+		for _, traf := range moof.children[1:] {
+			times = append(times, binary.BigEndian.Uint64(traf.find("tfdt").payload[4:]))
+			runs = append(runs, binary.BigEndian.Uint32(traf.find("trun").payload[4:]))
+		}
+	}
+	assert.Equal(t, []uint32{5, 3, 3, 2}, runs)
+	assert.Equal(t, []uint64{0, 0, 5 * 960, 9000}, times)
+
+	// data offset of the first run points to the first audio sample
+	moof := root.children[2]
+	offset := binary.BigEndian.Uint32(moof.children[1].find("trun").payload[8:])
+	start := len(root.children[0].payload) + len(moov.payload) + 16
+	assert.Equal(t, rawOpusFrame, data[start+int(offset):start+int(offset)+len(rawOpusFrame)])
+}
+
+func TestMP4Muxer_Finalize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.mp4")
+	muxer := NewMP4Muxer(MP4MuxerConfig{Finalize: true, TempDir: t.TempDir()})
+	muxer.Attach(NewFileWriter(path, 1024))
+	writeMP4Samples(t, muxer)
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	root := parseMP4(t, data)
+	assert.Equal(t, []string{"ftyp", "moov", "mdat"}, root.types())
+	assert.Nil(t, root.find("moov", "mvex"))
+
+	video := root.find("moov").children[2].find("mdia", "minf", "stbl")
+	stsz := video.find("stsz").payload
+	assert.Equal(t, uint32(5), binary.BigEndian.Uint32(stsz[8:]))
+	stss := video.find("stss").payload
+	assert.Equal(t, []uint32{1, 4}, []uint32{binary.BigEndian.Uint32(stss[8:]), binary.BigEndian.Uint32(stss[12:])})
+
+	// the first video chunk is the length prefixed sps
+	stco := video.find("stco").payload
+	offset := binary.BigEndian.Uint32(stco[8:])
+	assert.Equal(t, uint32(len(rawH264SPS)), binary.BigEndian.Uint32(data[offset:]))
+	assert.Equal(t, rawH264SPS, data[offset+4:offset+4+uint32(len(rawH264SPS))])
+
+	// durations from the timestamps, the last one repeated
+	stts := video.find("stts").payload
+	assert.Equal(t, []uint32{1, 5, 3000}, []uint32{
+		binary.BigEndian.Uint32(stts[4:]),
+		binary.BigEndian.Uint32(stts[8:]),
+		binary.BigEndian.Uint32(stts[12:]),
+	})
+}
+
+func TestMP4Muxer_AV1(t *testing.T) {
+	muxer := NewMP4Muxer(MP4MuxerConfig{VideoOnly: true})
+	writer := &sampleCollector{}
+	muxer.Attach(writer)
+
+	frame := []byte{0x32, 0x02, 0xaa, 0xbb} // frame obu
+	assert.NoError(t, muxer.Write(&avp.Sample{Type: avp.TypeAV1, Timestamp: 0, Payload: append(append([]byte{0x12, 0x00}, rawAV1SequenceHeader...), frame...)}))
+	assert.NoError(t, muxer.Write(&avp.Sample{Type: avp.TypeAV1, Timestamp: 3000, Payload: append([]byte{0x12, 0x00}, frame...)}))
+	muxer.Close()
+
+	var data []byte
+	for _, s := range writer.samples {
+		data = append(data, s.Payload.([]byte)...)
+	}
+	root := parseMP4(t, data)
+	assert.Equal(t, []string{"ftyp", "moov", "moof", "mdat"}, root.types())
+	av01 := root.find("moov", "trak", "mdia", "minf", "stbl", "stsd", "av01")
+	if assert.NotNil(t, av01) {
+		assert.Equal(t, append([]byte{0x81, 0x08, 0x0c, 0x00}, rawAV1SequenceHeader...), av01.find("av1C").payload)
+	}
+	// temporal delimiters are removed
+	mdat := root.children[3].payload
+	assert.Equal(t, append(append([]byte{}, rawAV1SequenceHeader...), append(frame, frame...)...), mdat)
+}
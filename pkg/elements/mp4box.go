@@ -0,0 +1,225 @@
+package elements
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+var mp4Matrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+func u8(v uint8) []byte { return []byte{v} }
+
+func u16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func u32(v ...uint32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, u := range v {
+		binary.BigEndian.PutUint32(b[4*i:], u)
+	}
+	return b
+}
+
+func u64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// mp4Box returns a box of its type and children
+func mp4Box(typ string, children ...[]byte) []byte {
+	size := 8
+	for _, c := range children {
+		size += len(c)
+	}
+	b := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(b, uint32(size))
+	copy(b[4:], typ)
+	for _, c := range children {
+		b = append(b, c...)
+	}
+	return b
+}
+
+// mp4FullBox returns a box with a version and flags
+func mp4FullBox(typ string, version uint8, flags uint32, children ...[]byte) []byte {
+	return mp4Box(typ, append([][]byte{u32(uint32(version)<<24 | flags&0xffffff)}, children...)...)
+}
+
+// mp4MdatHeader returns the header of a mdat box of size bytes of data
+func mp4MdatHeader(size uint64) []byte {
+	if size+8 > math.MaxUint32 {
+		return append(append(u32(1), "mdat"...), u64(size+16)...)
+	}
+	return append(u32(uint32(size+8)), "mdat"...)
+}
+
+func mp4Ftyp(brands ...string) []byte {
+	b := [][]byte{[]byte("isom"), u32(0x200)}
+	for _, brand := range append([]string{"isom", "iso5", "iso6", "mp41"}, brands...) {
+		b = append(b, []byte(brand))
+	}
+	return mp4Box("ftyp", b...)
+}
+
+func mp4Mvhd(duration uint32, nextTrackID uint32) []byte {
+	return mp4FullBox("mvhd", 0, 0,
+		u32(0, 0),           // creation and modification time
+		u32(1000, duration), // timescale and duration
+		u32(0x00010000),     // rate
+		u16(0x0100), u16(0), // volume and reserved
+		u32(0, 0),             // reserved
+		u32(mp4Matrix...),     // matrix
+		u32(0, 0, 0, 0, 0, 0), // pre defined
+		u32(nextTrackID),
+	)
+}
+
+func mp4Tkhd(t *mp4Track, duration uint32) []byte {
+	var volume uint16
+	if t.audio() {
+		volume = 0x0100
+	}
+	return mp4FullBox("tkhd", 0, 0x3, // enabled and in movie
+		u32(0, 0),           // creation and modification time
+		u32(t.id, 0),        // track id and reserved
+		u32(duration, 0, 0), // duration and reserved
+		u16(0), u16(0),      // layer and alternate group
+		u16(volume), u16(0), // volume and reserved
+		u32(mp4Matrix...), // matrix
+		u32(uint32(t.width)<<16, uint32(t.height)<<16),
+	)
+}
+
+func mp4Mdhd(timescale uint32, duration uint64) []byte {
+	return mp4FullBox("mdhd", 1, 0,
+		u64(0), u64(0), // creation and modification time
+		u32(timescale), u64(duration),
+		u16(0x55c4), u16(0), // und language and pre defined
+	)
+}
+
+func mp4Hdlr(t *mp4Track) []byte {
+	handler, name := "vide", "VideoHandler"
+	if t.audio() {
+		handler, name = "soun", "SoundHandler"
+	}
+	return mp4FullBox("hdlr", 0, 0,
+		u32(0), []byte(handler), u32(0, 0, 0),
+		append([]byte(name), 0),
+	)
+}
+
+func mp4Minf(t *mp4Track, stbl []byte) []byte {
+	header := mp4FullBox("vmhd", 0, 1, u16(0), u16(0), u16(0), u16(0))
+	if t.audio() {
+		header = mp4FullBox("smhd", 0, 0, u16(0), u16(0))
+	}
+	dinf := mp4Box("dinf", mp4FullBox("dref", 0, 0, u32(1), mp4FullBox("url ", 0, 1)))
+	return mp4Box("minf", header, dinf, stbl)
+}
+
+func mp4VisualSampleEntry(typ string, width, height int, config []byte) []byte {
+	return mp4Box(typ,
+		make([]byte, 6), u16(1), // reserved and data reference index
+		u16(0), u16(0), u32(0, 0, 0), // pre defined and reserved
+		u16(uint16(width)), u16(uint16(height)),
+		u32(0x00480000, 0x00480000), // 72 dpi
+		u32(0), u16(1),              // reserved and frame count
+		make([]byte, 32),         // compressor name
+		u16(0x0018), u16(0xffff), // depth and pre defined
+		config,
+	)
+}
+
+func mp4AudioSampleEntry(typ string, channels uint16, sampleRate uint32, config []byte) []byte {
+	return mp4Box(typ,
+		make([]byte, 6), u16(1), // reserved and data reference index
+		u32(0, 0),              // reserved
+		u16(channels), u16(16), // channel count and sample size
+		u16(0), u16(0), // pre defined and reserved
+		u32(sampleRate<<16),
+		config,
+	)
+}
+
+// mp4Avcc returns the avc decoder configuration of a sps and pps
+func mp4Avcc(sps, pps []byte, parsed h264SPS) []byte {
+	b := []byte{1, parsed.profile, parsed.compatibility, parsed.level, 0xff, 0xe1}
+	b = append(append(b, u16(uint16(len(sps)))...), sps...)
+	b = append(append(append(b, 1), u16(uint16(len(pps)))...), pps...)
+	switch parsed.profile {
+	case 100, 110, 122, 144:
+		b = append(b,
+			0xfc|byte(parsed.chromaFormat),
+			0xf8|byte(parsed.bitDepthLuma),
+			0xf8|byte(parsed.bitDepthCroma),
+			0, // sps ext
+		)
+	}
+	return mp4Box("avcC", b)
+}
+
+// mp4Vpcc returns the vp codec configuration of a vp8 or vp9 stream
+func mp4Vpcc(profile uint8, width, height int) []byte {
+	bitDepth := uint8(8)
+	if profile >= 2 {
+		bitDepth = 10
+	}
+	return mp4FullBox("vpcC", 1, 0,
+		u8(profile), u8(vpLevel(width, height)),
+		u8(bitDepth<<4|1<<1), // 4:2:0 colocated, limited range
+		u8(2), u8(2), u8(2),  // unspecified primaries, transfer and matrix
+		u16(0), // codec initialization data size
+	)
+}
+
+// vpLevel returns the vp9 level of a picture size
+func vpLevel(width, height int) uint8 {
+	size := width * height
+	for _, l := range []struct {
+		level uint8
+		size  int
+	}{
+		{10, 36864}, {11, 73728}, {20, 122880}, {21, 245760}, {30, 552960},
+		{31, 983040}, {40, 2228224}, {50, 8912896}, {60, 35651584},
+	} {
+		if size <= l.size {
+			return l.level
+		}
+	}
+	return 62
+}
+
+// mp4Av1c returns the av1 codec configuration of a sequence header
+func mp4Av1c(h av1SequenceHeader, obu []byte) []byte {
+	flag := func(v bool, shift uint) byte {
+		if v {
+			return 1 << shift
+		}
+		return 0
+	}
+	return mp4Box("av1C",
+		[]byte{
+			0x81, // marker and version
+			h.profile<<5 | h.level&0x1f,
+			h.tier<<7 | flag(h.highBitDepth, 6) | flag(h.twelveBit, 5) | flag(h.monochrome, 4) |
+				flag(h.subsamplingX, 3) | flag(h.subsamplingY, 2) | h.chromaSamplePosition&0x3,
+			0, // no initial presentation delay
+		},
+		obu,
+	)
+}
+
+// mp4Dops returns the opus specific box
+func mp4Dops(channels uint8) []byte {
+	return mp4Box("dOps",
+		u8(0), u8(channels),
+		u16(0), // pre skip
+		u32(opusClockRate),
+		u16(0), u8(0), // output gain and channel mapping family
+	)
+}
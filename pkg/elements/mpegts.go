@@ -0,0 +1,256 @@
+package elements
+
+import (
+	"bytes"
+
+	avp "github.com/pion/ion-avp/pkg"
+)
+
+const (
+	tsPacketSize = 188
+	tsPMTPID     = 0x1000
+	tsVideoPID   = 0x100
+	tsAudioPID   = 0x101
+
+	tsStreamTypeH264    = 0x1b
+	tsStreamTypePrivate = 0x06 // opus, identified by its registration descriptor
+
+	// pts of the first sample of a stream, leaves room for the pcr
+	tsPTSOffset = videoClockRate
+	tsPCRDelay  = videoClockRate / 2
+)
+
+// h264 access unit delimiter starting the access units of ts streams
+var tsH264AUD = []byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xf0}
+
+// tsStream is an elementary stream of a transport stream
+type tsStream struct {
+	pid        uint16
+	typ        int
+	id         string // track id of the samples
+	clockRate  uint32
+	streamID   byte
+	streamType byte
+	cc         byte   // continuity counter
+	timestamp  uint32 // rtp timestamp of the last sample
+	time       uint64 // unwrapped time of the last sample in the clock rate
+	started    bool
+}
+
+// pts returns the 90khz presentation time of a sample timestamp, false
+// when the sample is late
+func (s *tsStream) pts(timestamp uint32) (uint64, bool) {
+	if s.started {
+		delta := int32(timestamp - s.timestamp)
+		if delta <= 0 {
+			return 0, false
+		}
+		s.time += uint64(delta)
+	}
+	s.started = true
+	s.timestamp = timestamp
+	return tsPTSOffset + s.time*videoClockRate/uint64(s.clockRate), true
+}
+
+// tsMuxer packetizes the h264 and opus samples of an mpeg transport
+// stream with a single program
+type tsMuxer struct {
+	video *tsStream
+	audio *tsStream
+	patCC byte
+	pmtCC byte
+}
+
+func newTSMuxer(video, audio bool) *tsMuxer {
+	m := &tsMuxer{}
+	if video {
+		m.video = &tsStream{
+			pid:        tsVideoPID,
+			typ:        avp.TypeH264,
+			clockRate:  videoClockRate,
+			streamID:   0xe0,
+			streamType: tsStreamTypeH264,
+		}
+	}
+	if audio {
+		m.audio = &tsStream{
+			pid:        tsAudioPID,
+			typ:        avp.TypeOpus,
+			clockRate:  opusClockRate,
+			streamID:   0xbd, // private stream 1
+			streamType: tsStreamTypePrivate,
+		}
+	}
+	return m
+}
+
+// stream returns the stream of a sample type
+func (m *tsMuxer) stream(typ int) *tsStream {
+	switch {
+	case m.video != nil && typ == m.video.typ:
+		return m.video
+	case m.audio != nil && typ == m.audio.typ:
+		return m.audio
+	}
+	return nil
+}
+
+func (m *tsMuxer) pcrPID() uint16 {
+	if m.video != nil {
+		return m.video.pid
+	}
+	return m.audio.pid
+}
+
+// tables returns the pat and pmt packets starting a segment
+func (m *tsMuxer) tables() []byte {
+	pat := []byte{0x00, 0xb0, 0x00, 0x00, 0x01, 0xc1, 0x00, 0x00}
+	pat = append(pat, u16(1)...)
+	pat = append(pat, u16(0xe000|tsPMTPID)...)
+
+	pmt := []byte{0x02, 0xb0, 0x00, 0x00, 0x01, 0xc1, 0x00, 0x00}
+	pmt = append(pmt, u16(0xe000|m.pcrPID())...)
+	pmt = append(pmt, u16(0xf000)...)
+	for _, s := range []*tsStream{m.video, m.audio} {
+		if s == nil {
+			continue
+		}
+		var descriptors []byte
+		if s.typ == avp.TypeOpus {
+			descriptors = []byte{
+				0x05, 0x04, 'O', 'p', 'u', 's', // registration
+				0x7f, 0x02, 0x80, 0x02, // opus extension, stereo
+			}
+		}
+		pmt = append(pmt, s.streamType)
+		pmt = append(pmt, u16(0xe000|s.pid)...)
+		pmt = append(pmt, u16(0xf000|uint16(len(descriptors)))...)
+		pmt = append(pmt, descriptors...)
+	}
+
+	return append(m.section(0, &m.patCC, pat), m.section(tsPMTPID, &m.pmtCC, pmt)...)
+}
+
+// section returns the packet of a psi section, its length and crc are
+// set
+func (m *tsMuxer) section(pid uint16, cc *byte, section []byte) []byte {
+	length := len(section) + 4 - 3
+	section[1] |= byte(length >> 8)
+	section[2] = byte(length)
+	section = append(section, u32(tsChecksum(section))...)
+
+	pkt := make([]byte, tsPacketSize)
+	pkt[0] = 0x47
+	pkt[1] = 0x40 | byte(pid>>8)
+	pkt[2] = byte(pid)
+	pkt[3] = 0x10 | *cc
+	*cc = (*cc + 1) & 0x0f
+	// pointer field
+	n := copy(pkt[5:], section)
+	for i := 5 + n; i < tsPacketSize; i++ {
+		pkt[i] = 0xff
+	}
+	return pkt
+}
+
+// pes returns the packets of a sample of the stream
+func (m *tsMuxer) pes(s *tsStream, pts uint64, key bool, payload []byte) []byte {
+	var data []byte
+	switch s.typ {
+	case avp.TypeH264:
+		data = append(data, tsH264AUD...)
+		for _, nalu := range splitAnnexB(payload) {
+			if nalu[0]&0x1f == h264NALUAUD {
+				continue
+			}
+			data = append(append(data, 0x00, 0x00, 0x00, 0x01), nalu...)
+		}
+	case avp.TypeOpus:
+		// control header with the size of the access unit
+		data = []byte{0x7f, 0xe0}
+		size := len(payload)
+		for ; size >= 0xff; size -= 0xff {
+			data = append(data, 0xff)
+		}
+		data = append(append(data, byte(size)), payload...)
+	}
+
+	header := []byte{0x00, 0x00, 0x01, s.streamID, 0x00, 0x00, 0x80, 0x80, 0x05}
+	// the length of video packets is unbounded
+	if length := len(data) + 8; s.typ != avp.TypeH264 && length <= 0xffff {
+		header[4], header[5] = byte(length>>8), byte(length)
+	}
+	header = append(header,
+		0x21|byte(pts>>29)&0x0e,
+		byte(pts>>22),
+		byte(pts>>14)|0x01,
+		byte(pts>>7),
+		byte(pts<<1)|0x01,
+	)
+	data = append(header, data...)
+
+	var out []byte
+	first := true
+	for len(data) > 0 {
+		var field []byte // adaptation field after its length
+		if first {
+			var flags byte
+			if key {
+				flags |= 0x40 // random access
+			}
+			if s.pid == m.pcrPID() {
+				flags |= 0x10
+				pcr := pts - tsPCRDelay
+				field = append(field, byte(pcr>>25), byte(pcr>>17), byte(pcr>>9), byte(pcr>>1), byte(pcr<<7)|0x7e, 0x00)
+			}
+			if flags != 0 {
+				field = append([]byte{flags}, field...)
+			}
+		}
+
+		space := tsPacketSize - 4
+		if field != nil {
+			space -= 1 + len(field)
+		}
+		if stuffing := space - len(data); stuffing > 0 {
+			switch {
+			case field != nil:
+				field = append(field, bytes.Repeat([]byte{0xff}, stuffing)...)
+			case stuffing == 1:
+				field = []byte{}
+			default:
+				field = append([]byte{0x00}, bytes.Repeat([]byte{0xff}, stuffing-2)...)
+			}
+			space = len(data)
+		}
+
+		pkt := make([]byte, 4, tsPacketSize)
+		pkt[0] = 0x47
+		pkt[1] = byte(s.pid >> 8)
+		if first {
+			pkt[1] |= 0x40
+		}
+		pkt[2] = byte(s.pid)
+		pkt[3] = 0x10 | s.cc
+		if field != nil {
+			pkt[3] |= 0x20
+			pkt = append(append(pkt, byte(len(field))), field...)
+		}
+		s.cc = (s.cc + 1) & 0x0f
+
+		out = append(append(out, pkt...), data[:space]...)
+		data = data[space:]
+		first = false
+	}
+	return out
+}
+
+// tsChecksum returns the mpeg-2 crc of a psi section, it has the
+// polynomial of the ogg checksum with all bits set initially
+func tsChecksum(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc = (crc << 8) ^ oggChecksumTable[byte(crc>>24)^b]
+	}
+	return crc
+}
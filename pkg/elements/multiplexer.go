@@ -40,3 +40,8 @@ func (m *Multiplexer) Attach(el avp.Element) {
 func (m *Multiplexer) Close() {
 	m.demux.Close()
 }
+
+// Children returns the multiplexed element
+func (m *Multiplexer) Children() []avp.Element {
+	return []avp.Element{m.el}
+}
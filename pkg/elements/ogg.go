@@ -0,0 +1,267 @@
+package elements
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+)
+
+const (
+	oggPageMaxSegments  = 255
+	oggHeaderTypeBOS    = 0x02
+	oggHeaderTypeEOS    = 0x04
+	opusFillConfig      = 16 // celt 2.5ms
+	defaultPageDuration = time.Second
+)
+
+var oggChecksumTable = func() *[256]uint32 {
+	var table [256]uint32
+	const poly = 0x04c11db7
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = (r << 1) ^ poly
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return &table
+}()
+
+// OggWriterConfig configures an OggWriter
+type OggWriterConfig struct {
+	// Channels of the opus stream. Defaults to 2.
+	Channels uint8
+	// SampleRate of the original input, informational only. Defaults
+	// to 48000.
+	SampleRate uint32
+	// PageDuration is the duration of the packets buffered in a page
+	// before it is flushed. Defaults to 1s.
+	PageDuration time.Duration
+	// PreSkip is the number of priming samples at the start of the
+	// stream that players discard. The samples of a track come from a
+	// running encoder and have none. Defaults to 0.
+	PreSkip uint16
+}
+
+// OggWriter writes the opus samples of a track as an ogg/opus stream.
+// Granule positions are derived from the sample timestamps, gaps in the
+// timestamps, e.g. after dropped packets, are filled with empty opus
+// frames decoders conceal.
+type OggWriter struct {
+	Node
+	mu        sync.Mutex
+	config    OggWriterConfig
+	serial    uint32
+	sequence  uint32
+	started   bool
+	closed    bool
+	timestamp uint32 // expected timestamp of the next sample
+	granule   uint64 // granule position at the end of the last packet
+	pageStart uint64 // granule position at the start of the page
+	segments  []byte
+	data      []byte
+}
+
+// NewOggWriter instance
+func NewOggWriter(config OggWriterConfig) *OggWriter {
+	if config.Channels == 0 {
+		config.Channels = 2
+	}
+	if config.SampleRate == 0 {
+		config.SampleRate = opusClockRate
+	}
+	if config.PageDuration == 0 {
+		config.PageDuration = defaultPageDuration
+	}
+	return &OggWriter{
+		config: config,
+		serial: rand.Uint32(),
+	}
+}
+
+func (w *OggWriter) Write(sample *avp.Sample) error {
+	if sample.Type != avp.TypeOpus {
+		return nil
+	}
+	payload, ok := sample.Payload.([]byte)
+	if !ok {
+		return ErrUnsupportedPayload
+	}
+	duration := opusPacketDuration(payload)
+	if duration == 0 {
+		log.Debugf("Ogg writer dropped invalid opus packet")
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+
+	if !w.started {
+		w.started = true
+		w.timestamp = sample.Timestamp
+		w.granule = uint64(w.config.PreSkip)
+		w.pageStart = w.granule
+		if err := w.writeHeaders(); err != nil {
+			return err
+		}
+	}
+
+	gap := int32(sample.Timestamp - w.timestamp)
+	if gap < 0 {
+		log.Debugf("Ogg writer dropped late opus packet")
+		return nil
+	}
+	if gap > 0 {
+		if sample.PrevDroppedPackets > 0 {
+			log.Debugf("Ogg writer filling gap of %d dropped packets", sample.PrevDroppedPackets)
+		}
+		if err := w.fill(uint32(gap), payload[0]); err != nil {
+			return err
+		}
+	}
+
+	w.timestamp = sample.Timestamp + duration
+	return w.writePacket(payload, duration)
+}
+
+// fill a gap with empty frames of the toc config, the decoder conceals
+// them. The rest of the gap shorter than a frame is filled with 2.5ms
+// frames, so the granule position only advances with packets.
+func (w *OggWriter) fill(gap uint32, toc byte) error {
+	for _, empty := range [][]byte{
+		{toc &^ 0x3}, // one frame, no data
+		{opusFillConfig<<3 | toc&0x4},
+	} {
+		frame := opusPacketDuration(empty)
+		for ; gap >= frame; gap -= frame {
+			if err := w.writePacket(empty, frame); err != nil {
+				return err
+			}
+		}
+	}
+	if gap > 0 {
+		log.Debugf("Ogg writer dropped %d samples of a gap", gap)
+	}
+	return nil
+}
+
+func (w *OggWriter) writeHeaders() error {
+	head := make([]byte, 19)
+	copy(head[0:], opusHeadSignature)
+	head[8] = 1 // version
+	head[9] = w.config.Channels
+	binary.LittleEndian.PutUint16(head[10:], w.config.PreSkip)
+	binary.LittleEndian.PutUint32(head[12:], w.config.SampleRate)
+	binary.LittleEndian.PutUint16(head[16:], 0) // output gain
+	head[18] = 0                                // channel mapping family
+
+	vendor := []byte("ion-avp")
+	tags := make([]byte, 8+4+len(vendor)+4)
+	copy(tags[0:], opusTagsSignature)
+	binary.LittleEndian.PutUint32(tags[8:], uint32(len(vendor)))
+	copy(tags[12:], vendor)
+	binary.LittleEndian.PutUint32(tags[12+len(vendor):], 0) // comments
+
+	// each header is on its own page with a granule position of 0
+	if err := w.writePage(oggHeaderTypeBOS, 0, lacing(len(head)), head); err != nil {
+		return err
+	}
+	return w.writePage(0, 0, lacing(len(tags)), tags)
+}
+
+// writePacket adds a packet to the page, flushing the page when it is
+// full or long enough
+func (w *OggWriter) writePacket(packet []byte, duration uint32) error {
+	segments := lacing(len(packet))
+	if len(w.segments)+len(segments) > oggPageMaxSegments {
+		if err := w.flush(0); err != nil {
+			return err
+		}
+	}
+
+	w.segments = append(w.segments, segments...)
+	w.data = append(w.data, packet...)
+	w.granule += uint64(duration)
+
+	if w.granule-w.pageStart >= uint64(w.config.PageDuration.Seconds()*opusClockRate) {
+		return w.flush(0)
+	}
+	return nil
+}
+
+// flush writes the buffered packets as a page
+func (w *OggWriter) flush(headerType byte) error {
+	if len(w.segments) == 0 && headerType&oggHeaderTypeEOS == 0 {
+		return nil
+	}
+	err := w.writePage(headerType, w.granule, w.segments, w.data)
+	w.segments, w.data = nil, nil
+	w.pageStart = w.granule
+	return err
+}
+
+func (w *OggWriter) writePage(headerType byte, granule uint64, segments, data []byte) error {
+	page := make([]byte, oggPageHeaderLen+len(segments)+len(data))
+	copy(page[0:], oggMagic)
+	page[4] = 0 // version
+	page[5] = headerType
+	binary.LittleEndian.PutUint64(page[6:], granule)
+	binary.LittleEndian.PutUint32(page[14:], w.serial)
+	binary.LittleEndian.PutUint32(page[18:], w.sequence)
+	page[26] = byte(len(segments))
+	copy(page[oggPageHeaderLen:], segments)
+	copy(page[oggPageHeaderLen+len(segments):], data)
+	w.sequence++
+
+	var checksum uint32
+	for _, b := range page {
+		checksum = (checksum << 8) ^ oggChecksumTable[byte(checksum>>24)^b]
+	}
+	binary.LittleEndian.PutUint32(page[22:], checksum)
+
+	return w.Node.Write(&avp.Sample{
+		Type:    TypeBinary,
+		Payload: page,
+	})
+}
+
+// lacing returns the segment sizes of a packet
+func lacing(size int) []byte {
+	segments := make([]byte, size/255+1)
+	for i := range segments[:len(segments)-1] {
+		segments[i] = 255
+	}
+	segments[len(segments)-1] = byte(size % 255)
+	return segments
+}
+
+// Close flushes the last page and closes the children
+func (w *OggWriter) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+
+	if w.started {
+		if err := w.flush(oggHeaderTypeEOS); err != nil {
+			log.Errorf("ogg writer flush err: %s", err)
+		}
+	}
+	w.mu.Unlock()
+
+	w.Node.Close()
+}
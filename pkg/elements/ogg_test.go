@@ -0,0 +1,189 @@
+package elements
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media/oggreader"
+	"github.com/stretchr/testify/assert"
+)
+
+// 20ms celt opus frame
+var rawOpusFrame = []byte{0xf8, 0x01, 0x02, 0x03}
+
+func TestOggWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.ogg")
+	writer := NewOggWriter(OggWriterConfig{PageDuration: 40 * time.Millisecond})
+	writer.Attach(NewFileWriter(path, 0))
+
+	// other codecs are ignored
+	assert.NoError(t, writer.Write(&avp.Sample{Type: avp.TypeVP8, Payload: rawVP8KeyframePkt}))
+
+	// the timestamps wrap around, two packets are dropped
+	for _, s := range []struct {
+		ts      uint32
+		dropped uint16
+	}{{4294966336, 0}, {0, 0}, {2880, 2}} {
+		assert.NoError(t, writer.Write(&avp.Sample{
+			Type:               avp.TypeOpus,
+			Timestamp:          s.ts,
+			PrevDroppedPackets: s.dropped,
+			Payload:            rawOpusFrame,
+		}))
+	}
+	writer.Close()
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	reader, header, err := oggreader.NewWith(f)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(2), header.Channels)
+	// the stream of a running encoder has no priming samples
+	assert.Equal(t, uint16(0), header.PreSkip)
+	assert.Equal(t, uint32(48000), header.SampleRate)
+
+	// tags page
+	_, page, err := reader.ParseNextPage()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), page.GranulePosition)
+
+	// pages of two packets, the last page is flushed on close
+	var granules []uint64
+	var sizes []int
+	for {
+		payload, page, err := reader.ParseNextPage()
+		if err != nil {
+			break
+		}
+		granules = append(granules, page.GranulePosition)
+		sizes = append(sizes, len(payload))
+	}
+	assert.Equal(t, []uint64{1920, 3840, 4800}, granules)
+	// the gap is filled with empty frames
+	assert.Equal(t, []int{8, 2, 4}, sizes)
+
+	// packets are split by the file source
+	collector := runFileSource(t, path)
+	assert.Len(t, collector.samples, 5)
+	assert.Equal(t, []byte{0xf8}, collector.samples[2].Payload)
+	assert.Equal(t, uint32(3840), collector.samples[4].Timestamp)
+}
+
+func TestOggWriter_Gaps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.ogg")
+	writer := NewOggWriter(OggWriterConfig{PreSkip: 312})
+	writer.Attach(NewFileWriter(path, 0))
+
+	// a gap of 6s and 5ms
+	for _, ts := range []uint32{0, 960 + 6*48000 + 240} {
+		assert.NoError(t, writer.Write(&avp.Sample{Type: avp.TypeOpus, Timestamp: ts, Payload: rawOpusFrame}))
+	}
+	writer.Close()
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	reader, header, err := oggreader.NewWith(f)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(312), header.PreSkip)
+
+	var granule uint64
+	for {
+		_, page, err := reader.ParseNextPage()
+		if err != nil {
+			break
+		}
+		granule = page.GranulePosition
+	}
+	assert.Equal(t, uint64(312+960+6*48000+240+960), granule)
+
+	// the whole gap is filled with packets, 20ms frames of the stream
+	// and 2.5ms frames for the rest
+	collector := runFileSource(t, path)
+	assert.Len(t, collector.samples, 2+300+2)
+	assert.Equal(t, []byte{0xf8}, collector.samples[1].Payload)
+	assert.Equal(t, []byte{0x80}, collector.samples[301].Payload)
+	assert.Equal(t, uint32(960+6*48000+240), collector.samples[303].Timestamp)
+}
+
+func TestOggWriter_AcrossReconnect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.ogg")
+	recorder := &sampleCollector{}
+	avp.Init(map[string]avp.ElementFun{"ogg": func(sid, pid, tid string, config []byte) avp.Element {
+		writer := NewOggWriter(OggWriterConfig{})
+		writer.Attach(NewFileWriter(path, 0))
+		writer.Attach(recorder)
+		return writer
+	}})
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0}
+	listener, err := net.ListenUDP("udp", addr)
+	assert.NoError(t, err)
+	addr = listener.LocalAddr().(*net.UDPAddr)
+	assert.NoError(t, listener.Close())
+
+	transport, err := avp.NewRTPTransport("camera", avp.Config{}, []avp.RTPStream{{
+		ID:   "audio",
+		Kind: webrtc.RTPCodecTypeAudio,
+		Addr: addr,
+		Codecs: []webrtc.RTPCodecParameters{{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: avp.MimeTypeOpus, ClockRate: 48000},
+			PayloadType:        111,
+		}},
+	}})
+	assert.NoError(t, err)
+	assert.NoError(t, transport.Process("pid", "audio", "ogg", nil))
+
+	conn, err := net.DialUDP("udp", nil, addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+	send := func(ssrc uint32, seq uint16, ts uint32) {
+		for i := uint16(0); i < 10; i++ {
+			raw, err := (&rtp.Packet{
+				Header:  rtp.Header{Version: 2, PayloadType: 111, SequenceNumber: seq + i, Timestamp: ts + uint32(i)*960, SSRC: ssrc},
+				Payload: rawOpusFrame,
+			}).Marshal()
+			assert.NoError(t, err)
+			_, err = conn.Write(raw)
+			assert.NoError(t, err)
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// the sender restarts with a new ssrc, sequence and timestamp base
+	// after the track went idle
+	send(1234, 100, 4294960000)
+	time.Sleep(2500 * time.Millisecond)
+	send(5678, 40000, 123456)
+	time.Sleep(100 * time.Millisecond)
+
+	assert.NoError(t, transport.Close())
+	assert.Eventually(t, func() bool {
+		recorder.Lock()
+		defer recorder.Unlock()
+		return recorder.closed
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the frames of both senders are kept and the time the track was
+	// gone is filled with empty frames
+	var frames, empty int
+	for _, sample := range runFileSource(t, path).samples {
+		switch len(sample.Payload.([]byte)) {
+		case len(rawOpusFrame):
+			frames++
+		case 1:
+			empty++
+		}
+	}
+	assert.Equal(t, 18, frames)
+	assert.True(t, empty >= 2500/20 && empty < 5000/20, "%d empty frames", empty)
+}
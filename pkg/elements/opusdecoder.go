@@ -0,0 +1,152 @@
+// +build libopus
+
+package elements
+
+/*
+#cgo pkg-config: opus
+#include <opus.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+)
+
+const (
+	// max duration of an opus packet, 120ms
+	opusMaxFrameDuration = 120
+	// dropped packets concealed at most, longer gaps are skipped
+	opusMaxConcealedPackets = 50
+)
+
+// opusStream is the decoder state of the samples of a track
+type opusStream struct {
+	dec  *C.OpusDecoder
+	last int // samples per channel of the last packet
+}
+
+// OpusDecoder instance
+type OpusDecoder struct {
+	sync.Mutex
+	Node
+	streams    map[string]*opusStream // by sample id
+	sampleRate int
+	channels   int
+	closed     bool
+}
+
+// NewOpusDecoder instance. OpusDecoder takes as input opus streams and
+// decodes them into PCM samples of the sample rate and channels, one
+// of 8000, 12000, 16000, 24000 or 48000 and 1 or 2. Each track is
+// decoded by its own decoder.
+func NewOpusDecoder(sampleRate, channels int) *OpusDecoder {
+	return &OpusDecoder{
+		streams:    make(map[string]*opusStream),
+		sampleRate: sampleRate,
+		channels:   channels,
+	}
+}
+
+func opusError(code C.int) error {
+	return fmt.Errorf("opus: %s", C.GoString(C.opus_strerror(code)))
+}
+
+func (dec *OpusDecoder) Write(sample *avp.Sample) error {
+	if sample.Type != avp.TypeOpus {
+		return nil
+	}
+	payload, ok := sample.Payload.([]byte)
+	if !ok {
+		return ErrUnsupportedPayload
+	}
+
+	dec.Lock()
+	defer dec.Unlock()
+
+	if dec.closed {
+		return nil
+	}
+	stream := dec.streams[sample.ID]
+	if stream == nil {
+		var code C.int
+		d := C.opus_decoder_create(C.opus_int32(dec.sampleRate), C.int(dec.channels), &code)
+		if code != C.OPUS_OK {
+			return opusError(code)
+		}
+		stream = &opusStream{dec: d}
+		dec.streams[sample.ID] = stream
+	}
+
+	// conceal the dropped packets with the duration of the last one,
+	// the packet before this one is recovered from its fec data
+	dropped := int(sample.PrevDroppedPackets)
+	if dropped > opusMaxConcealedPackets {
+		log.Debugf("Opus decoder skipped %d dropped packets", dropped)
+		dropped = 0
+	}
+	for i := dropped; i > 0 && stream.last > 0; i-- {
+		timestamp := sample.Timestamp - uint32(i*stream.last*opusClockRate/dec.sampleRate)
+		var data []byte
+		if i == 1 {
+			data = payload
+		}
+		if err := dec.decode(stream, data, stream.last, i == 1, timestamp, sample.ID); err != nil {
+			return err
+		}
+	}
+
+	return dec.decode(stream, payload, dec.sampleRate*opusMaxFrameDuration/1000, false, sample.Timestamp, sample.ID)
+}
+
+// decode writes the pcm of a packet of a stream, of its fec data when
+// fec is set. A nil packet is concealed.
+func (dec *OpusDecoder) decode(stream *opusStream, data []byte, frameSize int, fec bool, timestamp uint32, id string) error {
+	pcm := make([]int16, frameSize*dec.channels)
+
+	var n C.int
+	if data == nil {
+		n = C.opus_decode(stream.dec, nil, 0, (*C.opus_int16)(&pcm[0]), C.int(frameSize), 0)
+	} else if len(data) > 0 {
+		decodeFEC := C.int(0)
+		if fec {
+			decodeFEC = 1
+		}
+		n = C.opus_decode(stream.dec, (*C.uchar)(&data[0]), C.opus_int32(len(data)), (*C.opus_int16)(&pcm[0]), C.int(frameSize), decodeFEC)
+	}
+	if n < 0 {
+		return opusError(n)
+	}
+	if n == 0 {
+		return nil
+	}
+	if !fec && data != nil {
+		stream.last = int(n)
+	}
+
+	return dec.Node.Write(&avp.Sample{
+		ID:        id,
+		Type:      TypePCM,
+		Timestamp: timestamp,
+		Payload: PCM{
+			Data:       pcm[:int(n)*dec.channels],
+			SampleRate: dec.sampleRate,
+			Channels:   dec.channels,
+		},
+	})
+}
+
+func (dec *OpusDecoder) Close() {
+	dec.Lock()
+	for id, stream := range dec.streams {
+		C.opus_decoder_destroy(stream.dec)
+		delete(dec.streams, id)
+	}
+	dec.closed = true
+	dec.Unlock()
+
+	dec.Node.Close()
+}
@@ -0,0 +1,91 @@
+// +build libopus
+
+package elements
+
+import (
+	"testing"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// 20ms and 10ms mono celt opus packets of silence
+var (
+	rawOpusSilence     = []byte{0xf8, 0xff, 0xfe}
+	rawOpusSilence10ms = []byte{0xf0, 0xff, 0xfe}
+)
+
+func TestOpusDecoder(t *testing.T) {
+	decoder := NewOpusDecoder(48000, 2)
+	recorder := &sampleCollector{}
+	decoder.Attach(recorder)
+
+	// other samples are ignored
+	assert.NoError(t, decoder.Write(&avp.Sample{Type: avp.TypeVP8, Payload: rawVP8KeyframePkt}))
+	assert.Equal(t, ErrUnsupportedPayload, decoder.Write(&avp.Sample{Type: avp.TypeOpus, Payload: "packet"}))
+
+	assert.NoError(t, decoder.Write(&avp.Sample{ID: "audio", Type: avp.TypeOpus, Timestamp: 1000, Payload: rawOpusSilence}))
+	// the dropped packet is recovered before the packet
+	assert.NoError(t, decoder.Write(&avp.Sample{ID: "audio", Type: avp.TypeOpus, Timestamp: 1000 + 2*960, PrevDroppedPackets: 1, Payload: rawOpusSilence}))
+	decoder.Close()
+	assert.True(t, recorder.closed)
+
+	var timestamps []uint32
+	for _, sample := range recorder.samples {
+		assert.Equal(t, "audio", sample.ID)
+		assert.Equal(t, TypePCM, sample.Type)
+		pcm := sample.Payload.(PCM)
+		assert.Equal(t, 48000, pcm.SampleRate)
+		assert.Equal(t, 2, pcm.Channels)
+		assert.Len(t, pcm.Data, 960*2)
+		timestamps = append(timestamps, sample.Timestamp)
+	}
+	assert.Equal(t, []uint32{1000, 1960, 2920}, timestamps)
+}
+
+func TestOpusDecoder_SampleRate(t *testing.T) {
+	decoder := NewOpusDecoder(16000, 1)
+	recorder := &sampleCollector{}
+	decoder.Attach(recorder)
+
+	assert.NoError(t, decoder.Write(&avp.Sample{Type: avp.TypeOpus, Timestamp: 960, Payload: rawOpusSilence}))
+	decoder.Close()
+
+	assert.Len(t, recorder.samples, 1)
+	pcm := recorder.samples[0].Payload.(PCM)
+	assert.Equal(t, 16000, pcm.SampleRate)
+	assert.Len(t, pcm.Data, 320)
+	// the timestamps stay in the 48khz rtp clock
+	assert.Equal(t, uint32(960), recorder.samples[0].Timestamp)
+}
+
+func TestOpusDecoder_Tracks(t *testing.T) {
+	decoder := NewOpusDecoder(48000, 1)
+	recorder := &sampleCollector{}
+	decoder.Attach(recorder)
+
+	// each track is concealed with the duration of its own packets
+	assert.NoError(t, decoder.Write(&avp.Sample{ID: "a", Type: avp.TypeOpus, Timestamp: 1000, Payload: rawOpusSilence}))
+	assert.NoError(t, decoder.Write(&avp.Sample{ID: "b", Type: avp.TypeOpus, Timestamp: 5000, Payload: rawOpusSilence10ms}))
+	assert.NoError(t, decoder.Write(&avp.Sample{ID: "a", Type: avp.TypeOpus, Timestamp: 1000 + 3*960, PrevDroppedPackets: 2, Payload: rawOpusSilence}))
+	assert.NoError(t, decoder.Write(&avp.Sample{ID: "b", Type: avp.TypeOpus, Timestamp: 5000 + 2*480, PrevDroppedPackets: 1, Payload: rawOpusSilence10ms}))
+	decoder.Lock()
+	assert.Len(t, decoder.streams, 2)
+	decoder.Unlock()
+	decoder.Close()
+
+	timestamps := map[string][]uint32{}
+	sizes := map[string][]int{}
+	for _, sample := range recorder.samples {
+		timestamps[sample.ID] = append(timestamps[sample.ID], sample.Timestamp)
+		sizes[sample.ID] = append(sizes[sample.ID], len(sample.Payload.(PCM).Data))
+	}
+	assert.Equal(t, []uint32{1000, 1960, 2920, 3880}, timestamps["a"])
+	assert.Equal(t, []int{960, 960, 960, 960}, sizes["a"])
+	assert.Equal(t, []uint32{5000, 5480, 5960}, timestamps["b"])
+	assert.Equal(t, []int{480, 480, 480}, sizes["b"])
+
+	decoder.Lock()
+	assert.Empty(t, decoder.streams)
+	decoder.Unlock()
+}
@@ -0,0 +1,491 @@
+package elements
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+)
+
+// Segment formats of a Packager
+const (
+	PackagerFMP4 = "fmp4"
+	PackagerTS   = "ts"
+)
+
+const (
+	defaultSegmentDuration = 4 * time.Second
+	packagerPlaylist       = "index.m3u8"
+	packagerManifest       = "manifest.mpd"
+	packagerInit           = "init.mp4"
+)
+
+// PackagerConfig configures a Packager
+type PackagerConfig struct {
+	// Dir the segments and playlists are written to
+	Dir string
+	// Format of the segments, PackagerFMP4 by default. TS segments
+	// have the h264 and opus tracks only.
+	Format string
+	// SegmentDuration is the target duration of the segments, they are
+	// cut on the video keyframes. Defaults to 4s.
+	SegmentDuration time.Duration
+	// WindowSize is the number of segments of a live playlist, older
+	// segments are removed. 0 keeps all of them in an event playlist,
+	// which is a vod playlist once closed.
+	WindowSize int
+	// DASH writes a DASH manifest next to the HLS playlist, fmp4 only
+	DASH bool
+	// AudioOnly or VideoOnly is the kind of the expected tracks
+	AudioOnly bool
+	VideoOnly bool
+}
+
+type packagerSegment struct {
+	index    int
+	start    time.Duration
+	duration time.Duration
+	size     int64
+}
+
+// packagerSink receives the init segment and fragments of the mp4 muxer
+// of a packager
+type packagerSink struct {
+	Leaf
+	p *Packager
+}
+
+func (s *packagerSink) Write(sample *avp.Sample) error {
+	payload, ok := sample.Payload.([]byte)
+	if !ok {
+		return ErrUnsupportedPayload
+	}
+	return s.p.writeFragment(payload)
+}
+
+func (s *packagerSink) Close() {}
+
+// Packager writes the samples of a session as HLS, and optionally DASH,
+// segments and playlists to a directory
+type Packager struct {
+	Leaf
+	mu     sync.Mutex
+	config PackagerConfig
+
+	muxer       *MP4Muxer
+	initialized bool
+	codecs      []string
+	video       bool
+
+	ts      *tsMuxer
+	tsStart uint64 // pts of the first reference sample of the segment
+	tsLast  uint64
+	tsDelta uint64
+	dropped int // audio samples dropped waiting for a video keyframe
+
+	file     *os.File
+	segment  packagerSegment
+	segments []packagerSegment
+	removed  []packagerSegment // out of the window, kept for late players
+	index    int
+	elapsed  time.Duration
+	target   int // target duration in seconds
+	start    time.Time
+	closed   bool
+}
+
+// NewPackager instance
+func NewPackager(config PackagerConfig) *Packager {
+	if config.SegmentDuration == 0 {
+		config.SegmentDuration = defaultSegmentDuration
+	}
+	if config.Format != PackagerTS {
+		if config.Format != "" && config.Format != PackagerFMP4 {
+			log.Warnf("Packager format %s not supported, using %s", config.Format, PackagerFMP4)
+		}
+		config.Format = PackagerFMP4
+	}
+
+	p := &Packager{
+		config: config,
+		target: int(math.Ceil(config.SegmentDuration.Seconds())),
+	}
+	if config.Format == PackagerTS {
+		if config.DASH {
+			log.Warnf("Packager DASH manifest not supported with ts segments")
+		}
+		p.ts = newTSMuxer(!config.AudioOnly, !config.VideoOnly)
+		p.video = p.ts.video != nil
+	} else {
+		p.muxer = NewMP4Muxer(MP4MuxerConfig{
+			AudioOnly:        config.AudioOnly,
+			VideoOnly:        config.VideoOnly,
+			FragmentDuration: config.SegmentDuration,
+		})
+		p.muxer.Attach(&packagerSink{p: p})
+	}
+	return p
+}
+
+func (p *Packager) Write(sample *avp.Sample) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	if p.muxer != nil {
+		return p.muxer.Write(sample)
+	}
+
+	payload, ok := sample.Payload.([]byte)
+	if !ok {
+		return ErrUnsupportedPayload
+	}
+	return p.writeTS(sample, payload)
+}
+
+// writeFragment writes the init segment, then the fragments of the mp4
+// muxer to the segments. The fragments start on keyframes.
+func (p *Packager) writeFragment(data []byte) error {
+	if !p.initialized {
+		p.initialized = true
+		for _, t := range p.muxer.tracks {
+			p.codecs = append(p.codecs, t.codec)
+			if !t.audio() {
+				p.video = true
+			}
+		}
+		return p.writeFile(packagerInit, data)
+	}
+
+	if p.file == nil {
+		if err := p.openSegment(); err != nil {
+			return err
+		}
+	}
+	if err := p.writeSegment(data); err != nil {
+		return err
+	}
+	p.segment.duration += p.muxer.fragmentDuration
+
+	if p.segment.duration >= p.config.SegmentDuration {
+		return p.cut()
+	}
+	return nil
+}
+
+// writeTS writes a sample to the ts segments, they are cut on the
+// video keyframes or the audio samples when there is no video
+func (p *Packager) writeTS(sample *avp.Sample, payload []byte) error {
+	s := p.ts.stream(sample.Type)
+	if s == nil {
+		return nil
+	}
+	// the first track of each kind
+	if s.id == "" {
+		s.id = sample.ID
+	} else if s.id != sample.ID {
+		return nil
+	}
+
+	video := p.ts.video
+	key := s == p.ts.audio && video == nil || s == video && isKeyframe(s.typ, payload)
+	if video != nil && !video.started && !key {
+		if s != video {
+			if p.dropped++; p.dropped >= maxBufferedSamples {
+				log.Warnf("Packager received no video keyframe, packaging audio only")
+				p.ts.video, p.video = nil, false
+			}
+		}
+		return nil
+	}
+
+	pts, ok := s.pts(sample.Timestamp)
+	if !ok {
+		log.Debugf("Packager dropped late sample of track %s", sample.ID)
+		return nil
+	}
+
+	if s == p.ts.video || p.ts.video == nil {
+		if p.file != nil && key {
+			p.segment.duration = time.Duration(pts-p.tsStart) * time.Second / videoClockRate
+			if p.segment.duration >= p.config.SegmentDuration {
+				if err := p.cut(); err != nil {
+					return err
+				}
+			}
+		}
+		if p.file == nil {
+			if err := p.openSegment(); err != nil {
+				return err
+			}
+			if err := p.writeSegment(p.ts.tables()); err != nil {
+				return err
+			}
+			p.tsStart = pts
+		} else {
+			p.tsDelta = pts - p.tsLast
+		}
+		p.tsLast = pts
+	}
+
+	return p.writeSegment(p.ts.pes(s, pts, key, payload))
+}
+
+func (p *Packager) segmentName(index int) string {
+	if p.config.Format == PackagerTS {
+		return fmt.Sprintf("segment-%05d.ts", index)
+	}
+	return fmt.Sprintf("segment-%05d.m4s", index)
+}
+
+func (p *Packager) openSegment() error {
+	if err := os.MkdirAll(p.config.Dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(p.config.Dir, p.segmentName(p.index)), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if p.start.IsZero() {
+		p.start = time.Now()
+	}
+	p.file = f
+	p.segment = packagerSegment{
+		index: p.index,
+		start: p.elapsed,
+	}
+	p.index++
+	return nil
+}
+
+func (p *Packager) writeSegment(data []byte) error {
+	n, err := p.file.Write(data)
+	p.segment.size += int64(n)
+	return err
+}
+
+// closeSegment adds the segment to the playlist, the segments out of
+// the window are removed
+func (p *Packager) closeSegment() error {
+	err := p.file.Close()
+	p.file = nil
+
+	p.elapsed += p.segment.duration
+	// the rounded durations don't exceed the target duration
+	if target := int(math.Round(p.segment.duration.Seconds())); target > p.target {
+		p.target = target
+	}
+	p.segments = append(p.segments, p.segment)
+
+	if size := p.config.WindowSize; size > 0 && len(p.segments) > size {
+		p.removed = append(p.removed, p.segments[0])
+		p.segments = p.segments[1:]
+		if len(p.removed) > size {
+			if err := os.Remove(filepath.Join(p.config.Dir, p.segmentName(p.removed[0].index))); err != nil {
+				log.Warnf("Packager error removing segment: %s", err)
+			}
+			p.removed = p.removed[1:]
+		}
+	}
+	return err
+}
+
+// cut closes the segment and updates the playlists
+func (p *Packager) cut() error {
+	if err := p.closeSegment(); err != nil {
+		return err
+	}
+	return p.writePlaylists()
+}
+
+func (p *Packager) writePlaylists() error {
+	if err := p.writeFile(packagerPlaylist, []byte(p.hls())); err != nil {
+		return err
+	}
+	if p.config.DASH && p.muxer != nil {
+		return p.writeFile(packagerManifest, []byte(p.mpd()))
+	}
+	return nil
+}
+
+// writeFile replaces a file of the directory, players never read a
+// partial playlist
+func (p *Packager) writeFile(name string, data []byte) error {
+	return replaceFile(filepath.Join(p.config.Dir, name), data)
+}
+
+// replaceFile writes a file through a temporary file renamed over it,
+// readers get either the previous or the new content. The directory is
+// created.
+func replaceFile(path string, data []byte) error {
+	dir, name := filepath.Split(path)
+	if err := os.MkdirAll(filepath.Clean(dir), 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "."+name)
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// hls returns the media playlist
+func (p *Packager) hls() string {
+	var b strings.Builder
+	version := 3
+	if p.muxer != nil {
+		version = 7
+	}
+	sequence := p.index
+	if len(p.segments) > 0 {
+		sequence = p.segments[0].index
+	}
+
+	b.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", version)
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", p.target)
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", sequence)
+	if p.config.WindowSize == 0 {
+		if p.closed {
+			b.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+		} else {
+			b.WriteString("#EXT-X-PLAYLIST-TYPE:EVENT\n")
+		}
+	}
+	b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	if p.muxer != nil {
+		fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s\"\n", packagerInit)
+	}
+	for _, s := range p.segments {
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", s.duration.Seconds(), p.segmentName(s.index))
+	}
+	if p.closed {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	return b.String()
+}
+
+// mpd returns the DASH manifest, with a representation of the muxed
+// tracks
+func (p *Packager) mpd() string {
+	var b strings.Builder
+	duration := func(d time.Duration) string {
+		return fmt.Sprintf("PT%.3fS", d.Seconds())
+	}
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011"`)
+	if p.closed {
+		fmt.Fprintf(&b, ` type="static" mediaPresentationDuration="%s"`, duration(p.elapsed))
+	} else {
+		fmt.Fprintf(&b, ` type="dynamic" availabilityStartTime="%s" publishTime="%s" minimumUpdatePeriod="%s"`,
+			p.start.UTC().Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339), duration(p.config.SegmentDuration))
+		if size := p.config.WindowSize; size > 0 {
+			fmt.Fprintf(&b, ` timeShiftBufferDepth="%s"`, duration(time.Duration(size)*p.config.SegmentDuration))
+		}
+	}
+	fmt.Fprintf(&b, ` minBufferTime="%s">`+"\n", duration(p.config.SegmentDuration))
+
+	mimeType := "audio/mp4"
+	if p.video {
+		mimeType = "video/mp4"
+	}
+	bandwidth := int64(0)
+	start := 0
+	for i, s := range p.segments {
+		if i == 0 {
+			start = s.index
+		}
+		if s.duration > 0 {
+			if bps := s.size * 8 * int64(time.Second) / int64(s.duration); bps > bandwidth {
+				bandwidth = bps
+			}
+		}
+	}
+
+	b.WriteString(`  <Period id="0" start="PT0S">` + "\n")
+	fmt.Fprintf(&b, `    <AdaptationSet mimeType="%s" segmentAlignment="true" startWithSAP="1">`+"\n", mimeType)
+	fmt.Fprintf(&b, `      <Representation id="0" codecs="%s" bandwidth="%d">`+"\n", strings.Join(p.codecs, ","), bandwidth)
+	fmt.Fprintf(&b, `        <SegmentTemplate timescale="1000" initialization="%s" media="segment-$Number%%05d$.m4s" startNumber="%d">`+"\n",
+		packagerInit, start)
+	b.WriteString("          <SegmentTimeline>\n")
+	for _, s := range p.segments {
+		t := s.start.Milliseconds()
+		fmt.Fprintf(&b, `            <S t="%d" d="%d"/>`+"\n", t, (s.start+s.duration).Milliseconds()-t)
+	}
+	b.WriteString("          </SegmentTimeline>\n")
+	b.WriteString("        </SegmentTemplate>\n")
+	b.WriteString("      </Representation>\n")
+	b.WriteString("    </AdaptationSet>\n")
+	b.WriteString("  </Period>\n")
+	b.WriteString("</MPD>\n")
+	return b.String()
+}
+
+// Close writes the last segment and ends the playlists
+func (p *Packager) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+
+	if p.muxer != nil {
+		// flushes the last fragment
+		p.muxer.Close()
+	} else if p.file != nil {
+		p.segment.duration = time.Duration(p.tsLast+p.tsDelta-p.tsStart) * time.Second / videoClockRate
+	}
+
+	if p.file != nil {
+		if err := p.closeSegment(); err != nil {
+			log.Errorf("Packager error closing segment: %s", err)
+		}
+	}
+	if len(p.segments) > 0 {
+		if err := p.writePlaylists(); err != nil {
+			log.Errorf("Packager error writing playlists: %s", err)
+		}
+	}
+}
+
+// NewPackagerHandler returns a handler serving the playlists and
+// segments of the packagers writing to dir
+func NewPackagerHandler(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		h := w.Header()
+		switch path.Ext(r.URL.Path) {
+		case ".m3u8":
+			h.Set("Content-Type", "application/vnd.apple.mpegurl")
+			h.Set("Cache-Control", "no-cache")
+		case ".mpd":
+			h.Set("Content-Type", "application/dash+xml")
+			h.Set("Cache-Control", "no-cache")
+		case ".mp4", ".m4s":
+			h.Set("Content-Type", "video/mp4")
+		case ".ts":
+			h.Set("Content-Type", "video/mp2t")
+		}
+		h.Set("Access-Control-Allow-Origin", "*")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,168 @@
+package elements
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeLive writes 5s of 30 fps h264 with a keyframe every 0.5s and
+// 20ms opus frames
+func writeLive(t *testing.T, e avp.Element) {
+	audio := 0
+	for i := 0; i < 150; i++ {
+		payload := annexB(rawH264P)
+		if i%15 == 0 {
+			payload = annexB(rawH264SPS, rawH264PPS, rawH264IDR)
+		}
+		assert.NoError(t, e.Write(&avp.Sample{ID: "video", Type: avp.TypeH264, Timestamp: uint32(i * 3000), Payload: payload}))
+		// the opus frames before the next video frame
+		for ; audio*3 < (i+1)*5; audio++ {
+			assert.NoError(t, e.Write(&avp.Sample{ID: "audio", Type: avp.TypeOpus, Timestamp: uint32(audio * 960), Payload: rawOpusFrame}))
+		}
+	}
+}
+
+func TestPackager_FMP4(t *testing.T) {
+	dir := t.TempDir()
+	p := NewPackager(PackagerConfig{
+		Dir:             dir,
+		SegmentDuration: time.Second,
+		WindowSize:      2,
+		DASH:            true,
+	})
+	writeLive(t, p)
+
+	// the live playlists are written as segments are cut
+	playlist, err := ioutil.ReadFile(filepath.Join(dir, packagerPlaylist))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(playlist), "#EXT-X-ENDLIST")
+	manifest, err := ioutil.ReadFile(filepath.Join(dir, packagerManifest))
+	assert.NoError(t, err)
+	assert.Contains(t, string(manifest), `type="dynamic"`)
+
+	p.Close()
+
+	playlist, err = ioutil.ReadFile(filepath.Join(dir, packagerPlaylist))
+	assert.NoError(t, err)
+	assert.Equal(t, `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:1
+#EXT-X-MEDIA-SEQUENCE:3
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:1.000,
+segment-00003.m4s
+#EXTINF:1.000,
+segment-00004.m4s
+#EXT-X-ENDLIST
+`, string(playlist))
+
+	manifest, err = ioutil.ReadFile(filepath.Join(dir, packagerManifest))
+	assert.NoError(t, err)
+	assert.Contains(t, string(manifest), `type="static" mediaPresentationDuration="PT5.000S"`)
+	assert.Contains(t, string(manifest), `codecs="avc1.42c01e,opus"`)
+	assert.Contains(t, string(manifest), `startNumber="3"`)
+	assert.Contains(t, string(manifest), `<S t="3000" d="1000"/>`)
+	assert.Contains(t, string(manifest), `<S t="4000" d="1000"/>`)
+
+	init, err := ioutil.ReadFile(filepath.Join(dir, packagerInit))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ftyp", "moov"}, parseMP4(t, init).types())
+
+	// segments out of the window are kept for a window
+	_, err = os.Stat(filepath.Join(dir, "segment-00000.m4s"))
+	assert.True(t, os.IsNotExist(err))
+	for _, name := range []string{"segment-00001.m4s", "segment-00002.m4s", "segment-00003.m4s", "segment-00004.m4s"} {
+		segment, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		// two fragments of 0.5s
+		assert.Equal(t, []string{"moof", "mdat", "moof", "mdat"}, parseMP4(t, segment).types())
+	}
+}
+
+func TestPackager_TS(t *testing.T) {
+	dir := t.TempDir()
+	p := NewPackager(PackagerConfig{
+		Dir:             dir,
+		Format:          PackagerTS,
+		SegmentDuration: time.Second,
+	})
+	writeLive(t, p)
+	p.Close()
+
+	playlist, err := ioutil.ReadFile(filepath.Join(dir, packagerPlaylist))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(playlist), `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:1
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXTINF:1.000,
+segment-00000.ts
+`), string(playlist))
+	assert.Equal(t, 5, strings.Count(string(playlist), "#EXTINF:1.000,"))
+	assert.True(t, strings.HasSuffix(string(playlist), "segment-00004.ts\n#EXT-X-ENDLIST\n"))
+
+	for i := 0; i < 5; i++ {
+		segment, err := ioutil.ReadFile(filepath.Join(dir, p.segmentName(i)))
+		assert.NoError(t, err)
+		if !assert.Equal(t, 0, len(segment)%tsPacketSize) {
+			continue
+		}
+
+		counters := map[uint16]byte{}
+		var pids []uint16
+		for off := 0; off < len(segment); off += tsPacketSize {
+			pkt := segment[off : off+tsPacketSize]
+			assert.Equal(t, byte(0x47), pkt[0])
+			pid := binary.BigEndian.Uint16(pkt[1:]) & 0x1fff
+			if cc, ok := counters[pid]; ok {
+				assert.Equal(t, (cc+1)&0x0f, pkt[3]&0x0f, "continuity counter")
+			}
+			counters[pid] = pkt[3] & 0x0f
+			if pkt[1]&0x40 != 0 {
+				pids = append(pids, pid)
+			}
+		}
+
+		// tables, then a video keyframe
+		assert.Equal(t, []uint16{0, tsPMTPID, tsVideoPID}, pids[:3])
+		assert.Contains(t, pids, uint16(tsAudioPID))
+		for _, table := range [][]byte{segment[5:tsPacketSize], segment[tsPacketSize+5:]} {
+			length := int(binary.BigEndian.Uint16(table[1:])&0x0fff) + 3
+			assert.Equal(t, uint32(0), tsChecksum(table[:length]), "section crc")
+		}
+		key := segment[2*tsPacketSize:]
+		assert.Equal(t, byte(0x30), key[3]&0xf0, "adaptation field and payload")
+		assert.Equal(t, byte(0x50), key[5], "random access and pcr")
+	}
+}
+
+func TestPackagerHandler(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, packagerPlaylist), []byte("#EXTM3U\n"), 0644))
+
+	handler := NewPackagerHandler(dir)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+packagerPlaylist, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/vnd.apple.mpegurl", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", rec.Header().Get("Cache-Control"))
+	assert.Equal(t, "#EXTM3U\n", rec.Body.String())
+
+	// no directory listing
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,129 @@
+package elements
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+
+	avp "github.com/pion/ion-avp/pkg"
+)
+
+// PCMFormat is the sample format of raw pcm data
+type PCMFormat int
+
+// Sample formats of raw pcm data
+const (
+	// PCMFormatS16LE is signed 16-bit little endian
+	PCMFormatS16LE PCMFormat = iota
+	// PCMFormatF32LE is 32-bit float little endian, from -1 to 1
+	PCMFormatF32LE
+	// PCMFormatMuLaw is 8-bit g.711 mu-law
+	PCMFormatMuLaw
+)
+
+// size returns the bytes per sample of the format
+func (f PCMFormat) size() int {
+	switch f {
+	case PCMFormatF32LE:
+		return 4
+	case PCMFormatMuLaw:
+		return 1
+	}
+	return 2
+}
+
+// encode returns the raw data of pcm samples in the format
+func (f PCMFormat) encode(data []int16) []byte {
+	out := make([]byte, len(data)*f.size())
+	for i, s := range data {
+		switch f {
+		case PCMFormatF32LE:
+			binary.LittleEndian.PutUint32(out[i*4:], math.Float32bits(float32(s)/32768))
+		case PCMFormatMuLaw:
+			out[i] = muLaw(s)
+		default:
+			binary.LittleEndian.PutUint16(out[i*2:], uint16(s))
+		}
+	}
+	return out
+}
+
+// muLaw returns the g.711 mu-law code of a sample
+func muLaw(s int16) byte {
+	const bias, clip = 0x84, 32635
+	v := int(s)
+	var sign byte
+	if v < 0 {
+		v, sign = -v, 0x80
+	}
+	if v > clip {
+		v = clip
+	}
+	v += bias
+	exponent := bits.Len(uint(v>>7)) - 1
+	mantissa := (v >> (exponent + 3)) & 0x0f
+	return ^(sign | byte(exponent<<4) | byte(mantissa))
+}
+
+// remix returns interleaved samples with other channels. Channels are
+// spread over more channels or averaged to fewer channels.
+func remix(data []int16, from, to int) []int16 {
+	if from == to {
+		return data
+	}
+	n := len(data) / from
+	out := make([]int16, n*to)
+	if to > from {
+		for i := 0; i < n; i++ {
+			for c := 0; c < to; c++ {
+				out[i*to+c] = data[i*from+c%from]
+			}
+		}
+		return out
+	}
+	for i := 0; i < n; i++ {
+		for c := 0; c < to; c++ {
+			var sum, count int
+			for in := c; in < from; in += to {
+				sum += int(data[i*from+in])
+				count++
+			}
+			out[i*to+c] = int16(sum / count)
+		}
+	}
+	return out
+}
+
+// RawPCMWriter writes the PCM samples of a track as raw interleaved data
+// without header, e.g. for ffmpeg -f s16le or f32le
+type RawPCMWriter struct {
+	Node
+	format PCMFormat
+}
+
+// NewRawPCMWriter instance
+func NewRawPCMWriter(format PCMFormat) *RawPCMWriter {
+	return &RawPCMWriter{
+		format: format,
+	}
+}
+
+func (w *RawPCMWriter) Write(sample *avp.Sample) error {
+	if sample.Type != TypePCM {
+		return nil
+	}
+	pcm, ok := sample.Payload.(PCM)
+	if !ok {
+		return ErrUnsupportedPayload
+	}
+	if len(pcm.Data) == 0 {
+		return nil
+	}
+
+	return w.Node.Write(&avp.Sample{
+		ID:        sample.ID,
+		Type:      TypeBinary,
+		Timestamp: sample.Timestamp,
+		Payload:   w.format.encode(pcm.Data),
+	})
+}
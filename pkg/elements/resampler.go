@@ -0,0 +1,252 @@
+package elements
+
+import (
+	"math"
+	"sync"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+)
+
+// timestamp difference in the 48khz clock of contiguous samples
+const resamplerMaxJitter = opusClockRate / 1000
+
+// ResamplerQuality is the interpolation of a Resampler
+type ResamplerQuality int
+
+// Qualities of a Resampler
+const (
+	// ResamplerQualityMedium is a windowed sinc of 8 zero crossings
+	ResamplerQualityMedium ResamplerQuality = iota
+	// ResamplerQualityLow is a linear interpolation without filtering
+	ResamplerQualityLow
+	// ResamplerQualityHigh is a windowed sinc of 32 zero crossings
+	ResamplerQualityHigh
+)
+
+// zeroCrossings returns the zero crossings of the sinc on each side, 0
+// for the linear interpolation
+func (q ResamplerQuality) zeroCrossings() int {
+	switch q {
+	case ResamplerQualityLow:
+		return 0
+	case ResamplerQualityHigh:
+		return 32
+	}
+	return 8
+}
+
+// ResamplerConfig configures a Resampler
+type ResamplerConfig struct {
+	// SampleRate and Channels of the output. Default to the sample rate
+	// and channels of the input.
+	SampleRate int
+	Channels   int
+	// Quality of the interpolation. Defaults to ResamplerQualityMedium.
+	Quality ResamplerQuality
+	// Format of the output. PCMFormatS16LE, the default, writes PCM
+	// samples, other formats write TypeBinary samples of raw data.
+	Format PCMFormat
+}
+
+type resamplerTrack struct {
+	inRate     int
+	inChannels int
+	channels   int
+	rate       int
+	width      int     // input samples on each side of the kernel
+	cutoff     float64 // of the kernel relative to the input rate
+	origin     uint32  // timestamp of the input sample 0
+	frames     int64   // input samples since the origin
+	outputs    int64   // output samples since the origin
+	start      int64   // input sample of buf
+	buf        []float64
+}
+
+// Resampler instance
+type Resampler struct {
+	Node
+	mu     sync.Mutex
+	config ResamplerConfig
+	tracks map[string]*resamplerTrack
+}
+
+// NewResampler instance. Resampler converts the sample rate, channels
+// and format of PCM samples. Timestamps are kept in the 48khz clock of
+// the input, samples following a gap in the timestamps of a track
+// restart the resampling of the track.
+func NewResampler(config ResamplerConfig) *Resampler {
+	return &Resampler{
+		config: config,
+		tracks: make(map[string]*resamplerTrack),
+	}
+}
+
+func (r *Resampler) Write(sample *avp.Sample) error {
+	if sample.Type != TypePCM {
+		return nil
+	}
+	pcm, ok := sample.Payload.(PCM)
+	if !ok {
+		return ErrUnsupportedPayload
+	}
+	if len(pcm.Data) == 0 || pcm.Channels == 0 || pcm.SampleRate == 0 {
+		return nil
+	}
+
+	channels := r.config.Channels
+	if channels == 0 {
+		channels = pcm.Channels
+	}
+	rate := r.config.SampleRate
+	if rate == 0 {
+		rate = pcm.SampleRate
+	}
+	data := remix(pcm.Data, pcm.Channels, channels)
+	if rate == pcm.SampleRate {
+		return r.write(sample.ID, sample.Timestamp, PCM{Data: data, SampleRate: rate, Channels: channels})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.tracks[sample.ID]
+	if t != nil && (t.inRate != pcm.SampleRate || t.inChannels != pcm.Channels || t.gap(sample.Timestamp)) {
+		if err := r.flush(sample.ID, t); err != nil {
+			return err
+		}
+		t = nil
+	}
+	if t == nil {
+		t = r.newTrack(pcm, channels, rate, sample.Timestamp)
+		r.tracks[sample.ID] = t
+	}
+
+	for _, s := range data {
+		t.buf = append(t.buf, float64(s))
+	}
+	t.frames += int64(len(data) / channels)
+	return r.resample(sample.ID, t, math.MaxInt64)
+}
+
+func (r *Resampler) newTrack(pcm PCM, channels, rate int, timestamp uint32) *resamplerTrack {
+	t := &resamplerTrack{
+		inRate:     pcm.SampleRate,
+		inChannels: pcm.Channels,
+		channels:   channels,
+		rate:       rate,
+		width:      1,
+		cutoff:     math.Min(1, float64(rate)/float64(pcm.SampleRate)),
+		origin:     timestamp,
+	}
+	if zc := r.config.Quality.zeroCrossings(); zc > 0 {
+		t.width = int(math.Ceil(float64(zc) / t.cutoff))
+	}
+	// the samples before the first are silent
+	t.start = -int64(t.width)
+	t.buf = make([]float64, t.width*channels)
+	return t
+}
+
+// gap returns whether a timestamp doesn't follow the input samples
+func (t *resamplerTrack) gap(timestamp uint32) bool {
+	expected := t.origin + uint32(t.frames*opusClockRate/int64(t.inRate))
+	delta := int32(timestamp - expected)
+	return delta > resamplerMaxJitter || delta < -resamplerMaxJitter
+}
+
+// resample writes the output samples up to end of the buffered input
+// samples
+func (r *Resampler) resample(id string, t *resamplerTrack, end int64) error {
+	var data []int16
+	first := t.outputs
+	for t.outputs < end {
+		// position of the output sample in the input samples
+		pos := float64(t.outputs) * float64(t.inRate) / float64(t.rate)
+		center := int64(math.Floor(pos))
+		if center+int64(t.width) >= t.start+int64(len(t.buf)/t.channels) {
+			break
+		}
+		for c := 0; c < t.channels; c++ {
+			var v float64
+			for n := center - int64(t.width) + 1; n <= center+int64(t.width); n++ {
+				v += t.buf[(n-t.start)*int64(t.channels)+int64(c)] * r.kernel(t, pos-float64(n))
+			}
+			data = append(data, int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(v)))))
+		}
+		t.outputs++
+	}
+
+	// drop the input samples before the kernel of the next output
+	next := int64(math.Floor(float64(t.outputs)*float64(t.inRate)/float64(t.rate))) - int64(t.width) + 1
+	if drop := next - t.start; drop > 0 {
+		t.buf = t.buf[drop*int64(t.channels):]
+		t.start = next
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+	timestamp := t.origin + uint32(first*opusClockRate/int64(t.rate))
+	return r.write(id, timestamp, PCM{Data: data, SampleRate: t.rate, Channels: t.channels})
+}
+
+// kernel returns the weight of an input sample at a distance in input
+// samples of the output sample
+func (r *Resampler) kernel(t *resamplerTrack, d float64) float64 {
+	d = math.Abs(d)
+	if r.config.Quality == ResamplerQualityLow {
+		return math.Max(0, 1-d)
+	}
+	x := d / float64(t.width)
+	if x >= 1 {
+		return 0
+	}
+	// blackman window
+	w := 0.42 + 0.5*math.Cos(math.Pi*x) + 0.08*math.Cos(2*math.Pi*x)
+	if d == 0 {
+		return t.cutoff * w
+	}
+	a := math.Pi * t.cutoff * d
+	return t.cutoff * math.Sin(a) / a * w
+}
+
+// flush writes the output samples of the end of the input of a track,
+// the samples after it are silent
+func (r *Resampler) flush(id string, t *resamplerTrack) error {
+	t.buf = append(t.buf, make([]float64, (t.width+1)*t.channels)...)
+	end := (t.frames*int64(t.rate) + int64(t.inRate) - 1) / int64(t.inRate)
+	return r.resample(id, t, end)
+}
+
+func (r *Resampler) write(id string, timestamp uint32, pcm PCM) error {
+	if r.config.Format != PCMFormatS16LE {
+		return r.Node.Write(&avp.Sample{
+			ID:        id,
+			Type:      TypeBinary,
+			Timestamp: timestamp,
+			Payload:   r.config.Format.encode(pcm.Data),
+		})
+	}
+	return r.Node.Write(&avp.Sample{
+		ID:        id,
+		Type:      TypePCM,
+		Timestamp: timestamp,
+		Payload:   pcm,
+	})
+}
+
+// Close writes the end of the input of the tracks and closes the
+// children
+func (r *Resampler) Close() {
+	r.mu.Lock()
+	for id, t := range r.tracks {
+		if err := r.flush(id, t); err != nil {
+			log.Errorf("Resampler error writing sample: %s", err)
+		}
+		delete(r.tracks, id)
+	}
+	r.mu.Unlock()
+
+	r.Node.Close()
+}
@@ -0,0 +1,110 @@
+package elements
+
+import (
+	"math"
+	"testing"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// tone returns a frame of a 440hz sine, n samples from the start
+func tone(rate, start, n int) PCM {
+	data := make([]int16, n)
+	for i := range data {
+		data[i] = int16(10000 * math.Sin(2*math.Pi*440*float64(start+i)/float64(rate)))
+	}
+	return PCM{Data: data, SampleRate: rate, Channels: 1}
+}
+
+// resampled writes 200ms of 20ms tone frames and returns the output
+// after close
+func resampled(t *testing.T, config ResamplerConfig, rate int) ([]int16, *sampleCollector) {
+	r := NewResampler(config)
+	recorder := &sampleCollector{}
+	r.Attach(recorder)
+	frame := rate / 50
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, r.Write(&avp.Sample{ID: "audio", Type: TypePCM, Timestamp: uint32(1000 + i*960), Payload: tone(rate, i*frame, frame)}))
+	}
+	r.Close()
+	assert.True(t, recorder.closed)
+
+	var data []int16
+	timestamp := uint32(1000)
+	for _, sample := range recorder.samples {
+		pcm := sample.Payload.(PCM)
+		assert.Equal(t, config.SampleRate, pcm.SampleRate)
+		// the timestamps follow the output samples
+		assert.Equal(t, timestamp, sample.Timestamp)
+		timestamp += uint32(len(pcm.Data) * opusClockRate / config.SampleRate)
+		data = append(data, pcm.Data...)
+	}
+	return data, recorder
+}
+
+func TestResampler(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		quality   ResamplerQuality
+		from, to  int
+		tolerance float64
+	}{
+		{"down", ResamplerQualityMedium, 48000, 16000, 20},
+		{"up", ResamplerQualityMedium, 16000, 48000, 20},
+		{"high", ResamplerQualityHigh, 48000, 8000, 5},
+		{"low", ResamplerQualityLow, 48000, 44100, 100},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data, _ := resampled(t, ResamplerConfig{SampleRate: test.to, Quality: test.quality}, test.from)
+			assert.Len(t, data, test.to/5)
+
+			// the tone at the output rate, but the edges
+			expected := tone(test.to, 0, len(data)).Data
+			for i := test.to / 100; i < len(data)-test.to/100; i++ {
+				assert.InDelta(t, expected[i], data[i], test.tolerance, i)
+			}
+		})
+	}
+}
+
+func TestResampler_Convert(t *testing.T) {
+	r := NewResampler(ResamplerConfig{SampleRate: 8000, Channels: 2, Format: PCMFormatMuLaw})
+	recorder := &sampleCollector{}
+	r.Attach(recorder)
+
+	assert.NoError(t, r.Write(&avp.Sample{ID: "audio", Type: TypePCM, Timestamp: 960, Payload: constant(0)}))
+	// a gap restarts the resampling
+	assert.NoError(t, r.Write(&avp.Sample{ID: "audio", Type: TypePCM, Timestamp: 9600, Payload: constant(0)}))
+	r.Close()
+
+	var size int
+	var timestamps []uint32
+	for _, sample := range recorder.samples {
+		timestamps = append(timestamps, sample.Timestamp)
+		assert.Equal(t, TypeBinary, sample.Type)
+		for _, b := range sample.Payload.([]byte) {
+			assert.Equal(t, byte(0xff), b)
+		}
+		size += len(sample.Payload.([]byte))
+	}
+	// 10ms frames of stereo 8khz
+	assert.Equal(t, 2*2*80, size)
+	assert.Equal(t, uint32(960), timestamps[0])
+	assert.Contains(t, timestamps, uint32(9600))
+
+	// only the channels are converted at the same rate
+	recorder = &sampleCollector{}
+	r = NewResampler(ResamplerConfig{Channels: 2})
+	r.Attach(recorder)
+	assert.NoError(t, r.Write(&avp.Sample{ID: "audio", Type: TypePCM, Timestamp: 960, Payload: PCM{Data: []int16{1, 2}, SampleRate: 16000, Channels: 1}}))
+	assert.Equal(t, PCM{Data: []int16{1, 1, 2, 2}, SampleRate: 16000, Channels: 2}, recorder.samples[0].Payload)
+}
+
+func TestMuLaw(t *testing.T) {
+	assert.Equal(t, byte(0xff), muLaw(0))
+	assert.Equal(t, byte(0x80), muLaw(math.MaxInt16))
+	assert.Equal(t, byte(0x00), muLaw(math.MinInt16))
+	assert.Equal(t, byte(0xf2), muLaw(100))
+	assert.Equal(t, byte(0x72), muLaw(-100))
+}
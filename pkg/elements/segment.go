@@ -0,0 +1,221 @@
+package elements
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"text/template"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+)
+
+const defaultSegmentTemplate = `segment-{{printf "%05d" .Index}}`
+
+var errSegmentFile = errors.New("segment file not created")
+
+// Segment describes a segment of a SegmentWriter
+type Segment struct {
+	Path     string
+	Index    int
+	Start    time.Time // wall clock time of the first sample
+	Duration time.Duration
+	Size     int64
+}
+
+// SegmentWriterConfig configures a SegmentWriter
+type SegmentWriterConfig struct {
+	// MaxDuration and MaxSize in bytes of a segment. Once reached, the
+	// segment is cut on the next video keyframe, or the next audio sample
+	// of audio only streams. Zero disables a limit.
+	MaxDuration time.Duration
+	MaxSize     int64
+	// Template of the segment paths, a text/template executed with the
+	// Segment, its Index and Start are set. Defaults to segment-00000.
+	Template string
+	// BufSize of the segment file writers, <=0 disables buffering.
+	BufSize int
+}
+
+// byteCounter counts the bytes written to its children
+type byteCounter struct {
+	Node
+	size int64
+}
+
+func (c *byteCounter) Write(sample *avp.Sample) error {
+	if payload, ok := sample.Payload.([]byte); ok {
+		c.size += int64(len(payload))
+	}
+	return c.Node.Write(sample)
+}
+
+// SegmentWriter records samples in segment files. Each segment is a
+// standalone file written by its own muxer, e.g. a WebmSaver, and is
+// handed to the OnSegment handler once closed.
+type SegmentWriter struct {
+	Leaf
+	mu          sync.Mutex
+	config      SegmentWriterConfig
+	template    *template.Template
+	newMuxer    func() avp.Element
+	onSegmentFn func(Segment)
+
+	segment  Segment
+	muxer    avp.Element
+	counter  *byteCounter
+	index    int
+	video    bool
+	refType  int    // sample type the duration is measured with
+	refStart uint32 // timestamp of the first reference sample of the segment
+	refLast  uint32
+	refSet   bool
+	closed   bool
+}
+
+// NewSegmentWriter instance. newMuxer creates the muxer of a segment.
+func NewSegmentWriter(config SegmentWriterConfig, newMuxer func() avp.Element) *SegmentWriter {
+	if config.Template == "" {
+		config.Template = defaultSegmentTemplate
+	}
+	tmpl, err := template.New("segment").Parse(config.Template)
+	if err != nil {
+		log.Errorf("error parsing segment template: %s", err)
+		return nil
+	}
+	return &SegmentWriter{
+		config:   config,
+		template: tmpl,
+		newMuxer: newMuxer,
+		refType:  avp.TypeOpus,
+	}
+}
+
+// OnSegment sets a handler called with each segment once its file is
+// closed. It's called from the writing goroutine, long tasks like
+// uploads should run asynchronously.
+func (w *SegmentWriter) OnSegment(f func(Segment)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onSegmentFn = f
+}
+
+func (w *SegmentWriter) Write(sample *avp.Sample) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+
+	video := sample.Type == avp.TypeVP8 || sample.Type == avp.TypeVP9 ||
+		sample.Type == avp.TypeH264 || sample.Type == avp.TypeAV1
+	if video && !w.video {
+		// measure the duration with the video timestamps
+		w.video = true
+		w.refType = sample.Type
+		w.refSet = false
+	}
+
+	if w.muxer != nil && w.full(sample, video) {
+		w.closeSegment()
+	}
+	if w.muxer == nil {
+		if err := w.openSegment(); err != nil {
+			return err
+		}
+	}
+
+	if sample.Type == w.refType {
+		if !w.refSet {
+			w.refStart, w.refSet = sample.Timestamp, true
+		}
+		w.refLast = sample.Timestamp
+	}
+
+	return w.muxer.Write(sample)
+}
+
+// full returns true when the segment is cut before the sample
+func (w *SegmentWriter) full(sample *avp.Sample, video bool) bool {
+	if w.video {
+		payload, ok := sample.Payload.([]byte)
+		if !video || !ok || !isKeyframe(sample.Type, payload) {
+			return false
+		}
+	} else if sample.Type != w.refType {
+		return false
+	}
+
+	if w.config.MaxSize > 0 && w.counter.size >= w.config.MaxSize {
+		return true
+	}
+	return w.config.MaxDuration > 0 && sample.Type == w.refType && w.refSet &&
+		w.elapsed(sample.Timestamp) >= w.config.MaxDuration
+}
+
+// elapsed returns the duration from the start of the segment to a
+// timestamp of the reference track
+func (w *SegmentWriter) elapsed(timestamp uint32) time.Duration {
+	clockRate := time.Duration(videoClockRate)
+	if w.refType == avp.TypeOpus {
+		clockRate = opusClockRate
+	}
+	return time.Duration(timestamp-w.refStart) * time.Second / clockRate
+}
+
+func (w *SegmentWriter) openSegment() error {
+	segment := Segment{
+		Index: w.index,
+		Start: time.Now(),
+	}
+	var path bytes.Buffer
+	if err := w.template.Execute(&path, segment); err != nil {
+		return err
+	}
+	segment.Path = path.String()
+
+	fw := NewFileWriter(segment.Path, w.config.BufSize)
+	if fw == nil {
+		return errSegmentFile
+	}
+
+	w.counter = &byteCounter{}
+	w.counter.Attach(fw)
+	w.muxer = w.newMuxer()
+	w.muxer.Attach(w.counter)
+	w.segment = segment
+	w.refSet = false
+	w.index++
+	log.Infof("Segment writer started segment %s", segment.Path)
+	return nil
+}
+
+func (w *SegmentWriter) closeSegment() {
+	w.muxer.Close()
+	w.muxer = nil
+
+	segment := w.segment
+	segment.Size = w.counter.size
+	if w.refSet {
+		segment.Duration = w.elapsed(w.refLast)
+	}
+	if w.onSegmentFn != nil {
+		w.onSegmentFn(segment)
+	}
+}
+
+// Close closes the last segment
+func (w *SegmentWriter) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.closed = true
+	if w.muxer != nil {
+		w.closeSegment()
+	}
+}
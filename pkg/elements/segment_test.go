@@ -0,0 +1,94 @@
+package elements
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentWriter(t *testing.T) {
+	dir := t.TempDir()
+	writer := NewSegmentWriter(SegmentWriterConfig{
+		MaxDuration: time.Second,
+		Template:    filepath.Join(dir, "rec-{{.Index}}.ivf"),
+	}, func() avp.Element {
+		return NewIVFWriter(IVFWriterConfig{})
+	})
+	assert.NotNil(t, writer)
+
+	var segments []Segment
+	writer.OnSegment(func(s Segment) {
+		segments = append(segments, s)
+	})
+
+	// 30 fps with a keyframe every 45 frames, segments are cut
+	// on the first keyframe after a second
+	for i := 0; i < 100; i++ {
+		payload := []byte{0x86, byte(i)}
+		if i%45 == 0 {
+			payload = rawVP9KeyframePkt
+		}
+		assert.NoError(t, writer.Write(&avp.Sample{Type: avp.TypeVP9, Timestamp: uint32(i * 3000), Payload: payload}))
+		// audio doesn't cut segments when there is video
+		assert.NoError(t, writer.Write(&avp.Sample{Type: avp.TypeOpus, Timestamp: uint32(i * 1600), Payload: rawOpusPkt}))
+	}
+	writer.Close()
+	assert.NoError(t, writer.Write(&avp.Sample{Type: avp.TypeVP9, Payload: rawVP9KeyframePkt}))
+
+	assert.Len(t, segments, 3)
+	for i, frames := range []uint32{45, 45, 10} {
+		segment := segments[i]
+		assert.Equal(t, i, segment.Index)
+		assert.Equal(t, filepath.Join(dir, fmt.Sprintf("rec-%d.ivf", i)), segment.Path)
+		assert.Equal(t, time.Duration(frames-1)*time.Second/30, segment.Duration)
+
+		info, err := os.Stat(segment.Path)
+		assert.NoError(t, err)
+		assert.Equal(t, info.Size(), segment.Size)
+
+		// each segment is a standalone file
+		f, err := os.Open(segment.Path)
+		assert.NoError(t, err)
+		_, header, err := ivfreader.NewWith(f)
+		assert.NoError(t, err)
+		assert.Equal(t, frames, header.NumFrames)
+		f.Close()
+	}
+}
+
+func TestSegmentWriter_AudioOnly(t *testing.T) {
+	dir := t.TempDir()
+	writer := NewSegmentWriter(SegmentWriterConfig{
+		MaxSize:  100,
+		Template: filepath.Join(dir, "{{.Index}}.ogg"),
+	}, func() avp.Element {
+		return NewOggWriter(OggWriterConfig{})
+	})
+
+	var segments []Segment
+	writer.OnSegment(func(s Segment) {
+		segments = append(segments, s)
+	})
+
+	for i := 0; i < 200; i++ {
+		assert.NoError(t, writer.Write(&avp.Sample{Type: avp.TypeOpus, Timestamp: uint32(i * 960), Payload: rawOpusFrame}))
+	}
+	writer.Close()
+
+	assert.True(t, len(segments) > 1)
+	for _, segment := range segments {
+		info, err := os.Stat(segment.Path)
+		assert.NoError(t, err)
+		assert.Equal(t, info.Size(), segment.Size)
+	}
+}
+
+func TestSegmentWriter_Template(t *testing.T) {
+	assert.Nil(t, NewSegmentWriter(SegmentWriterConfig{Template: "{{.Index"}, nil))
+}
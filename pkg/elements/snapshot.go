@@ -0,0 +1,289 @@
+package elements
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+)
+
+const (
+	defaultSnapshotInterval = 5 * time.Second
+	defaultSnapshotTemplate = `{{.TID}}{{.Ext}}`
+)
+
+// SnapshotInfo describes a snapshot, it's the data of the file name
+// template
+type SnapshotInfo struct {
+	SID       string
+	PID       string
+	TID       string // track id of the frame
+	Index     int
+	Timestamp uint32 // of the frame
+	Time      time.Time
+	Ext       string // .jpg or .png
+}
+
+// SnapshotConfig configures a Snapshot
+type SnapshotConfig struct {
+	// Format of the images, TypeJPEG or TypePNG. Defaults to TypeJPEG.
+	Format int
+	// Quality of the jpeg images from 1 to 100. Defaults to 75.
+	Quality int
+	// Interval between snapshots of a track, measured with the frame
+	// timestamps. Defaults to 5s.
+	Interval time.Duration
+	// Keyframes takes a snapshot of every keyframe instead of at the
+	// interval, the snapshot needs a decoder.
+	Keyframes bool
+	// MaxWidth and MaxHeight of the images, larger frames are scaled
+	// down. Zero disables a limit.
+	MaxWidth  int
+	MaxHeight int
+	// Dir the images are written to, no files are written when empty.
+	Dir string
+	// Template of the file names, a text/template executed with the
+	// SnapshotInfo. Defaults to {{.TID}}{{.Ext}}, which keeps the
+	// latest snapshot of a track only, e.g. {{.TID}}-{{.Index}}{{.Ext}}
+	// keeps all of them.
+	Template string
+	// SID and PID of the template
+	SID string
+	PID string
+}
+
+// snapshotSink receives the frames of the decoder of a Snapshot
+type snapshotSink struct {
+	Leaf
+	s *Snapshot
+}
+
+func (s *snapshotSink) Write(sample *avp.Sample) error {
+	return s.s.frame(sample)
+}
+
+// Snapshot instance
+type Snapshot struct {
+	Node
+	mu       sync.Mutex
+	config   SnapshotConfig
+	template *template.Template
+	decoder  avp.Element
+	pending  map[string]bool   // a keyframe of the track was written to the decoder
+	last     map[string]uint32 // timestamp of the last snapshot by track
+	index    int
+	closed   bool
+}
+
+// NewSnapshot instance. Snapshot takes jpeg or png images of TypeYCbCr
+// or TypeRGBA frames, written to its directory and to its children as
+// TypeJPEG or TypePNG samples. With a decoder, e.g. a Decoder, the
+// snapshot takes encoded video samples it decodes. An error is returned
+// when the template can't be parsed.
+func NewSnapshot(config SnapshotConfig, decoder avp.Element) (*Snapshot, error) {
+	if config.Format == 0 {
+		config.Format = TypeJPEG
+	}
+	if config.Quality == 0 {
+		config.Quality = jpeg.DefaultQuality
+	}
+	if config.Interval == 0 {
+		config.Interval = defaultSnapshotInterval
+	}
+	if config.Template == "" {
+		config.Template = defaultSnapshotTemplate
+	}
+	tmpl, err := template.New("snapshot").Parse(config.Template)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{
+		config:   config,
+		template: tmpl,
+		decoder:  decoder,
+		pending:  make(map[string]bool),
+		last:     make(map[string]uint32),
+	}
+	if decoder != nil {
+		decoder.Attach(&snapshotSink{s: s})
+	}
+	return s, nil
+}
+
+func (s *Snapshot) Write(sample *avp.Sample) error {
+	switch sample.Type {
+	case TypeYCbCr, TypeRGBA:
+		return s.frame(sample)
+	case avp.TypeVP8, avp.TypeVP9, avp.TypeH264, avp.TypeAV1:
+		if s.decoder == nil {
+			return nil
+		}
+		payload, ok := sample.Payload.([]byte)
+		if !ok {
+			return ErrUnsupportedPayload
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil
+		}
+		if isKeyframe(sample.Type, payload) {
+			s.pending[sample.ID] = true
+		}
+		s.mu.Unlock()
+
+		// the decoder writes the frames to the sink
+		return s.decoder.Write(sample)
+	}
+	return nil
+}
+
+// frame takes a snapshot of a frame when it's due
+func (s *Snapshot) frame(sample *avp.Sample) error {
+	img, ok := sample.Payload.(image.Image)
+	if !ok {
+		return ErrUnsupportedPayload
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	if s.config.Keyframes {
+		if !s.pending[sample.ID] {
+			return nil
+		}
+		delete(s.pending, sample.ID)
+	} else if last, ok := s.last[sample.ID]; ok && !s.due(last, sample.Timestamp) {
+		return nil
+	}
+	s.last[sample.ID] = sample.Timestamp
+
+	img, ok = scaleImage(img, s.config.MaxWidth, s.config.MaxHeight)
+	if !ok {
+		return ErrUnsupportedPayload
+	}
+	buf := new(bytes.Buffer)
+	ext := ".jpg"
+	var err error
+	// the studio range of YCbCr frames is converted, images use the full range
+	if s.config.Format == TypePNG {
+		ext = ".png"
+		err = png.Encode(buf, toRGBA(img))
+	} else {
+		err = jpeg.Encode(buf, toRGBA(img), &jpeg.Options{Quality: s.config.Quality})
+	}
+	if err != nil {
+		return err
+	}
+
+	info := SnapshotInfo{
+		SID:       s.config.SID,
+		PID:       s.config.PID,
+		TID:       sample.ID,
+		Index:     s.index,
+		Timestamp: sample.Timestamp,
+		Time:      time.Now(),
+		Ext:       ext,
+	}
+	s.index++
+	if s.config.Dir != "" {
+		name := new(bytes.Buffer)
+		if err := s.template.Execute(name, info); err != nil {
+			return err
+		}
+		// track ids must not name files out of the directory
+		path := filepath.Join(s.config.Dir, name.String())
+		if rel, err := filepath.Rel(s.config.Dir, path); err != nil || strings.HasPrefix(rel, "..") {
+			log.Warnf("Snapshot dropped file out of the directory: %s", name)
+		} else if err := replaceFile(path, buf.Bytes()); err != nil {
+			log.Errorf("Snapshot error writing file: %s", err)
+		}
+	}
+
+	return s.Node.Write(&avp.Sample{
+		ID:        sample.ID,
+		Type:      s.config.Format,
+		Timestamp: sample.Timestamp,
+		Payload:   buf.Bytes(),
+	})
+}
+
+// due returns true when the interval elapsed between the timestamps of
+// two frames, or when the timestamps went back
+func (s *Snapshot) due(last, timestamp uint32) bool {
+	elapsed := int32(timestamp - last)
+	return elapsed < 0 || int64(elapsed)*int64(time.Second) >= int64(s.config.Interval)*videoClockRate
+}
+
+// scaleImage scales down a YCbCr or RGBA image to fit a size with the
+// nearest pixels, false for other images
+func scaleImage(img image.Image, maxWidth, maxHeight int) (image.Image, bool) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if maxWidth > 0 && w > maxWidth {
+		w, h = maxWidth, h*maxWidth/w
+	}
+	if maxHeight > 0 && h > maxHeight {
+		w, h = w*maxHeight/h, maxHeight
+	}
+
+	switch src := img.(type) {
+	case *image.YCbCr:
+		if w == b.Dx() && h == b.Dy() {
+			return src, true
+		}
+		// aligned on the chroma samples
+		w, h = w&^1, h&^1
+		if w == 0 || h == 0 {
+			w, h = 2, 2
+		}
+		dst := image.NewYCbCr(image.Rect(0, 0, w, h), image.YCbCrSubsampleRatio420)
+		scaleYCbCr(dst, dst.Rect, src)
+		return dst, true
+
+	case *image.RGBA:
+		if w == b.Dx() && h == b.Dy() {
+			return src, true
+		}
+		if w == 0 || h == 0 {
+			w, h = 1, 1
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				i := src.PixOffset(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h)
+				copy(dst.Pix[dst.PixOffset(x, y):], src.Pix[i:i+4])
+			}
+		}
+		return dst, true
+	}
+	return nil, false
+}
+
+// Close closes the decoder and the children
+func (s *Snapshot) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	if s.decoder != nil {
+		s.decoder.Close()
+	}
+	s.Node.Close()
+}
@@ -0,0 +1,129 @@
+package elements
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSnapshot(SnapshotConfig{
+		Interval: time.Hour,
+		MaxWidth: 160,
+		Dir:      dir,
+		Template: "{{.SID}}/{{.PID}}/{{.TID}}-{{.Index}}-{{.Timestamp}}{{.Ext}}",
+		SID:      "sid",
+		PID:      "pid",
+	}, nil)
+	assert.NoError(t, err)
+	recorder := &sampleCollector{}
+	s.Attach(recorder)
+
+	// encoded samples need a decoder
+	assert.NoError(t, s.Write(&avp.Sample{ID: "video", Type: avp.TypeVP8, Payload: rawVP8KeyframePkt}))
+	// files stay in the directory
+	assert.NoError(t, s.Write(&avp.Sample{ID: "../../../video", Type: TypeYCbCr, Payload: frame(64, 36, 100)}))
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, s.Write(&avp.Sample{ID: "video", Type: TypeYCbCr, Timestamp: uint32(3000 * i), Payload: frame(640, 360, 100)}))
+	}
+	s.Close()
+	assert.True(t, recorder.closed)
+
+	// a snapshot per interval
+	assert.Len(t, recorder.samples, 2)
+	sample := recorder.samples[1]
+	assert.Equal(t, TypeJPEG, sample.Type)
+	assert.Equal(t, "video", sample.ID)
+
+	_, err = os.Stat(filepath.Join(dir, "..", "video-0-0.jpg"))
+	assert.True(t, os.IsNotExist(err))
+	data, err := ioutil.ReadFile(filepath.Join(dir, "sid", "pid", "video-1-0.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, sample.Payload, data)
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 160, config.Width)
+	assert.Equal(t, 90, config.Height)
+
+	_, err = NewSnapshot(SnapshotConfig{Template: "{{.TID"}, nil)
+	assert.Error(t, err)
+}
+
+func TestSnapshot_Interval(t *testing.T) {
+	s, err := NewSnapshot(SnapshotConfig{Interval: time.Second}, nil)
+	assert.NoError(t, err)
+	recorder := &sampleCollector{}
+	s.Attach(recorder)
+
+	// frames written faster than realtime, e.g. by a file source
+	for _, ts := range []uint32{4294960000, 37704, 82704, 127704, 172704, 0} {
+		assert.NoError(t, s.Write(&avp.Sample{ID: "video", Type: TypeYCbCr, Timestamp: ts, Payload: frame(64, 36, 100)}))
+	}
+	s.Close()
+
+	// a snapshot per second of the timestamps, and after they went back
+	var timestamps []uint32
+	for _, sample := range recorder.samples {
+		timestamps = append(timestamps, sample.Timestamp)
+	}
+	assert.Equal(t, []uint32{4294960000, 82704, 172704, 0}, timestamps)
+}
+
+func TestSnapshot_Keyframes(t *testing.T) {
+	dir := t.TempDir()
+	// decodes every sample into a frame of the luma of its first byte
+	decoder := NewMap(func(sample *avp.Sample) *avp.Sample {
+		img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+		for i := 0; i < len(img.Pix); i += 4 {
+			v := sample.Payload.([]byte)[0]
+			copy(img.Pix[i:], []byte{v, v, v, 0xff})
+		}
+		return &avp.Sample{ID: sample.ID, Type: TypeRGBA, Timestamp: sample.Timestamp, Payload: img}
+	})
+	s, err := NewSnapshot(SnapshotConfig{
+		Format:    TypePNG,
+		Keyframes: true,
+		MaxHeight: 24,
+		Dir:       dir,
+	}, decoder)
+	assert.NoError(t, err)
+	recorder := &sampleCollector{}
+	s.Attach(recorder)
+
+	assert.NoError(t, s.Write(&avp.Sample{ID: "video", Type: avp.TypeVP8, Payload: []byte{0x01, 0x00}}))
+	assert.NoError(t, s.Write(&avp.Sample{ID: "video", Type: avp.TypeVP8, Payload: rawVP8KeyframePkt}))
+	assert.NoError(t, s.Write(&avp.Sample{ID: "video", Type: avp.TypeVP8, Payload: []byte{0x01, 0x00}}))
+	keyframe := append([]byte{0x30}, rawVP8KeyframePkt[1:]...)
+	assert.NoError(t, s.Write(&avp.Sample{ID: "video", Type: avp.TypeVP8, Payload: keyframe}))
+	// the keyframe of a track isn't taken for the frames of another one
+	assert.NoError(t, s.Write(&avp.Sample{ID: "screen", Type: avp.TypeVP8, Payload: rawVP8KeyframePkt}))
+	assert.NoError(t, s.Write(&avp.Sample{ID: "video", Type: avp.TypeVP8, Payload: []byte{0x01, 0x00}}))
+	s.Close()
+
+	var ids []string
+	for _, sample := range recorder.samples {
+		assert.Equal(t, TypePNG, sample.Type)
+		ids = append(ids, sample.ID)
+	}
+	assert.Equal(t, []string{"video", "video", "screen"}, ids)
+
+	// the file of the default template has the last snapshot
+	f, err := os.Open(filepath.Join(dir, "video.png"))
+	assert.NoError(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 32, 24), img.Bounds())
+	r, _, _, _ := img.At(10, 10).RGBA()
+	assert.Equal(t, uint32(0x3030), r)
+}
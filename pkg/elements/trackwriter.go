@@ -0,0 +1,90 @@
+package elements
+
+import (
+	"sync"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// TrackWriter instance
+type TrackWriter struct {
+	Leaf
+	track         webrtc.TrackLocal
+	mu            sync.Mutex        // guards pub and sender
+	pub           *avp.Publisher    // the track is added again to the publisher of a reconnect
+	sender        *webrtc.RTPSender // removed from pub on close
+	lastTimestamp uint32
+	started       bool
+}
+
+// NewTrackWriter instance. TrackWriter publishes samples back into the
+// session on a local track. Encoded frames are written to a
+// TrackLocalStaticSample, rtp packets (*rtp.Packet or marshaled bytes)
+// to a TrackLocalStaticRTP.
+func NewTrackWriter(track webrtc.TrackLocal) *TrackWriter {
+	return &TrackWriter{
+		track: track,
+	}
+}
+
+// Publish adds the track to the transport publisher
+func (w *TrackWriter) Publish(pub *avp.Publisher) error {
+	sender, err := pub.AddTrack(w.track)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pub = pub
+	w.sender = sender
+	return nil
+}
+
+func (w *TrackWriter) Write(sample *avp.Sample) error {
+	switch track := w.track.(type) {
+	case *webrtc.TrackLocalStaticSample:
+		payload, ok := sample.Payload.([]byte)
+		if !ok {
+			return ErrUnsupportedPayload
+		}
+
+		// Sample duration is derived from the rtp timestamps
+		// so the outgoing stream keeps the source timing.
+		var duration time.Duration
+		if w.started {
+			delta := sample.Timestamp - w.lastTimestamp
+			duration = time.Duration(delta) * time.Second / time.Duration(track.Codec().ClockRate)
+		}
+		w.lastTimestamp = sample.Timestamp
+		w.started = true
+
+		return track.WriteSample(media.Sample{Data: payload, Duration: duration})
+	case *webrtc.TrackLocalStaticRTP:
+		switch payload := sample.Payload.(type) {
+		case *rtp.Packet:
+			return track.WriteRTP(payload)
+		case []byte:
+			_, err := track.Write(payload)
+			return err
+		}
+		return ErrUnsupportedPayload
+	}
+	return ErrUnsupportedPayload
+}
+
+func (w *TrackWriter) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.sender == nil {
+		return
+	}
+	if err := w.pub.RemoveTrack(w.sender); err != nil {
+		log.Debugf("error removing track: %s", err)
+	}
+	w.sender = nil
+}
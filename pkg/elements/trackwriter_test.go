@@ -0,0 +1,89 @@
+package elements
+
+import (
+	"testing"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackWriter_Publish(t *testing.T) {
+	pub, err := avp.NewPublisher(avp.WebRTCTransportConfig{})
+	assert.NoError(t, err)
+	defer pub.Close()
+
+	negotiated := make(chan struct{})
+	pub.OnNegotiationNeeded(func() {
+		close(negotiated)
+	})
+
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: avp.MimeTypeVP8, ClockRate: 90000}, "video", "avp")
+	assert.NoError(t, err)
+
+	writer := NewTrackWriter(track)
+	assert.NoError(t, writer.Publish(pub))
+
+	select {
+	case <-negotiated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("negotiation not triggered")
+	}
+
+	assert.NoError(t, writer.Write(&avp.Sample{Type: avp.TypeVP8, Timestamp: 1000, Payload: rawKeyframePkt}))
+	assert.NoError(t, writer.Write(&avp.Sample{Type: avp.TypeVP8, Timestamp: 4000, Payload: rawKeyframePkt}))
+	assert.Equal(t, ErrUnsupportedPayload, writer.Write(&avp.Sample{Type: TypeYCbCr, Payload: struct{}{}}))
+
+	writer.Close()
+}
+
+func TestTrackWriter_Republish(t *testing.T) {
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: avp.MimeTypeVP8, ClockRate: 90000}, "video", "avp")
+	assert.NoError(t, err)
+	writer := NewTrackWriter(track)
+
+	var pubs []*avp.Publisher
+	for i := 0; i < 2; i++ {
+		pub, err := avp.NewPublisher(avp.WebRTCTransportConfig{})
+		assert.NoError(t, err)
+		defer pub.Close()
+		pubs = append(pubs, pub)
+	}
+	assert.NoError(t, writer.Publish(pubs[0]))
+
+	// the transport publishes on the new publisher of a reconnect
+	// while the builder writes and closes the writer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, writer.Publish(pubs[1]))
+	}()
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, writer.Write(&avp.Sample{Type: avp.TypeVP8, Timestamp: uint32(i * 3000), Payload: rawKeyframePkt}))
+	}
+	writer.Close()
+	<-done
+}
+
+func TestTrackWriter_PublishNested(t *testing.T) {
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: avp.MimeTypeVP8, ClockRate: 90000}, "video", "avp")
+	assert.NoError(t, err)
+	writer := NewTrackWriter(track)
+
+	process := NewFilter(func(*avp.Sample) bool { return true })
+	process.Attach(NewPipeline([]avp.Element{NewMap(func(s *avp.Sample) *avp.Sample { return s }), writer}))
+
+	pubs := avp.Publishables(process)
+	if assert.Len(t, pubs, 1) {
+		assert.Equal(t, writer, pubs[0])
+	}
+
+	pub, err := avp.NewPublisher(avp.WebRTCTransportConfig{})
+	assert.NoError(t, err)
+	defer pub.Close()
+	assert.NoError(t, pubs[0].Publish(pub))
+
+	assert.NoError(t, process.Write(&avp.Sample{Type: avp.TypeVP8, Timestamp: 1000, Payload: rawKeyframePkt}))
+	process.Close()
+}
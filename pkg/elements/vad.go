@@ -0,0 +1,217 @@
+package elements
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+)
+
+const (
+	defaultVADThreshold     = -45
+	defaultVADStartDuration = 60 * time.Millisecond
+	defaultVADStopDuration  = 400 * time.Millisecond
+
+	// level range around the threshold mapped to the confidence
+	vadConfidenceRange = 20
+	// level of silence in dBov, the lowest audio level
+	vadMinLevel = -127
+)
+
+// VADConfig configures a VAD
+type VADConfig struct {
+	// Threshold is the level in dBov above which a frame is speech.
+	// Defaults to -45.
+	Threshold float64
+	// StartDuration of speech before a start is reported, and
+	// StopDuration of silence before a stop is reported. Default to 60ms
+	// and 400ms.
+	StartDuration time.Duration
+	StopDuration  time.Duration
+}
+
+// VADEvent is the payload of the TypeMetadata samples of a VAD
+type VADEvent struct {
+	Speaking bool `json:"speaking"`
+	// Confidence from 0 to 1 of the speech or silence
+	Confidence float64 `json:"confidence"`
+	// Timestamp of the first frame of the speech or silence, in the
+	// clock of the track
+	Timestamp uint32 `json:"timestamp"`
+	// Time the event was detected
+	Time time.Time `json:"time"`
+}
+
+type vadTrack struct {
+	speaking   bool
+	run        time.Duration // duration of the frames contradicting the state
+	runStart   uint32
+	confidence float64 // of the run, weighted by the frame durations
+	timestamp  uint32  // of the last frame
+}
+
+// VAD instance
+type VAD struct {
+	Node
+	mu     sync.Mutex
+	config VADConfig
+	tracks map[string]*vadTrack
+}
+
+// NewVAD instance. VAD detects the speech of PCM samples, or of opus
+// samples with an audio level. The samples are forwarded, followed by a
+// TypeMetadata sample with a VADEvent when a track starts or stops
+// speaking.
+func NewVAD(config VADConfig) *VAD {
+	if config.Threshold == 0 {
+		config.Threshold = defaultVADThreshold
+	}
+	if config.StartDuration == 0 {
+		config.StartDuration = defaultVADStartDuration
+	}
+	if config.StopDuration == 0 {
+		config.StopDuration = defaultVADStopDuration
+	}
+	return &VAD{
+		config: config,
+		tracks: make(map[string]*vadTrack),
+	}
+}
+
+func (v *VAD) Write(sample *avp.Sample) error {
+	var level float64
+	var duration time.Duration
+
+	switch sample.Type {
+	case TypePCM:
+		pcm, ok := sample.Payload.(PCM)
+		if !ok {
+			return ErrUnsupportedPayload
+		}
+		if len(pcm.Data) == 0 || pcm.Channels == 0 || pcm.SampleRate == 0 {
+			return v.Node.Write(sample)
+		}
+		level = pcmLevel(pcm.Data)
+		duration = time.Duration(len(pcm.Data)/pcm.Channels) * time.Second / time.Duration(pcm.SampleRate)
+
+	case avp.TypeOpus:
+		if sample.AudioLevel == nil {
+			return v.Node.Write(sample)
+		}
+		payload, ok := sample.Payload.([]byte)
+		if !ok {
+			return ErrUnsupportedPayload
+		}
+		level = -float64(sample.AudioLevel.Level)
+		duration = time.Duration(opusPacketDuration(payload)) * time.Second / opusClockRate
+
+	default:
+		return v.Node.Write(sample)
+	}
+
+	event := v.detect(sample, level, duration)
+	if err := v.Node.Write(sample); err != nil {
+		return err
+	}
+	if event == nil {
+		return nil
+	}
+	return v.Node.Write(event)
+}
+
+// detect returns the event sample of a frame of the level and duration,
+// nil when the state of the track did not change
+func (v *VAD) detect(sample *avp.Sample, level float64, duration time.Duration) *avp.Sample {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	t := v.tracks[sample.ID]
+	if t == nil {
+		t = &vadTrack{}
+		v.tracks[sample.ID] = t
+	}
+	t.timestamp = sample.Timestamp
+
+	confidence := 0.5 + (level-v.config.Threshold)/(2*vadConfidenceRange)
+	confidence = math.Max(0, math.Min(1, confidence))
+	speech := level > v.config.Threshold
+	if speech == t.speaking {
+		t.run, t.confidence = 0, 0
+		return nil
+	}
+
+	if t.run == 0 {
+		t.runStart = sample.Timestamp
+	}
+	if !speech {
+		confidence = 1 - confidence
+	}
+	t.run += duration
+	t.confidence += confidence * duration.Seconds()
+
+	limit := v.config.StartDuration
+	if t.speaking {
+		limit = v.config.StopDuration
+	}
+	if t.run < limit {
+		return nil
+	}
+
+	event := VADEvent{
+		Speaking:   speech,
+		Confidence: math.Min(1, t.confidence/t.run.Seconds()),
+		Timestamp:  t.runStart,
+		Time:       time.Now(),
+	}
+	t.speaking = speech
+	t.run, t.confidence = 0, 0
+
+	return &avp.Sample{
+		ID:        sample.ID,
+		Type:      TypeMetadata,
+		Timestamp: event.Timestamp,
+		Payload:   event,
+	}
+}
+
+// pcmLevel returns the rms level of pcm samples in dBov
+func pcmLevel(data []int16) float64 {
+	var sum float64
+	for _, s := range data {
+		sum += float64(s) * float64(s)
+	}
+	rms := math.Sqrt(sum / float64(len(data)))
+	if rms == 0 {
+		return vadMinLevel
+	}
+	return math.Max(vadMinLevel, 20*math.Log10(rms/32768))
+}
+
+// Close reports the end of the speech of the speaking tracks
+func (v *VAD) Close() {
+	v.mu.Lock()
+	for id, t := range v.tracks {
+		if !t.speaking {
+			continue
+		}
+		t.speaking = false
+		event := VADEvent{
+			Confidence: 1,
+			Timestamp:  t.timestamp,
+			Time:       time.Now(),
+		}
+		if err := v.Node.Write(&avp.Sample{
+			ID:        id,
+			Type:      TypeMetadata,
+			Timestamp: event.Timestamp,
+			Payload:   event,
+		}); err != nil {
+			log.Errorf("VAD error writing event: %s", err)
+		}
+	}
+	v.mu.Unlock()
+
+	v.Node.Close()
+}
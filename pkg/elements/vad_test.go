@@ -0,0 +1,119 @@
+package elements
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+)
+
+// sine returns a 20ms mono 48khz pcm frame of a 440hz sine
+func sine(amplitude float64) PCM {
+	data := make([]int16, 960)
+	for i := range data {
+		data[i] = int16(amplitude * math.Sin(2*math.Pi*440*float64(i)/48000))
+	}
+	return PCM{Data: data, SampleRate: 48000, Channels: 1}
+}
+
+// vadEvents returns the event samples of the samples written by a VAD
+func vadEvents(samples []*avp.Sample) []*avp.Sample {
+	var events []*avp.Sample
+	for _, sample := range samples {
+		if sample.Type == TypeMetadata {
+			events = append(events, sample)
+		}
+	}
+	return events
+}
+
+func TestVAD_PCM(t *testing.T) {
+	vad := NewVAD(VADConfig{})
+	recorder := &sampleCollector{}
+	vad.Attach(recorder)
+
+	// 200ms of silence, 300ms of speech, a short pause and 600ms of silence
+	frames := make([]PCM, 0, 55)
+	for i := 0; i < 10; i++ {
+		frames = append(frames, sine(10))
+	}
+	for i := 0; i < 15; i++ {
+		frames = append(frames, sine(8000))
+	}
+	frames = append(frames, sine(0), sine(0), sine(8000))
+	for i := 0; i < 30; i++ {
+		frames = append(frames, sine(0))
+	}
+	for i, pcm := range frames {
+		assert.NoError(t, vad.Write(&avp.Sample{ID: "mic", Type: TypePCM, Timestamp: uint32(i * 960), Payload: pcm}))
+	}
+
+	recorder.Lock()
+	// the frames are forwarded, the events follow the frame they were
+	// detected with
+	assert.Len(t, recorder.samples, len(frames)+2)
+	assert.Equal(t, TypeMetadata, recorder.samples[13].Type)
+	assert.Equal(t, uint32(12*960), recorder.samples[12].Timestamp)
+	events := vadEvents(recorder.samples)
+	if assert.Len(t, events, 2) {
+		start := events[0]
+		assert.Equal(t, TypeMetadata, start.Type)
+		assert.Equal(t, "mic", start.ID)
+		event := start.Payload.(VADEvent)
+		assert.True(t, event.Speaking)
+		assert.Equal(t, uint32(10*960), event.Timestamp)
+		assert.True(t, event.Confidence > 0.9)
+
+		event = events[1].Payload.(VADEvent)
+		assert.False(t, event.Speaking)
+		assert.Equal(t, uint32(28*960), event.Timestamp)
+		assert.Equal(t, 1.0, event.Confidence)
+
+		// consumable by the data channel writer
+		raw, err := json.Marshal(event)
+		assert.NoError(t, err)
+		assert.Contains(t, string(raw), `"speaking":false,"confidence":1,"timestamp":26880`)
+	}
+	recorder.Unlock()
+
+	vad.Close()
+	assert.True(t, recorder.closed)
+}
+
+func TestVAD_AudioLevel(t *testing.T) {
+	vad := NewVAD(VADConfig{Threshold: -40})
+	recorder := &sampleCollector{}
+	vad.Attach(recorder)
+
+	// opus samples without a level and other samples are forwarded only
+	assert.NoError(t, vad.Write(&avp.Sample{ID: "mic", Type: avp.TypeOpus, Payload: rawOpusFrame}))
+	assert.NoError(t, vad.Write(&avp.Sample{ID: "cam", Type: avp.TypeVP8, Payload: rawVP8KeyframePkt}))
+
+	for i, level := range []uint8{127, 20, 20, 20, 20} {
+		assert.NoError(t, vad.Write(&avp.Sample{
+			ID:         "mic",
+			Type:       avp.TypeOpus,
+			Timestamp:  uint32(i * 960),
+			AudioLevel: &rtp.AudioLevelExtension{Level: level},
+			Payload:    rawOpusFrame,
+		}))
+	}
+
+	recorder.Lock()
+	assert.Len(t, recorder.samples, 2+5+1)
+	events := vadEvents(recorder.samples)
+	assert.Len(t, events, 1)
+	assert.True(t, events[0].Payload.(VADEvent).Speaking)
+	assert.Equal(t, uint32(960), events[0].Timestamp)
+	recorder.Unlock()
+
+	// the speech ends on close
+	vad.Close()
+	events = vadEvents(recorder.samples)
+	assert.Len(t, events, 2)
+	assert.False(t, events[1].Payload.(VADEvent).Speaking)
+	assert.Equal(t, uint32(4*960), events[1].Timestamp)
+}
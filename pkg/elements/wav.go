@@ -0,0 +1,220 @@
+package elements
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+
+	avp "github.com/pion/ion-avp/pkg"
+	log "github.com/pion/ion-log"
+)
+
+const (
+	wavFormatPCM   = 1
+	wavFormatFloat = 3
+	wavFormatMuLaw = 7
+
+	// the junk chunk reserves the space of the rf64 ds64 chunk
+	wavJunkSize = 28
+	wavFmtAt    = 12 + 8 + wavJunkSize
+	wavFmtSize  = 16
+	// formats other than pcm have the cbSize field and a fact chunk
+	wavFmtExtSize = 18
+	wavFactSize   = 4
+)
+
+// WAVWriterConfig configures a WAVWriter
+type WAVWriterConfig struct {
+	// Format of the samples. Defaults to PCMFormatS16LE.
+	Format PCMFormat
+}
+
+// WAVWriter writes the PCM samples of a track as a wav file. The first
+// sample sets the sample rate and channels of the header, the sizes of
+// the header are patched on close. Files over 4GB are patched to rf64.
+type WAVWriter struct {
+	Node
+	mu         sync.Mutex
+	config     WAVWriterConfig
+	sampleRate int
+	channels   int
+	factAt     int // 0 without fact chunk
+	dataAt     int
+	size       uint64 // of the data chunk
+	closed     bool
+}
+
+// NewWAVWriter instance
+func NewWAVWriter(config WAVWriterConfig) *WAVWriter {
+	return &WAVWriter{
+		config: config,
+	}
+}
+
+func (w *WAVWriter) Write(sample *avp.Sample) error {
+	if sample.Type != TypePCM {
+		return nil
+	}
+	pcm, ok := sample.Payload.(PCM)
+	if !ok {
+		return ErrUnsupportedPayload
+	}
+	if len(pcm.Data) == 0 || pcm.Channels == 0 || pcm.SampleRate == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+
+	if w.channels == 0 {
+		w.sampleRate = pcm.SampleRate
+		w.channels = pcm.Channels
+		log.Infof("WAV writer has started with sample rate=%d, channels=%d", w.sampleRate, w.channels)
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	} else if pcm.SampleRate != w.sampleRate || pcm.Channels != w.channels {
+		log.Warnf("WAV writer dropped sample with sample rate=%d, channels=%d", pcm.SampleRate, pcm.Channels)
+		return nil
+	}
+
+	data := w.config.Format.encode(pcm.Data)
+	w.size += uint64(len(data))
+
+	return w.Node.Write(&avp.Sample{
+		ID:        sample.ID,
+		Type:      TypeBinary,
+		Timestamp: sample.Timestamp,
+		Payload:   data,
+	})
+}
+
+func (w *WAVWriter) writeHeader() error {
+	format := wavFormatPCM
+	switch w.config.Format {
+	case PCMFormatF32LE:
+		format = wavFormatFloat
+	case PCMFormatMuLaw:
+		format = wavFormatMuLaw
+	}
+	bits := w.config.Format.size() * 8
+	align := w.channels * bits / 8
+
+	fmtSize := wavFmtSize
+	w.dataAt = wavFmtAt + 8 + fmtSize
+	if format != wavFormatPCM {
+		fmtSize = wavFmtExtSize
+		w.factAt = wavFmtAt + 8 + fmtSize
+		w.dataAt = w.factAt + 8 + wavFactSize
+	}
+
+	header := make([]byte, w.headerSize())
+	copy(header[0:], "RIFF")
+	copy(header[8:], "WAVE")
+	copy(header[12:], "JUNK")
+	binary.LittleEndian.PutUint32(header[16:], wavJunkSize)
+	copy(header[wavFmtAt:], "fmt ")
+	binary.LittleEndian.PutUint32(header[wavFmtAt+4:], uint32(fmtSize))
+	binary.LittleEndian.PutUint16(header[wavFmtAt+8:], uint16(format))
+	binary.LittleEndian.PutUint16(header[wavFmtAt+10:], uint16(w.channels))
+	binary.LittleEndian.PutUint32(header[wavFmtAt+12:], uint32(w.sampleRate))
+	binary.LittleEndian.PutUint32(header[wavFmtAt+16:], uint32(w.sampleRate*align)) // byte rate
+	binary.LittleEndian.PutUint16(header[wavFmtAt+20:], uint16(align))
+	binary.LittleEndian.PutUint16(header[wavFmtAt+22:], uint16(bits))
+	if w.factAt != 0 {
+		// the cbSize is 0, the sample length is set on close
+		copy(header[w.factAt:], "fact")
+		binary.LittleEndian.PutUint32(header[w.factAt+4:], wavFactSize)
+	}
+	copy(header[w.dataAt:], "data")
+	// the sizes are set on close
+	binary.LittleEndian.PutUint32(header[4:], uint32(w.headerSize()-8))
+
+	return w.Node.Write(&avp.Sample{
+		Type:    TypeBinary,
+		Payload: header,
+	})
+}
+
+// headerSize returns the size of the header up to the data
+func (w *WAVWriter) headerSize() int {
+	return w.dataAt + 8
+}
+
+// patches returns the patches of the header with the sizes of the data,
+// an odd sized data chunk is followed by a pad byte
+func (w *WAVWriter) patches() []Patch {
+	riff := w.size + w.size%2 + uint64(w.headerSize()) - 8
+	frames := w.size / uint64(w.channels*w.config.Format.size())
+	if riff <= math.MaxUint32 {
+		patches := []Patch{
+			{Offset: 4, Data: u32le(uint32(riff))},
+			{Offset: int64(w.dataAt) + 4, Data: u32le(uint32(w.size))},
+		}
+		if w.factAt != 0 {
+			patches = append(patches, Patch{Offset: int64(w.factAt) + 8, Data: u32le(uint32(frames))})
+		}
+		return patches
+	}
+
+	// rf64 has the sizes in the ds64 chunk replacing the junk chunk
+	ds64 := make([]byte, 8+wavJunkSize)
+	copy(ds64[0:], "ds64")
+	binary.LittleEndian.PutUint32(ds64[4:], wavJunkSize)
+	binary.LittleEndian.PutUint64(ds64[8:], riff)
+	binary.LittleEndian.PutUint64(ds64[16:], w.size)
+	binary.LittleEndian.PutUint64(ds64[24:], frames)
+	patches := []Patch{
+		{Offset: 0, Data: append([]byte("RF64"), u32le(math.MaxUint32)...)},
+		{Offset: 12, Data: ds64},
+		{Offset: int64(w.dataAt) + 4, Data: u32le(math.MaxUint32)},
+	}
+	if w.factAt != 0 {
+		// the sample length is in the ds64 chunk
+		patches = append(patches, Patch{Offset: int64(w.factAt) + 8, Data: u32le(math.MaxUint32)})
+	}
+	return patches
+}
+
+// Close patches the sizes of the header and closes the children
+func (w *WAVWriter) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+
+	if w.channels != 0 {
+		if w.size%2 != 0 {
+			if err := w.Node.Write(&avp.Sample{
+				Type:    TypeBinary,
+				Payload: []byte{0},
+			}); err != nil {
+				log.Errorf("wav pad byte err: %s", err)
+			}
+		}
+		for _, patch := range w.patches() {
+			if err := w.Node.Write(&avp.Sample{
+				Type:    TypePatch,
+				Payload: patch,
+			}); err != nil {
+				log.Errorf("wav size patch err: %s", err)
+				break
+			}
+		}
+	}
+	w.mu.Unlock()
+
+	w.Node.Close()
+}
+
+func u32le(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
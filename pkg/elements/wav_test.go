@@ -0,0 +1,135 @@
+package elements
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+
+	avp "github.com/pion/ion-avp/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAVWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	writer := NewWAVWriter(WAVWriterConfig{})
+	writer.Attach(NewFileWriter(path, 1024))
+
+	stereo := PCM{Data: []int16{1, -1, 2, -2}, SampleRate: 16000, Channels: 2}
+	assert.NoError(t, writer.Write(&avp.Sample{Type: TypePCM, Payload: stereo}))
+	assert.NoError(t, writer.Write(&avp.Sample{Type: TypePCM, Payload: stereo}))
+	// other formats are dropped
+	assert.NoError(t, writer.Write(&avp.Sample{Type: TypePCM, Payload: sine(1000)}))
+	writer.Close()
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	wavDataAt := wavFmtAt + 8 + wavFmtSize
+	wavHeaderSize := wavDataAt + 8
+	assert.Len(t, data, wavHeaderSize+16)
+	assert.Equal(t, "RIFF", string(data[0:4]))
+	assert.Equal(t, uint32(len(data)-8), binary.LittleEndian.Uint32(data[4:]))
+	assert.Equal(t, "WAVE", string(data[8:12]))
+
+	// chunks after the junk chunk
+	chunk := data[wavFmtAt:]
+	assert.Equal(t, "fmt ", string(chunk[0:4]))
+	assert.Equal(t, uint32(16), binary.LittleEndian.Uint32(chunk[4:]))
+	assert.Equal(t, uint16(wavFormatPCM), binary.LittleEndian.Uint16(chunk[8:]))
+	assert.Equal(t, uint16(2), binary.LittleEndian.Uint16(chunk[10:]))
+	assert.Equal(t, uint32(16000), binary.LittleEndian.Uint32(chunk[12:]))
+	assert.Equal(t, uint32(64000), binary.LittleEndian.Uint32(chunk[16:]))
+	assert.Equal(t, uint16(4), binary.LittleEndian.Uint16(chunk[20:]))
+	assert.Equal(t, uint16(16), binary.LittleEndian.Uint16(chunk[22:]))
+	assert.Equal(t, "data", string(data[wavDataAt:wavDataAt+4]))
+	assert.Equal(t, uint32(16), binary.LittleEndian.Uint32(data[wavDataAt+4:]))
+	assert.Equal(t, []byte{1, 0, 0xff, 0xff, 2, 0, 0xfe, 0xff}, data[wavHeaderSize:wavHeaderSize+8])
+}
+
+func TestWAVWriter_RF64(t *testing.T) {
+	writer := NewWAVWriter(WAVWriterConfig{Format: PCMFormatF32LE})
+	recorder := &sampleCollector{}
+	writer.Attach(recorder)
+	assert.NoError(t, writer.Write(&avp.Sample{Type: TypePCM, Payload: sine(1000)}))
+
+	header := recorder.samples[0].Payload.([]byte)
+	wavHeaderSize := len(header)
+	assert.Equal(t, uint16(wavFormatFloat), binary.LittleEndian.Uint16(header[wavFmtAt+8:]))
+	assert.Equal(t, uint16(32), binary.LittleEndian.Uint16(header[wavFmtAt+22:]))
+	assert.Len(t, recorder.samples[1].Payload, 960*4)
+
+	// as if 6GB had been written
+	writer.size = 6 << 30
+	writer.Close()
+	assert.True(t, recorder.closed)
+
+	var patches []Patch
+	for _, sample := range recorder.samples[2:] {
+		patches = append(patches, sample.Payload.(Patch))
+	}
+	assert.Len(t, patches, 4)
+	assert.Equal(t, Patch{Offset: 0, Data: []byte{'R', 'F', '6', '4', 0xff, 0xff, 0xff, 0xff}}, patches[0])
+	ds64 := patches[1].Data
+	assert.Equal(t, int64(12), patches[1].Offset)
+	assert.Equal(t, "ds64", string(ds64[0:4]))
+	assert.Equal(t, uint64(6<<30+wavHeaderSize-8), binary.LittleEndian.Uint64(ds64[8:]))
+	assert.Equal(t, uint64(6<<30), binary.LittleEndian.Uint64(ds64[16:]))
+	assert.Equal(t, uint64(6<<30/4), binary.LittleEndian.Uint64(ds64[24:]))
+	assert.Equal(t, Patch{Offset: int64(wavHeaderSize) - 4, Data: []byte{0xff, 0xff, 0xff, 0xff}}, patches[2])
+	// the fact sample length is in the ds64 chunk
+	assert.Equal(t, Patch{Offset: int64(wavHeaderSize) - 12, Data: []byte{0xff, 0xff, 0xff, 0xff}}, patches[3])
+}
+
+func TestWAVWriter_MuLaw(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	writer := NewWAVWriter(WAVWriterConfig{Format: PCMFormatMuLaw})
+	writer.Attach(NewFileWriter(path, 1024))
+
+	mono := PCM{Data: []int16{0, 1000, -1000}, SampleRate: 8000, Channels: 1}
+	assert.NoError(t, writer.Write(&avp.Sample{Type: TypePCM, Payload: mono}))
+	writer.Close()
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+
+	// the fmt chunk has the cbSize, a fact chunk has the sample length
+	chunk := data[wavFmtAt:]
+	assert.Equal(t, uint32(18), binary.LittleEndian.Uint32(chunk[4:]))
+	assert.Equal(t, uint16(wavFormatMuLaw), binary.LittleEndian.Uint16(chunk[8:]))
+	assert.Equal(t, uint16(8), binary.LittleEndian.Uint16(chunk[22:]))
+	assert.Equal(t, uint16(0), binary.LittleEndian.Uint16(chunk[24:]))
+	chunk = chunk[8+18:]
+	assert.Equal(t, "fact", string(chunk[0:4]))
+	assert.Equal(t, uint32(4), binary.LittleEndian.Uint32(chunk[4:]))
+	assert.Equal(t, uint32(3), binary.LittleEndian.Uint32(chunk[8:]))
+
+	// the odd sized data chunk is padded
+	chunk = chunk[12:]
+	assert.Equal(t, "data", string(chunk[0:4]))
+	assert.Equal(t, uint32(3), binary.LittleEndian.Uint32(chunk[4:]))
+	assert.Len(t, chunk, 8+4)
+	assert.Equal(t, byte(0), chunk[8+3])
+	assert.Equal(t, uint32(len(data)-8), binary.LittleEndian.Uint32(data[4:]))
+}
+
+func TestRawPCMWriter(t *testing.T) {
+	pcm := PCM{Data: []int16{0, 16384, -32768}, SampleRate: 48000, Channels: 1}
+
+	recorder := &sampleCollector{}
+	writer := NewRawPCMWriter(PCMFormatS16LE)
+	writer.Attach(recorder)
+	assert.NoError(t, writer.Write(&avp.Sample{Type: TypePCM, Timestamp: 960, Payload: pcm}))
+	assert.Equal(t, uint32(960), recorder.samples[0].Timestamp)
+	assert.Equal(t, []byte{0, 0, 0, 0x40, 0, 0x80}, recorder.samples[0].Payload)
+
+	recorder = &sampleCollector{}
+	writer = NewRawPCMWriter(PCMFormatF32LE)
+	writer.Attach(recorder)
+	assert.NoError(t, writer.Write(&avp.Sample{Type: TypePCM, Payload: pcm}))
+	data := recorder.samples[0].Payload.([]byte)
+	assert.Len(t, data, 12)
+	for i, v := range []float32{0, 0.5, -1} {
+		assert.Equal(t, v, math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:])))
+	}
+}
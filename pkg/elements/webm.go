@@ -17,6 +17,8 @@ const (
 	defaultHeight          = 480
 	maxBufferedSamples     = 60 * 15 // 60 FPS for 15 seconds
 	maxAudioVideoSyncDelay = time.Duration(15) * time.Second
+	// time of video after the first keyframe the audio track is waited for
+	webmAudioWait = time.Second
 )
 
 // webmSaverStats keep track of statistics for the sake of logging
@@ -27,10 +29,20 @@ type webmSaverStats struct {
 	unknown                    int
 }
 
-// WebmSaver Module for saving rtp streams to webm
+// webmCodecIDs maps the video sample types to their matroska codec id
+var webmCodecIDs = map[int]string{
+	avp.TypeVP8:  "V_VP8",
+	avp.TypeVP9:  "V_VP9",
+	avp.TypeH264: "V_MPEG4/ISO/AVC",
+}
+
+// WebmSaver Module for saving rtp streams to webm. The video codec is
+// the codec of the first video keyframe, h264 is saved as matroska.
+// Only the audio and video tracks samples were received for are saved.
 type WebmSaver struct {
 	sync.Mutex
 	firstWrite                     bool
+	videoType                      int
 	dateUTC                        time.Time
 	closed                         bool
 	writeInProgress                int32
@@ -39,6 +51,10 @@ type WebmSaver struct {
 	audioTimestamp, videoTimestamp uint32
 	sampleWriter                   *SampleWriter
 	preBuffering                   []*avp.Sample
+	preBufferDropped               bool
+	hasAudio                       bool        // opus samples were buffered
+	keyframe                       *avp.Sample // first video keyframe
+	width, height                  int         // of the keyframe
 
 	statsContext      string
 	preBufferingStats webmSaverStats
@@ -79,28 +95,34 @@ func (s *WebmSaver) Write(sample *avp.Sample) error {
 	atomic.StoreInt32(&(s.writeInProgress), 1)
 	s.Unlock()
 
-	if s.handlePrebuffer(sample) {
-		atomic.StoreInt32(&(s.writeInProgress), 0)
-		return nil
+	if !s.handlePrebuffer(sample) {
+		s.push(sample)
 	}
+	atomic.StoreInt32(&(s.writeInProgress), 0)
+	return nil
+}
 
+// push writes a sample to the track of its type
+func (s *WebmSaver) push(sample *avp.Sample) {
 	s.handleStats(sample, &s.liveStats)
 
-	if sample.Type == avp.TypeVP8 {
+	if sample.Type == s.videoType {
 		if sample.PrevDroppedPackets > 0 {
 			s.pushVideoDropped(sample)
 		}
-		s.pushVP8(sample)
+		s.pushVideo(sample)
 	} else if sample.Type == avp.TypeOpus {
 		if sample.PrevDroppedPackets > 0 {
 			s.pushAudioDropped(sample)
 		}
 		s.pushOpus(sample)
 	}
-	atomic.StoreInt32(&(s.writeInProgress), 0)
-	return nil
 }
 
+// handlePrebuffer buffers the samples until the tracks are known, it
+// returns false once the writer is initialized. The writer starts with
+// the first video keyframe when audio was received too, or no audio was
+// received for webmAudioWait of video. A nil sample flushes the buffer.
 func (s *WebmSaver) handlePrebuffer(sample *avp.Sample) bool {
 	if s.preBuffering == nil {
 		return false
@@ -108,48 +130,105 @@ func (s *WebmSaver) handlePrebuffer(sample *avp.Sample) bool {
 
 	s.handleStats(sample, &s.preBufferingStats)
 
-	if sample != nil {
-		s.preBuffering = append(s.preBuffering, sample)
+	if sample == nil {
+		s.start()
+		return true
 	}
 
-	initVideoNow := func(useWidth, useHeight int) {
-		// Initialize WebM saver using received frame size.
-		s.initWriter(useWidth, useHeight)
-
-		preBuffering := s.preBuffering
-		s.preBuffering = nil
-
-		for _, bufferedSample := range preBuffering {
-			_ = s.Write(bufferedSample)
+	if sample.Type == avp.TypeOpus {
+		s.hasAudio = true
+	} else if _, ok := webmCodecIDs[sample.Type]; ok {
+		if s.videoType == 0 {
+			s.videoType = sample.Type
 		}
+		if s.keyframe == nil {
+			s.findKeyframe(sample)
+		}
+	} else {
+		return true
 	}
+	s.preBuffering = append(s.preBuffering, sample)
 
-	if sample == nil || len(s.preBuffering) == cap(s.preBuffering) {
-		initVideoNow(defaultWidth, defaultHeight)
+	if s.keyframe != nil {
+		waited := sample.Type == s.videoType &&
+			sample.Timestamp-s.keyframe.Timestamp >= uint32(webmAudioWait.Seconds()*90000)
+		if s.hasAudio || waited {
+			s.start()
+		}
 		return true
 	}
 
-	if sample.Type != avp.TypeVP8 {
-		return true
+	if len(s.preBuffering) == cap(s.preBuffering) {
+		// h264 can't be decoded without the codec parameters of a
+		// keyframe, the video is dropped until one is received
+		if s.videoType == avp.TypeH264 && s.dropVideo() {
+			return true
+		}
+		s.start()
 	}
+	return true
+}
 
+// findKeyframe keeps a keyframe with the frame size and, for h264, the
+// codec parameters. The video type is the type of the keyframe.
+func (s *WebmSaver) findKeyframe(sample *avp.Sample) {
 	payload := sample.Payload.([]byte)
-	if len(payload) < 10 {
-		return true
+	width, height, ok := frameSize(sample.Type, payload)
+	if !ok {
+		return
+	}
+	if sample.Type == avp.TypeH264 && h264CodecPrivate(payload) == nil {
+		return
 	}
+	s.videoType = sample.Type
+	s.keyframe = sample
+	s.width, s.height = width, height
+}
 
-	// Read VP8 header.
-	if payload[0]&0x1 != 0 {
-		return true
+// dropVideo removes the buffered video samples, false when there were
+// none
+func (s *WebmSaver) dropVideo() bool {
+	buffered := s.preBuffering[:0]
+	for _, sample := range s.preBuffering {
+		if sample.Type == avp.TypeOpus {
+			buffered = append(buffered, sample)
+		}
 	}
+	dropped := len(buffered) != len(s.preBuffering)
+	if dropped && !s.preBufferDropped {
+		log.Warnf("WebM saver received no %s keyframe with codec parameters, dropping video", webmCodecIDs[s.videoType])
+		s.preBufferDropped = true
+	}
+	s.preBuffering = buffered
+	return dropped
+}
 
-	// Keyframe has frame information.
-	raw := uint(payload[6]) | uint(payload[7])<<8 | uint(payload[8])<<16 | uint(payload[9])<<24
-	width := int(raw & 0x3FFF)
-	height := int((raw >> 16) & 0x3FFF)
+// start initializes the writer with the tracks of the buffered samples
+// and writes them
+func (s *WebmSaver) start() {
+	preBuffering := s.preBuffering
+	s.preBuffering = nil
 
-	initVideoNow(width, height)
-	return true
+	video := s.videoType != 0
+	if video && s.videoType == avp.TypeH264 && s.keyframe == nil {
+		log.Errorf("WebM saver received no %s keyframe with codec parameters, video was not saved", webmCodecIDs[s.videoType])
+		video = false
+	}
+	if !video && !s.hasAudio {
+		return
+	}
+
+	width, height := defaultWidth, defaultHeight
+	var keyframe []byte
+	if s.keyframe != nil {
+		width, height = s.width, s.height
+		keyframe = s.keyframe.Payload.([]byte)
+	}
+	s.initWriter(s.hasAudio, video, width, height, keyframe)
+
+	for _, sample := range preBuffering {
+		s.push(sample)
+	}
 }
 
 func (s *WebmSaver) handleStats(sample *avp.Sample, useStats *webmSaverStats) {
@@ -176,14 +255,12 @@ func (s *WebmSaver) handleStats(sample *avp.Sample, useStats *webmSaverStats) {
 			report(&useStats.droppedAudio, int(sample.PrevDroppedPackets), 0xFF, "audio dropped")
 		}
 		report(&useStats.audio, 1, 0xFF, "audio")
-	case avp.TypeVP8:
+	case avp.TypeVP8, avp.TypeVP9, avp.TypeH264:
 		if sample.PrevDroppedPackets > 0 {
 			report(&useStats.droppedVideo, int(sample.PrevDroppedPackets), 0xFF, "video dropped")
 		}
 
-		payload := sample.Payload.([]byte)
-
-		videoKeyframe := (payload[0]&0x1 == 0)
+		videoKeyframe := isKeyframe(sample.Type, sample.Payload.([]byte))
 
 		if videoKeyframe {
 			report(&useStats.videoKey, 1, 0x3, "video key")
@@ -200,6 +277,11 @@ func (s *WebmSaver) Attach(e avp.Element) {
 	s.sampleWriter.Attach(e)
 }
 
+// Children returns the elements the webm stream is written to
+func (s *WebmSaver) Children() []avp.Element {
+	return s.sampleWriter.Children()
+}
+
 // Close Close the WebmSaver
 func (s *WebmSaver) Close() {
 
@@ -273,7 +355,7 @@ func (s *WebmSaver) pushAudioDropped(sample *avp.Sample) {
 }
 
 func (s *WebmSaver) pushVideoDropped(sample *avp.Sample) {
-	if s.vttAudioWriter != nil {
+	if s.vttVideoWriter != nil {
 		var metaPayload [2]byte
 		// big endian encoded value as two bytes
 		metaPayload[0] = uint8(sample.PrevDroppedPackets >> 8)
@@ -303,10 +385,11 @@ func (s *WebmSaver) pushOpus(sample *avp.Sample) {
 	}
 }
 
-func (s *WebmSaver) pushVP8(sample *avp.Sample) {
+func (s *WebmSaver) pushVideo(sample *avp.Sample) {
 	payload := sample.Payload.([]byte)
-	// Read VP8 header.
-	videoKeyframe := (payload[0]&0x1 == 0)
+	videoKeyframe := isKeyframe(sample.Type, payload)
+	// h264 nal units are length prefixed
+	payload = mp4SampleData(sample.Type, payload)
 
 	if s.videoWriter != nil {
 		if s.videoTimestamp == 0 {
@@ -319,10 +402,30 @@ func (s *WebmSaver) pushVP8(sample *avp.Sample) {
 	}
 }
 
-func (s *WebmSaver) initWriter(width, height int) {
+// h264CodecPrivate returns the avc decoder configuration of the
+// parameter sets of a keyframe, nil when it has none
+func h264CodecPrivate(keyframe []byte) []byte {
+	sps, pps := h264ParameterSets(splitAnnexB(keyframe))
+	if parsed, ok := parseH264SPS(sps); ok && pps != nil {
+		// avcC box payload
+		return mp4Avcc(sps, pps, parsed)[8:]
+	}
+	return nil
+}
+
+// initWriter creates the audio and video tracks, each with a track of
+// the dropped packets
+func (s *WebmSaver) initWriter(audio, video bool, width, height int, keyframe []byte) {
 	useInterceptor := mkvcore.MustBlockInterceptor(mkvcore.NewMultiTrackBlockSorter(mkvcore.WithMaxTimescaleDelay(maxAudioVideoSyncDelay.Milliseconds()), mkvcore.WithSortRule(mkvcore.BlockSorterDropOutdated)))
 
+	header := *webm.DefaultEBMLHeader
+	if video && s.videoType == avp.TypeH264 {
+		// h264 isn't allowed in webm
+		header.DocType = "matroska"
+	}
+
 	options := []mkvcore.BlockWriterOption{
+		mkvcore.WithEBMLHeader(&header),
 		mkvcore.WithSegmentInfo(&webm.Info{
 			TimecodeScale: webm.DefaultSegmentInfo.TimecodeScale,
 			MuxingApp:     webm.DefaultSegmentInfo.MuxingApp,
@@ -332,54 +435,72 @@ func (s *WebmSaver) initWriter(width, height int) {
 		mkvcore.WithSeekHead(true),
 		mkvcore.WithBlockInterceptor(useInterceptor),
 	}
-	ws, err := webm.NewSimpleBlockWriter(s.sampleWriter,
-		[]webm.TrackEntry{
-			{
-				Name:            "VttAudioDroppedPacketMeta",
-				TrackNumber:     1,
-				TrackUID:        98765,
-				CodecID:         "D_WEBVTT/METADATA",
-				TrackType:       0x21,
-				DefaultDuration: 20000000,
-			}, {
-				Name:            "Audio",
-				TrackNumber:     2,
-				TrackUID:        12345,
-				CodecID:         "A_OPUS",
-				TrackType:       2,
-				DefaultDuration: 20000000,
-				Audio: &webm.Audio{
-					SamplingFrequency: 48000.0,
-					Channels:          2,
-				},
-			}, {
-				Name:            "VttVideoDroppedPacketMeta",
-				TrackNumber:     3,
-				TrackUID:        54321,
-				CodecID:         "D_WEBVTT/METADATA",
-				TrackType:       0x21,
-				DefaultDuration: 20000000,
-			}, {
-				Name:            "Video",
-				TrackNumber:     4,
-				TrackUID:        67890,
-				CodecID:         "V_VP8",
-				TrackType:       1,
-				DefaultDuration: 20000000,
-				Video: &webm.Video{
-					PixelWidth:  uint64(width),
-					PixelHeight: uint64(height),
-				},
+
+	var tracks []webm.TrackEntry
+	var writers []*webm.BlockWriteCloser
+	if audio {
+		tracks = append(tracks, webm.TrackEntry{
+			Name:            "VttAudioDroppedPacketMeta",
+			TrackNumber:     uint64(len(tracks) + 1),
+			TrackUID:        98765,
+			CodecID:         "D_WEBVTT/METADATA",
+			TrackType:       0x21,
+			DefaultDuration: 20000000,
+		}, webm.TrackEntry{
+			Name:            "Audio",
+			TrackNumber:     uint64(len(tracks) + 2),
+			TrackUID:        12345,
+			CodecID:         "A_OPUS",
+			TrackType:       2,
+			DefaultDuration: 20000000,
+			Audio: &webm.Audio{
+				SamplingFrequency: 48000.0,
+				Channels:          2,
 			},
-		}, options...)
+		})
+		writers = append(writers, &s.vttAudioWriter, &s.audioWriter)
+	}
+	if video {
+		var codecPrivate []byte
+		if s.videoType == avp.TypeH264 {
+			codecPrivate = h264CodecPrivate(keyframe)
+		}
+		tracks = append(tracks, webm.TrackEntry{
+			Name:            "VttVideoDroppedPacketMeta",
+			TrackNumber:     uint64(len(tracks) + 1),
+			TrackUID:        54321,
+			CodecID:         "D_WEBVTT/METADATA",
+			TrackType:       0x21,
+			DefaultDuration: 20000000,
+		}, webm.TrackEntry{
+			Name:            "Video",
+			TrackNumber:     uint64(len(tracks) + 2),
+			TrackUID:        67890,
+			CodecID:         webmCodecIDs[s.videoType],
+			CodecPrivate:    codecPrivate,
+			TrackType:       1,
+			DefaultDuration: 20000000,
+			Video: &webm.Video{
+				PixelWidth:  uint64(width),
+				PixelHeight: uint64(height),
+			},
+		})
+		writers = append(writers, &s.vttVideoWriter, &s.videoWriter)
+	}
+
+	ws, err := webm.NewSimpleBlockWriter(s.sampleWriter, tracks, options...)
 	if err != nil {
 		log.Errorf("init writer err: %s", err)
+		return
+	}
+	if video {
+		log.Infof("WebM saver has started with video codec=%s, width=%d, height=%d, audio=%t\n", webmCodecIDs[s.videoType], width, height, audio)
+	} else {
+		log.Infof("WebM saver has started with audio only\n")
+	}
+	for i, w := range ws {
+		*writers[i] = w
 	}
-	log.Infof("WebM saver has started with video width=%d, height=%d\n", width, height)
-	s.audioWriter = ws[1]
-	s.videoWriter = ws[3]
-	s.vttAudioWriter = ws[0]
-	s.vttVideoWriter = ws[2]
 }
 
 // SampleWriter for writing samples
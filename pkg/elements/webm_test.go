@@ -87,3 +87,135 @@ func TestWebMSaver_BlockWriterInit(t *testing.T) {
 
 	assert.Len(t, header.Segment.Tracks.TrackEntry, 4)
 }
+
+func TestWebMSaver_VideoCodecs(t *testing.T) {
+	for _, tc := range []struct {
+		typ          int
+		keyframe     []byte
+		docType      string
+		codecID      string
+		codecPrivate []byte
+		width        uint64
+	}{
+		{avp.TypeVP9, rawVP9KeyframePkt, "webm", "V_VP9", nil, 640},
+		{avp.TypeH264, annexB(rawH264SPS, rawH264PPS, rawH264IDR), "matroska", "V_MPEG4/ISO/AVC", mp4Avcc(rawH264SPS, rawH264PPS, h264SPS{profile: 66, compatibility: 0xc0, level: 30})[8:], 320},
+	} {
+		saver := NewWebmSaver()
+		writer := NewBufWriter()
+		saver.Attach(writer)
+
+		// video of another codec is ignored
+		assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeVP8, Payload: rawVP8KeyframePkt[:1]}))
+		assert.NoError(t, saver.Write(&avp.Sample{Type: tc.typ, Timestamp: 3000, Payload: tc.keyframe}))
+		assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeOpus, Timestamp: 960, Payload: rawOpusPkt}))
+		saver.Close()
+
+		var header Header
+		writer.Lock()
+		assert.NoError(t, ebml.Unmarshal(bytes.NewReader(writer.buf.Bytes()), &header))
+		writer.Unlock()
+
+		assert.Equal(t, tc.docType, header.Header.DocType)
+		video := header.Segment.Tracks.TrackEntry[3]
+		assert.Equal(t, tc.codecID, video.CodecID)
+		assert.Equal(t, tc.codecPrivate, video.CodecPrivate)
+		assert.Equal(t, tc.width, video.Video.PixelWidth)
+	}
+}
+
+// webmCodecs returns the codec ids of the tracks of a webm stream
+func webmCodecs(t *testing.T, writer *BufWriter) (Header, []string) {
+	var header Header
+	writer.Lock()
+	assert.NoError(t, ebml.Unmarshal(bytes.NewReader(writer.buf.Bytes()), &header))
+	writer.Unlock()
+
+	var codecs []string
+	for _, track := range header.Segment.Tracks.TrackEntry {
+		codecs = append(codecs, track.CodecID)
+	}
+	return header, codecs
+}
+
+func TestWebMSaver_Tracks(t *testing.T) {
+	// audio only, the buffered samples are saved on close
+	saver := NewWebmSaver()
+	writer := NewBufWriter()
+	saver.Attach(writer)
+	for i := uint32(0); i < 3; i++ {
+		assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeOpus, Timestamp: i * 960, Payload: rawOpusPkt}))
+	}
+	saver.Close()
+	_, codecs := webmCodecs(t, writer)
+	assert.Equal(t, []string{"D_WEBVTT/METADATA", "A_OPUS"}, codecs)
+	collector := runFileSource(t, writeTempFile(t, "audio.webm", writer.buf.Bytes()))
+	assert.Len(t, collector.samples, 3)
+
+	// video only, the audio is waited for after the keyframe
+	saver = NewWebmSaver()
+	writer = NewBufWriter()
+	saver.Attach(writer)
+	for i := uint32(0); i < 30; i++ {
+		assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeVP8, Timestamp: i * 3000, Payload: rawKeyframePkt}))
+	}
+	writer.Lock()
+	assert.Equal(t, 0, writer.buf.Len())
+	writer.Unlock()
+	assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeVP8, Timestamp: 90000, Payload: rawKeyframePkt}))
+	writer.Lock()
+	assert.NotEqual(t, 0, writer.buf.Len())
+	writer.Unlock()
+	// audio after the writer started is dropped
+	assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeOpus, Timestamp: 960, Payload: rawOpusPkt}))
+	saver.Close()
+	_, codecs = webmCodecs(t, writer)
+	assert.Equal(t, []string{"D_WEBVTT/METADATA", "V_VP8"}, codecs)
+}
+
+func TestWebMSaver_H264WithoutParameters(t *testing.T) {
+	inter := annexB([]byte{0x41, 0x9a, 0x00})
+
+	saver := NewWebmSaver()
+	writer := NewBufWriter()
+	saver.Attach(writer)
+	// the buffer overflows before the keyframe
+	for i := 0; i < maxBufferedSamples+10; i++ {
+		assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeH264, Timestamp: uint32(i * 3000), Payload: inter}))
+	}
+	// an idr without parameter sets isn't enough
+	assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeH264, Payload: annexB(rawH264IDR)}))
+	writer.Lock()
+	assert.Equal(t, 0, writer.buf.Len())
+	writer.Unlock()
+
+	assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeH264, Timestamp: 3000000, Payload: annexB(rawH264SPS, rawH264PPS, rawH264IDR)}))
+	saver.Close()
+
+	header, codecs := webmCodecs(t, writer)
+	assert.Equal(t, []string{"D_WEBVTT/METADATA", "V_MPEG4/ISO/AVC"}, codecs)
+	assert.NotEmpty(t, header.Segment.Tracks.TrackEntry[1].CodecPrivate)
+
+	// nothing is saved without a keyframe
+	saver = NewWebmSaver()
+	writer = NewBufWriter()
+	saver.Attach(writer)
+	for i := 0; i < maxBufferedSamples+10; i++ {
+		assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeH264, Timestamp: uint32(i * 3000), Payload: inter}))
+	}
+	saver.Close()
+	assert.Equal(t, 0, writer.buf.Len())
+
+	// the audio is kept
+	saver = NewWebmSaver()
+	writer = NewBufWriter()
+	saver.Attach(writer)
+	for i := 0; i < maxBufferedSamples; i++ {
+		assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeH264, Timestamp: uint32(i * 3000), Payload: inter}))
+		assert.NoError(t, saver.Write(&avp.Sample{Type: avp.TypeOpus, Timestamp: uint32(i * 960), Payload: rawOpusPkt}))
+	}
+	saver.Close()
+	_, codecs = webmCodecs(t, writer)
+	assert.Equal(t, []string{"D_WEBVTT/METADATA", "A_OPUS"}, codecs)
+	collector := runFileSource(t, writeTempFile(t, "audio.webm", writer.buf.Bytes()))
+	assert.Len(t, collector.samples, maxBufferedSamples)
+}
@@ -1,6 +1,7 @@
 package avp
 
 import (
+	"io"
 	"sync"
 
 	log "github.com/pion/ion-log"
@@ -8,15 +9,29 @@ import (
 	"github.com/pion/webrtc/v3"
 )
 
+const (
+	// APIChannelLabel is the label of the data channel created for the sfu
+	APIChannelLabel = "ion-sfu"
+)
+
 type Publisher struct {
 	pc             *webrtc.PeerConnection
 	candidates     []webrtc.ICECandidateInit
 	candidatesLock sync.Mutex
+
+	channels     map[string]*webrtc.DataChannel
+	channelsLock sync.Mutex
+
+	iceRestart atomicBool
 }
 
 // NewPublisher creates a new Publisher
 func NewPublisher(cfg WebRTCTransportConfig) (*Publisher, error) {
-	api := webrtc.NewAPI(webrtc.WithSettingEngine(cfg.setting))
+	api, err := cfg.newAPI()
+	if err != nil {
+		log.Errorf("NewPublisher error: %v", err)
+		return nil, errPeerConnectionInitFailed
+	}
 	pc, err := api.NewPeerConnection(cfg.configuration)
 
 	if err != nil {
@@ -24,7 +39,7 @@ func NewPublisher(cfg WebRTCTransportConfig) (*Publisher, error) {
 		return nil, errPeerConnectionInitFailed
 	}
 
-	_, err = pc.CreateDataChannel("ion-sfu", &webrtc.DataChannelInit{})
+	dc, err := pc.CreateDataChannel(APIChannelLabel, &webrtc.DataChannelInit{})
 
 	if err != nil {
 		log.Errorf("error creating data channel: %v", err)
@@ -32,12 +47,19 @@ func NewPublisher(cfg WebRTCTransportConfig) (*Publisher, error) {
 	}
 
 	return &Publisher{
-		pc: pc,
+		pc:       pc,
+		channels: map[string]*webrtc.DataChannel{APIChannelLabel: dc},
 	}, nil
 }
 
 func (p *Publisher) CreateOffer() (webrtc.SessionDescription, error) {
-	offer, err := p.pc.CreateOffer(nil)
+	var options *webrtc.OfferOptions
+	if p.iceRestart.get() {
+		p.iceRestart.set(false)
+		options = &webrtc.OfferOptions{ICERestart: true}
+	}
+
+	offer, err := p.pc.CreateOffer(options)
 	if err != nil {
 		return webrtc.SessionDescription{}, err
 	}
@@ -50,6 +72,70 @@ func (p *Publisher) CreateOffer() (webrtc.SessionDescription, error) {
 	return offer, nil
 }
 
+// RestartICE makes the next offer restart ice
+func (p *Publisher) RestartICE() {
+	p.iceRestart.set(true)
+}
+
+// AddTrack publishes a local track to the session. Adding a track
+// triggers a renegotiation with the sfu.
+func (p *Publisher) AddTrack(track webrtc.TrackLocal) (*webrtc.RTPSender, error) {
+	sender, err := p.pc.AddTrack(track)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		// Read incoming rtcp so interceptors are run
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Read(buf); err != nil {
+				if err != io.EOF && err != io.ErrClosedPipe {
+					log.Debugf("rtcp read error: %s", err)
+				}
+				return
+			}
+		}
+	}()
+
+	return sender, nil
+}
+
+// RemoveTrack stops sending a previously published track
+func (p *Publisher) RemoveTrack(sender *webrtc.RTPSender) error {
+	return p.pc.RemoveTrack(sender)
+}
+
+// DataChannel returns the publisher data channel with the given label,
+// creating it with init if it does not exist yet.
+func (p *Publisher) DataChannel(label string, init *webrtc.DataChannelInit) (*webrtc.DataChannel, error) {
+	p.channelsLock.Lock()
+	defer p.channelsLock.Unlock()
+
+	if dc := p.channels[label]; dc != nil {
+		return dc, nil
+	}
+
+	dc, err := p.pc.CreateDataChannel(label, init)
+	if err != nil {
+		return nil, err
+	}
+	p.channels[label] = dc
+	return dc, nil
+}
+
+// OnNegotiationNeeded sets a handler called when the publisher
+// must create a new offer, e.g. after tracks are added or removed.
+func (p *Publisher) OnNegotiationNeeded(f func()) {
+	p.pc.OnNegotiationNeeded(f)
+}
+
+// OnICEConnectionStateChange sets a handler called when the ice
+// connection state of the peer connection changes
+func (p *Publisher) OnICEConnectionStateChange(f func(webrtc.ICEConnectionState)) {
+	p.pc.OnICEConnectionStateChange(f)
+}
+
 // OnICECandidate handler
 func (p *Publisher) OnICECandidate(f func(c *webrtc.ICECandidate)) {
 	p.pc.OnICECandidate(f)
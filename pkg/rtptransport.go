@@ -0,0 +1,446 @@
+package avp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	log "github.com/pion/ion-log"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	rtpReceiveMTU = 1500
+
+	// a new ssrc of a stream replaces its track when the track received
+	// no packet for this long, e.g. after the sender restarted
+	rtpTrackIdle = 2 * time.Second
+	// tracks without packets for this long are removed
+	rtpTrackTimeout = 30 * time.Second
+)
+
+var (
+	errNoRTPStreams = errors.New("no rtp streams")
+
+	// static payload types that don't need an rtpmap
+	staticPayloadTypes = map[uint8]webrtc.RTPCodecCapability{
+		0: {MimeType: MimeTypePCMU, ClockRate: 8000},
+		8: {MimeType: MimeTypePCMA, ClockRate: 8000},
+		9: {MimeType: MimeTypeG722, ClockRate: 8000},
+	}
+)
+
+// RTPStream describes a stream of rtp packets received on a udp address
+type RTPStream struct {
+	ID     string
+	Kind   webrtc.RTPCodecType
+	Addr   *net.UDPAddr
+	Codecs []webrtc.RTPCodecParameters
+}
+
+func (s RTPStream) codec(pt uint8) (webrtc.RTPCodecParameters, bool) {
+	for _, c := range s.Codecs {
+		if uint8(c.PayloadType) == pt {
+			return c, true
+		}
+	}
+	return webrtc.RTPCodecParameters{}, false
+}
+
+// ParseRTPStreams returns the streams of the media descriptions of an sdp.
+// The track id of a stream is its mid, or its kind and port.
+func ParseRTPStreams(raw []byte) ([]RTPStream, error) {
+	desc := sdp.SessionDescription{}
+	if err := desc.Unmarshal(raw); err != nil {
+		return nil, err
+	}
+
+	var streams []RTPStream
+	for _, md := range desc.MediaDescriptions {
+		kind := webrtc.NewRTPCodecType(md.MediaName.Media)
+		if kind == 0 {
+			continue
+		}
+
+		ip := net.IPv4zero
+		conn := desc.ConnectionInformation
+		if md.ConnectionInformation != nil {
+			conn = md.ConnectionInformation
+		}
+		if conn != nil && conn.Address != nil {
+			if parsed := net.ParseIP(conn.Address.Address); parsed != nil {
+				ip = parsed
+			}
+		}
+
+		id, ok := md.Attribute("mid")
+		if !ok {
+			id = fmt.Sprintf("%s-%d", md.MediaName.Media, md.MediaName.Port.Value)
+		}
+
+		stream := RTPStream{
+			ID:   id,
+			Kind: kind,
+			Addr: &net.UDPAddr{IP: ip, Port: md.MediaName.Port.Value},
+		}
+
+		// payload types are scoped to the media description
+		media := &sdp.SessionDescription{MediaDescriptions: []*sdp.MediaDescription{md}}
+		for _, format := range md.MediaName.Formats {
+			pt, err := strconv.ParseUint(format, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid payload type %s: %w", format, err)
+			}
+
+			capability, ok := staticPayloadTypes[uint8(pt)]
+			if codec, err := media.GetCodecForPayloadType(uint8(pt)); err == nil {
+				capability = webrtc.RTPCodecCapability{
+					MimeType:    md.MediaName.Media + "/" + codec.Name,
+					ClockRate:   codec.ClockRate,
+					SDPFmtpLine: codec.Fmtp,
+				}
+				if channels, err := strconv.ParseUint(codec.EncodingParameters, 10, 16); err == nil {
+					capability.Channels = uint16(channels)
+				}
+			} else if !ok {
+				log.Warnf("no rtpmap for payload type %d of stream %s", pt, id)
+				continue
+			}
+
+			stream.Codecs = append(stream.Codecs, webrtc.RTPCodecParameters{
+				RTPCodecCapability: capability,
+				PayloadType:        webrtc.PayloadType(pt),
+			})
+		}
+
+		streams = append(streams, stream)
+	}
+
+	return streams, nil
+}
+
+// RTPStreams returns the streams of an rtp source from its sdp file
+// or its configured streams.
+func (c rtpconf) RTPStreams() ([]RTPStream, error) {
+	if c.SDP != "" {
+		raw, err := ioutil.ReadFile(c.SDP)
+		if err != nil {
+			return nil, err
+		}
+		return ParseRTPStreams(raw)
+	}
+
+	var streams []RTPStream
+	for _, s := range c.Streams {
+		addr, err := net.ResolveUDPAddr("udp", s.Addr)
+		if err != nil {
+			return nil, err
+		}
+
+		kind := webrtc.NewRTPCodecType(strings.SplitN(strings.ToLower(s.MimeType), "/", 2)[0])
+		if kind == 0 {
+			return nil, fmt.Errorf("invalid codec mime type: %s", s.MimeType)
+		}
+
+		streams = append(streams, RTPStream{
+			ID:   s.ID,
+			Kind: kind,
+			Addr: addr,
+			Codecs: []webrtc.RTPCodecParameters{{
+				RTPCodecCapability: webrtc.RTPCodecCapability{
+					MimeType:    s.MimeType,
+					ClockRate:   s.ClockRate,
+					Channels:    s.Channels,
+					SDPFmtpLine: s.FmtpLine,
+				},
+				PayloadType: webrtc.PayloadType(s.PayloadType),
+			}},
+		})
+	}
+	return streams, nil
+}
+
+// rtpTrack is a track of the packets of one ssrc of an rtp stream
+type rtpTrack struct {
+	id       string
+	streamID string
+	kind     webrtc.RTPCodecType
+	ssrc     webrtc.SSRC
+	codec    webrtc.RTPCodecParameters
+	packets  chan *rtp.Packet
+	done     chan struct{} // closed when the transport is closed
+	removed  chan struct{} // closed when the track is removed
+	last     time.Time     // of the last packet, guarded by the transport lock
+	primary  bool          // the track has the stream id
+}
+
+func (t *rtpTrack) ID() string                       { return t.id }
+func (t *rtpTrack) StreamID() string                 { return t.streamID }
+func (t *rtpTrack) Kind() webrtc.RTPCodecType        { return t.kind }
+func (t *rtpTrack) SSRC() webrtc.SSRC                { return t.ssrc }
+func (t *rtpTrack) Codec() webrtc.RTPCodecParameters { return t.codec }
+
+// ReadRTP reads the next packet of the track
+func (t *rtpTrack) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
+	select {
+	case pkt := <-t.packets:
+		return pkt, nil, nil
+	case <-t.done:
+		return nil, nil, io.EOF
+	case <-t.removed:
+		return nil, nil, io.EOF
+	}
+}
+
+// RTPTransport receives plain rtp streams over udp, e.g. from cameras
+// or gateways. Packets are demuxed by ssrc, the first ssrc of a stream
+// is the track with the stream id, later ones get the ssrc appended.
+// A new ssrc replaces the track with the stream id when that track
+// went idle, its processes are attached to the new track. Tracks
+// without packets are removed after a timeout.
+type RTPTransport struct {
+	*session
+	conns  map[string]*net.UDPConn
+	tracks map[webrtc.SSRC]*rtpTrack
+	ids    map[string]*rtpTrack
+	done   chan struct{}
+	closed atomicBool
+	wg     sync.WaitGroup
+}
+
+// NewRTPTransport creates a new rtp transport listening for the streams
+func NewRTPTransport(id string, c Config, streams []RTPStream) (*RTPTransport, error) {
+	streams = supportedStreams(streams)
+	if len(streams) == 0 {
+		return nil, errNoRTPStreams
+	}
+
+	t := &RTPTransport{
+		session: newSession(id, c),
+		conns:   make(map[string]*net.UDPConn),
+		tracks:  make(map[webrtc.SSRC]*rtpTrack),
+		ids:     make(map[string]*rtpTrack),
+		done:    make(chan struct{}),
+	}
+
+	// streams sharing an address are demuxed by payload type
+	byAddr := make(map[string][]RTPStream)
+	for _, s := range streams {
+		byAddr[s.Addr.String()] = append(byAddr[s.Addr.String()], s)
+	}
+
+	for addr, streams := range byAddr {
+		var conn *net.UDPConn
+		var err error
+		if streams[0].Addr.IP.IsMulticast() {
+			conn, err = net.ListenMulticastUDP("udp", nil, streams[0].Addr)
+		} else {
+			conn, err = net.ListenUDP("udp", streams[0].Addr)
+		}
+		if err != nil {
+			t.Close()
+			return nil, err
+		}
+		log.Infof("Listening for rtp on %s", conn.LocalAddr())
+		t.conns[addr] = conn
+
+		t.wg.Add(1)
+		go t.read(conn, streams)
+	}
+
+	t.wg.Add(1)
+	go t.expire()
+
+	return t, nil
+}
+
+// supportedStreams returns the streams with the codecs samples can be
+// built of, packets of the other codecs are dropped.
+func supportedStreams(streams []RTPStream) []RTPStream {
+	var supported []RTPStream
+	for _, s := range streams {
+		var codecs []webrtc.RTPCodecParameters
+		for _, c := range s.Codecs {
+			if isSupportedCodec(c.MimeType) {
+				codecs = append(codecs, c)
+			} else {
+				log.Warnf("unsupported codec %s of rtp stream %s", c.MimeType, s.ID)
+			}
+		}
+		if len(codecs) == 0 {
+			continue
+		}
+		s.Codecs = codecs
+		supported = append(supported, s)
+	}
+	return supported
+}
+
+func (t *RTPTransport) read(conn *net.UDPConn, streams []RTPStream) {
+	defer t.wg.Done()
+
+	buf := make([]byte, rtpReceiveMTU)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if t.closed.get() {
+				return
+			}
+			log.Errorf("error reading rtp: %s", err)
+			continue
+		}
+
+		pkt := &rtp.Packet{}
+		if err := pkt.Unmarshal(append([]byte{}, buf[:n]...)); err != nil {
+			log.Debugf("invalid rtp packet: %s", err)
+			continue
+		}
+
+		track := t.track(pkt, streams)
+		if track == nil {
+			continue
+		}
+
+		select {
+		case track.packets <- pkt:
+		default:
+			log.Debugf("dropped rtp packet for track %s", track.id)
+		}
+	}
+}
+
+// track returns the track of the packet ssrc, adding it when
+// it's the first packet of the ssrc.
+func (t *RTPTransport) track(pkt *rtp.Packet, streams []RTPStream) *rtpTrack {
+	t.mu.Lock()
+	track := t.tracks[webrtc.SSRC(pkt.SSRC)]
+	if track != nil {
+		if uint8(track.codec.PayloadType) != pkt.PayloadType {
+			t.mu.Unlock()
+			return nil
+		}
+		track.last = time.Now()
+		t.mu.Unlock()
+		return track
+	}
+
+	for _, s := range streams {
+		codec, ok := s.codec(pkt.PayloadType)
+		if !ok {
+			continue
+		}
+
+		id, primary := s.ID, true
+		if prev := t.ids[id]; prev != nil {
+			if time.Since(prev.last) > rtpTrackIdle {
+				log.Infof("rtp track %s replaced by ssrc %d", id, pkt.SSRC)
+				t.removeTrack(prev)
+			} else {
+				id, primary = fmt.Sprintf("%s-%d", s.ID, pkt.SSRC), false
+			}
+		}
+
+		track = &rtpTrack{
+			id:       id,
+			streamID: t.id,
+			kind:     s.Kind,
+			ssrc:     webrtc.SSRC(pkt.SSRC),
+			codec:    codec,
+			packets:  make(chan *rtp.Packet, maxSize),
+			done:     t.done,
+			removed:  make(chan struct{}),
+			last:     time.Now(),
+			primary:  primary,
+		}
+		t.tracks[track.ssrc] = track
+		t.ids[id] = track
+		break
+	}
+	t.mu.Unlock()
+
+	if track == nil {
+		log.Debugf("no stream for payload type %d", pkt.PayloadType)
+		return nil
+	}
+
+	if _, err := t.addTrack(track); err != nil {
+		log.Warnf("dropped rtp track %s: %s", track.id, err)
+		return nil
+	}
+	return track
+}
+
+// expire removes the tracks without packets for the track timeout
+func (t *RTPTransport) expire() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.done:
+			return
+		}
+
+		t.mu.Lock()
+		for _, track := range t.tracks {
+			if time.Since(track.last) > rtpTrackTimeout {
+				log.Infof("rtp track %s timed out", track.id)
+				t.removeTrack(track)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// removeTrack stops the builder of a track. The processes of a track
+// with the stream id are queued for the next track of the stream, the
+// ones of the other tracks are closed. Must be called with the lock
+// held.
+func (t *RTPTransport) removeTrack(track *rtpTrack) {
+	delete(t.tracks, track.ssrc)
+	if t.ids[track.id] == track {
+		delete(t.ids, track.id)
+	}
+	if track.primary {
+		t.requeue(track.id)
+	}
+	close(track.removed)
+}
+
+// Close the rtp transport
+func (t *RTPTransport) Close() error {
+	t.mu.Lock()
+	if t.closed.get() {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed.set(true)
+	t.stopPending()
+
+	if t.onCloseFn != nil {
+		t.onCloseFn()
+	}
+
+	close(t.done)
+	var err error
+	for _, conn := range t.conns {
+		if cerr := conn.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	t.mu.Unlock()
+
+	t.wg.Wait()
+	return err
+}
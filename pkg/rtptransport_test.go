@@ -0,0 +1,253 @@
+package avp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/transport/test"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSDP = `v=0
+o=- 0 0 IN IP4 127.0.0.1
+s=camera
+c=IN IP4 127.0.0.1
+t=0 0
+m=audio 5002 RTP/AVP 111 0
+a=rtpmap:111 opus/48000/2
+m=video 5004 RTP/AVP 96
+a=mid:camera
+a=rtpmap:96 VP8/90000
+`
+
+func TestParseRTPStreams(t *testing.T) {
+	streams, err := ParseRTPStreams([]byte(testSDP))
+	assert.NoError(t, err)
+	assert.Len(t, streams, 2)
+
+	audio := streams[0]
+	assert.Equal(t, "audio-5002", audio.ID)
+	assert.Equal(t, webrtc.RTPCodecTypeAudio, audio.Kind)
+	assert.Equal(t, "127.0.0.1:5002", audio.Addr.String())
+	assert.Len(t, audio.Codecs, 2)
+	assert.Equal(t, "audio/opus", audio.Codecs[0].MimeType)
+	assert.Equal(t, uint32(48000), audio.Codecs[0].ClockRate)
+	assert.Equal(t, uint16(2), audio.Codecs[0].Channels)
+	assert.Equal(t, MimeTypePCMU, audio.Codecs[1].MimeType)
+
+	video := streams[1]
+	assert.Equal(t, "camera", video.ID)
+	assert.Equal(t, webrtc.RTPCodecTypeVideo, video.Kind)
+	assert.Equal(t, webrtc.PayloadType(96), video.Codecs[0].PayloadType)
+	assert.Equal(t, "video/VP8", video.Codecs[0].MimeType)
+}
+
+func TestNewRTPTransport_Unsupported(t *testing.T) {
+	_, err := NewRTPTransport("camera", Config{}, []RTPStream{{
+		ID:   "audio",
+		Kind: webrtc.RTPCodecTypeAudio,
+		Addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		Codecs: []webrtc.RTPCodecParameters{{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeG722, ClockRate: 8000},
+			PayloadType:        9,
+		}},
+	}})
+	assert.Equal(t, errNoRTPStreams, err)
+}
+
+type sampleRecorder struct {
+	elementMock
+	samples chan *Sample
+}
+
+func (e *sampleRecorder) Write(s *Sample) error {
+	e.samples <- s
+	return nil
+}
+
+func TestRTPTransport(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	element := &sampleRecorder{samples: make(chan *Sample, 100)}
+	Init(map[string]ElementFun{"test-eid": func(sid, pid, tid string, config []byte) Element {
+		return element
+	}})
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0}
+	listener, err := net.ListenUDP("udp", addr)
+	assert.NoError(t, err)
+	addr = listener.LocalAddr().(*net.UDPAddr)
+	assert.NoError(t, listener.Close())
+
+	transport, err := NewRTPTransport("camera", Config{}, []RTPStream{{
+		ID:   "audio",
+		Kind: webrtc.RTPCodecTypeAudio,
+		Addr: addr,
+		Codecs: []webrtc.RTPCodecParameters{{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeOpus, ClockRate: 48000},
+			PayloadType:        111,
+		}, {
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypePCMU, ClockRate: 8000},
+			PayloadType:        0,
+		}},
+	}})
+	assert.NoError(t, err)
+
+	closed := make(chan struct{})
+	transport.OnClose(func() {
+		close(closed)
+	})
+
+	assert.NoError(t, transport.Process("123", "audio", "test-eid", []byte{}))
+
+	conn, err := net.DialUDP("udp", nil, addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	send := func(ssrc uint32, pt uint8, seq uint16) {
+		pkt := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    pt,
+				SequenceNumber: seq,
+				Timestamp:      uint32(seq) * 960,
+				SSRC:           ssrc,
+			},
+			Payload: []byte{0x01, 0x02, 0x03},
+		}
+		raw, err := pkt.Marshal()
+		assert.NoError(t, err)
+		_, err = conn.Write(raw)
+		assert.NoError(t, err)
+	}
+
+	for seq := uint16(0); seq < 10; seq++ {
+		// codecs without a builder are dropped
+		send(4321, 0, seq)
+		send(1234, 111, seq)
+		// unknown payload types are dropped
+		send(4321, 8, seq)
+	}
+
+	select {
+	case s := <-element.samples:
+		assert.Equal(t, "audio", s.ID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no sample received")
+	}
+
+	// a second ssrc on the stream is a new track
+	for seq := uint16(0); seq < 10; seq++ {
+		send(5678, 111, seq)
+	}
+	assert.Eventually(t, func() bool {
+		transport.mu.RLock()
+		defer transport.mu.RUnlock()
+		return transport.builders["audio-5678"] != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	transport.mu.RLock()
+	assert.Len(t, transport.builders, 2)
+	assert.Nil(t, transport.tracks[4321])
+	transport.mu.RUnlock()
+
+	assert.NoError(t, transport.Close())
+	<-closed
+	assert.NoError(t, transport.Close())
+}
+
+func TestRTPTransport_SSRCChange(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	element := &sampleRecorder{samples: make(chan *Sample, 100)}
+	Init(map[string]ElementFun{"test-eid": func(sid, pid, tid string, config []byte) Element {
+		return element
+	}})
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0}
+	listener, err := net.ListenUDP("udp", addr)
+	assert.NoError(t, err)
+	addr = listener.LocalAddr().(*net.UDPAddr)
+	assert.NoError(t, listener.Close())
+
+	transport, err := NewRTPTransport("camera", Config{}, []RTPStream{{
+		ID:   "audio",
+		Kind: webrtc.RTPCodecTypeAudio,
+		Addr: addr,
+		Codecs: []webrtc.RTPCodecParameters{{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeOpus, ClockRate: 48000},
+			PayloadType:        111,
+		}},
+	}})
+	assert.NoError(t, err)
+	assert.NoError(t, transport.Process("123", "audio", "test-eid", []byte{}))
+
+	conn, err := net.DialUDP("udp", nil, addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	send := func(ssrc uint32, first uint16) {
+		for seq := first; seq < first+10; seq++ {
+			raw, err := (&rtp.Packet{
+				Header:  rtp.Header{Version: 2, PayloadType: 111, SequenceNumber: seq, Timestamp: uint32(seq) * 960, SSRC: ssrc},
+				Payload: []byte{0x01, 0x02, 0x03},
+			}).Marshal()
+			assert.NoError(t, err)
+			_, err = conn.Write(raw)
+			assert.NoError(t, err)
+		}
+	}
+	received := func() {
+		select {
+		case s := <-element.samples:
+			assert.Equal(t, "audio", s.ID)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no sample received")
+		}
+	}
+	track := func() *rtpTrack {
+		transport.mu.RLock()
+		defer transport.mu.RUnlock()
+		if b := transport.builders["audio"]; b != nil {
+			return b.Track().(*rtpTrack)
+		}
+		return nil
+	}
+
+	send(1234, 0)
+	received()
+
+	// the sender restarted with a new ssrc after the track went idle
+	transport.mu.Lock()
+	transport.tracks[1234].last = time.Now().Add(-time.Minute)
+	transport.mu.Unlock()
+	send(5678, 0)
+	assert.Eventually(t, func() bool {
+		track := track()
+		return track != nil && track.SSRC() == 5678
+	}, 5*time.Second, 10*time.Millisecond)
+	for len(element.samples) > 0 {
+		<-element.samples
+	}
+	// the process was attached to the new track
+	send(5678, 10)
+	received()
+
+	// idle tracks time out, the process waits for the stream
+	transport.mu.Lock()
+	transport.tracks[5678].last = time.Now().Add(-time.Hour)
+	transport.mu.Unlock()
+	assert.Eventually(t, func() bool {
+		return track() == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []ProcessInfo{{PID: "123", TID: "audio", State: ProcessPending}}, transport.Processes())
+	transport.mu.RLock()
+	assert.Empty(t, transport.tracks)
+	transport.mu.RUnlock()
+
+	assert.NoError(t, transport.Close())
+}
@@ -1,11 +1,14 @@
 package avp
 
+import "github.com/pion/rtp"
+
 // Types for samples
 const (
 	TypeOpus = 1
 	TypeVP8  = 2
 	TypeVP9  = 3
 	TypeH264 = 4
+	TypeAV1  = 5
 )
 
 // Sample of audio or video
@@ -15,5 +18,8 @@ type Sample struct {
 	Timestamp          uint32
 	SequenceNumber     uint16
 	PrevDroppedPackets uint16
-	Payload            interface{}
+	// AudioLevel of the audio samples when the ssrc-audio-level
+	// header extension was negotiated
+	AudioLevel *rtp.AudioLevelExtension
+	Payload    interface{}
 }
@@ -0,0 +1,83 @@
+package avp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Track selectors can be used as track id of a process to attach it to
+// all the matching tracks of the session, including the tracks received
+// later:
+//
+//	selector       tracks
+//	*              all tracks
+//	kind=audio     tracks of a kind, audio or video
+//	stream=<id>    tracks of a stream
+//	codec=<codec>  tracks of a codec, e.g. video/vp8 or vp8
+//	regex=<expr>   tracks with an id matching the expression
+//
+// An element is created for each matching track, its constructor
+// gets the id of the track.
+const (
+	selectAll       = "*"
+	selectorKind    = "kind="
+	selectorStream  = "stream="
+	selectorCodec   = "codec="
+	selectorRegexp  = "regex="
+	selectorPIDJoin = "/"
+)
+
+// selector matches the tracks of a selector process
+type selector struct {
+	pid   string
+	tid   string
+	match func(Track) bool
+	fn    func(tid string) Element
+	timer *time.Timer // expires the selector while no track matches
+	waits int         // number of times the expiry was started
+}
+
+// parseSelector returns the match func of a track selector, or nil
+// when tid is a track id.
+func parseSelector(tid string) (func(Track) bool, error) {
+	switch {
+	case tid == selectAll:
+		return func(Track) bool { return true }, nil
+
+	case strings.HasPrefix(tid, selectorKind):
+		kind := webrtc.NewRTPCodecType(strings.TrimPrefix(tid, selectorKind))
+		if kind == 0 {
+			return nil, fmt.Errorf("invalid track kind selector: %s", tid)
+		}
+		return func(t Track) bool { return t.Kind() == kind }, nil
+
+	case strings.HasPrefix(tid, selectorStream):
+		id := strings.TrimPrefix(tid, selectorStream)
+		return func(t Track) bool { return t.StreamID() == id }, nil
+
+	case strings.HasPrefix(tid, selectorCodec):
+		codec := strings.ToLower(strings.TrimPrefix(tid, selectorCodec))
+		return func(t Track) bool {
+			mime := strings.ToLower(t.Codec().MimeType)
+			return mime == codec || strings.TrimPrefix(mime, t.Kind().String()+"/") == codec
+		}, nil
+
+	case strings.HasPrefix(tid, selectorRegexp):
+		re, err := regexp.Compile(strings.TrimPrefix(tid, selectorRegexp))
+		if err != nil {
+			return nil, fmt.Errorf("invalid track regex selector: %w", err)
+		}
+		return func(t Track) bool { return re.MatchString(t.ID()) }, nil
+	}
+
+	return nil, nil
+}
+
+// selectorPID is the id of the process of a selector for a track
+func selectorPID(pid, tid string) string {
+	return pid + selectorPIDJoin + tid
+}
@@ -0,0 +1,129 @@
+package avp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSelector(t *testing.T) {
+	audio := &rtpTrack{
+		id:       "mic",
+		streamID: "alice",
+		kind:     webrtc.RTPCodecTypeAudio,
+		codec:    webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeOpus}},
+	}
+	video := &rtpTrack{
+		id:       "camera",
+		streamID: "bob",
+		kind:     webrtc.RTPCodecTypeVideo,
+		codec:    webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: "video/VP8"}},
+	}
+
+	for _, tc := range []struct {
+		tid          string
+		audio, video bool
+	}{
+		{"*", true, true},
+		{"kind=audio", true, false},
+		{"kind=video", false, true},
+		{"stream=bob", false, true},
+		{"codec=audio/opus", true, false},
+		{"codec=vp8", false, true},
+		{"regex=^cam", false, true},
+	} {
+		match, err := parseSelector(tc.tid)
+		assert.NoError(t, err)
+		assert.NotNil(t, match, tc.tid)
+		assert.Equal(t, tc.audio, match(audio), tc.tid)
+		assert.Equal(t, tc.video, match(video), tc.tid)
+	}
+
+	match, err := parseSelector("camera")
+	assert.NoError(t, err)
+	assert.Nil(t, match)
+
+	_, err = parseSelector("kind=data")
+	assert.Error(t, err)
+	_, err = parseSelector("regex=(")
+	assert.Error(t, err)
+}
+
+func TestSessionSelectors(t *testing.T) {
+	created := make(chan string, 10)
+	Init(map[string]ElementFun{"test-eid": func(sid, pid, tid string, config []byte) Element {
+		created <- pid + ":" + tid
+		return &elementMock{}
+	}})
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0}
+	listener, err := net.ListenUDP("udp", addr)
+	assert.NoError(t, err)
+	addr = listener.LocalAddr().(*net.UDPAddr)
+	assert.NoError(t, listener.Close())
+
+	transport, err := NewRTPTransport("session", Config{}, []RTPStream{
+		{
+			ID:     "audio",
+			Kind:   webrtc.RTPCodecTypeAudio,
+			Addr:   addr,
+			Codecs: []webrtc.RTPCodecParameters{{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeOpus, ClockRate: 48000}, PayloadType: 111}},
+		},
+		{
+			ID:     "video",
+			Kind:   webrtc.RTPCodecTypeVideo,
+			Addr:   addr,
+			Codecs: []webrtc.RTPCodecParameters{{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeVP8, ClockRate: 90000}, PayloadType: 96}},
+		},
+	})
+	assert.NoError(t, err)
+	defer transport.Close()
+
+	conn, err := net.DialUDP("udp", nil, addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	send := func(ssrc uint32, pt uint8) {
+		raw, err := (&rtp.Packet{Header: rtp.Header{Version: 2, PayloadType: pt, SSRC: ssrc}, Payload: []byte{0x01}}).Marshal()
+		assert.NoError(t, err)
+		_, err = conn.Write(raw)
+		assert.NoError(t, err)
+	}
+	waitFor := func(tid string) {
+		assert.Eventually(t, func() bool {
+			transport.mu.RLock()
+			defer transport.mu.RUnlock()
+			return transport.builders[tid] != nil
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	send(1, 111)
+	waitFor("audio")
+
+	// existing tracks are attached
+	assert.NoError(t, transport.Process("rec", "kind=audio", "test-eid", nil))
+	assert.Equal(t, "rec:audio", <-created)
+
+	// and the ones received later
+	send(2, 96)
+	send(3, 111)
+	waitFor("video")
+	waitFor("audio-3")
+	assert.Equal(t, "rec:audio-3", <-created)
+
+	assert.NoError(t, transport.Process("all", "*", "test-eid", nil))
+	assert.Len(t, created, 3)
+
+	transport.mu.RLock()
+	assert.Len(t, transport.processes, 5)
+	assert.NotNil(t, transport.processes["rec/audio"])
+	assert.NotNil(t, transport.processes["all/video"])
+	assert.Equal(t, []string{"rec/audio", "all/audio"}, transport.attached["audio"])
+	transport.mu.RUnlock()
+
+	assert.Error(t, transport.Process("rec", "regex=(", "test-eid", nil))
+}
@@ -0,0 +1,479 @@
+package avp
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/pion/ion-log"
+	"github.com/pion/webrtc/v3"
+)
+
+// Transport is a source of tracks processes attach to
+type Transport interface {
+	ID() string
+	Process(pid, tid, eid string, config []byte) error
+	Processes() []ProcessInfo
+	OnProcessExpired(f func(pid, tid string))
+	OnClose(f func())
+	Close() error
+}
+
+// ProcessState is the state of a process for a track
+type ProcessState int
+
+const (
+	// ProcessPending waits for its track to be received
+	ProcessPending ProcessState = iota
+	// ProcessActive is attached to its track
+	ProcessActive
+)
+
+// ProcessInfo describes a process of a transport
+type ProcessInfo struct {
+	PID   string
+	TID   string
+	State ProcessState
+}
+
+// PendingProcess is a process waiting for its track
+type PendingProcess struct {
+	pid   string
+	fn    func() Element
+	timer *time.Timer
+}
+
+// session manages the sample builders of the tracks received by a
+// transport and the processes attached to them.
+type session struct {
+	id     string
+	config Config
+	mu     sync.RWMutex
+
+	builders  map[string]*Builder          // one builder per track
+	pending   map[string][]*PendingProcess // maps track id to pending element constructors
+	processes map[string]Element           // existing processes
+	attached  map[string][]string          // maps track id to attached process ids
+	selectors []*selector                  // processes attached to the matching tracks
+	timelines map[string]*timeline         // of the requeued tracks
+
+	onCloseFn   func()
+	onEmptyFn   func()                      // called when the last track stopped
+	onExpireFn  func(pid, tid string)       // called when a pending process expired
+	onProcessFn func(pid string, e Element) // called with the lock held when a process is created
+}
+
+func newSession(id string, c Config) *session {
+	return &session{
+		id:        id,
+		config:    c,
+		builders:  make(map[string]*Builder),
+		pending:   make(map[string][]*PendingProcess),
+		processes: make(map[string]Element),
+		attached:  make(map[string][]string),
+		timelines: make(map[string]*timeline),
+	}
+}
+
+// addTrack creates the builder of a track and attaches the processes
+// pending for it.
+func (s *session) addTrack(track Track, opts ...BuilderOption) (*Builder, error) {
+	id := track.ID()
+	log.Debugf("Got track: %s", id)
+
+	maxPacketsLate := s.config.SampleBuilder.AudioMaxLate
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		maxPacketsLate = s.config.SampleBuilder.VideoMaxLate
+	}
+
+	if maxPacketsLate == 0 {
+		log.Warnf("audio/video maxlate should not be 0. Using 100.")
+		maxPacketsLate = 100
+	}
+
+	maxTimeLate := time.Millisecond * time.Duration(s.config.SampleBuilder.MaxLateTimeMs)
+
+	opts = append([]BuilderOption{WithMaxLateTime(maxTimeLate)}, opts...)
+	s.mu.Lock()
+	if t := s.timelines[id]; t != nil {
+		opts = append(opts, withTimeline(t))
+		delete(s.timelines, id)
+	}
+	s.mu.Unlock()
+	builder, err := NewBuilder(track, maxPacketsLate, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.builders[id] = builder
+
+	// If there is a pending pipeline for this track,
+	// initialize the pipeline.
+	if pending := s.pending[id]; len(pending) != 0 {
+		for _, p := range pending {
+			if p.timer != nil {
+				p.timer.Stop()
+			}
+			s.attach(id, builder, p.pid, p.fn)
+		}
+		delete(s.pending, id)
+	}
+
+	for _, sel := range s.selectors {
+		s.attachSelector(sel, id, builder)
+	}
+
+	builder.OnStop(func() {
+		s.mu.Lock()
+		// a detached builder stops after a new one took its id
+		if s.builders[id] == builder {
+			log.Debugf("stop builder %s", id)
+			delete(s.builders, id)
+			delete(s.attached, id)
+			for _, sel := range s.selectors {
+				s.waitSelector(sel)
+			}
+		}
+		s.mu.Unlock()
+
+		if s.isEmpty() && s.onEmptyFn != nil {
+			// No more tracks, cleanup transport
+			s.onEmptyFn()
+		}
+	})
+
+	return builder, nil
+}
+
+// Process creates a pipeline
+func (s *session) Process(pid, tid, eid string, config []byte) error {
+	log.Infof("Process id=%s", pid)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := registry.GetElement(eid)
+	if e == nil {
+		log.Errorf("element not found: %s", eid)
+		return errors.New("element not found")
+	}
+
+	match, err := parseSelector(tid)
+	if err != nil {
+		return err
+	}
+	if match != nil {
+		sel := &selector{
+			pid:   pid,
+			tid:   tid,
+			match: match,
+			fn:    func(tid string) Element { return e(s.id, pid, tid, config) },
+		}
+		s.selectors = append(s.selectors, sel)
+		for id, b := range s.builders {
+			s.attachSelector(sel, id, b)
+		}
+		s.waitSelector(sel)
+		return nil
+	}
+
+	fn := func() Element { return e(s.id, pid, tid, config) }
+
+	b := s.builders[tid]
+	if b == nil {
+		log.Debugf("builder not found for track %s. queuing.", tid)
+		s.queue(tid, pid, fn)
+		return nil
+	}
+
+	s.attach(tid, b, pid, fn)
+
+	return nil
+}
+
+// queue a process until track tid is received. It expires after the
+// pending ttl when configured. Must be called with the lock held.
+func (s *session) queue(tid, pid string, fn func() Element) {
+	p := &PendingProcess{
+		pid: pid,
+		fn:  fn,
+	}
+	if ttl := s.config.Process.PendingTTLMs; ttl != 0 {
+		p.timer = time.AfterFunc(time.Duration(ttl)*time.Millisecond, func() {
+			s.expire(tid, p)
+		})
+	}
+	s.pending[tid] = append(s.pending[tid], p)
+}
+
+// expire removes a pending process whose track was not received. The
+// process is closed when no other track uses it.
+func (s *session) expire(tid string, p *PendingProcess) {
+	s.mu.Lock()
+	pending := s.pending[tid]
+	found := false
+	for i, q := range pending {
+		if q == p {
+			pending = append(pending[:i], pending[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		// attached or transport closed
+		s.mu.Unlock()
+		return
+	}
+	if len(pending) == 0 {
+		delete(s.pending, tid)
+		delete(s.timelines, tid)
+	} else {
+		s.pending[tid] = pending
+	}
+
+	process := s.processes[p.pid]
+	if process != nil && !s.used(p.pid) {
+		delete(s.processes, p.pid)
+	} else {
+		process = nil
+	}
+	onExpireFn := s.onExpireFn
+	s.mu.Unlock()
+
+	log.Warnf("pending process %s expired, track %s not found", p.pid, tid)
+	if process != nil {
+		process.Close()
+	}
+
+	if onExpireFn != nil {
+		onExpireFn(p.pid, tid)
+	}
+
+	if s.isEmpty() && s.onEmptyFn != nil {
+		// Nothing left to wait for, cleanup transport
+		s.onEmptyFn()
+	}
+}
+
+// used returns true when process pid is attached to or pending for a
+// track. Must be called with the lock held.
+func (s *session) used(pid string) bool {
+	for _, pids := range s.attached {
+		for _, attached := range pids {
+			if attached == pid {
+				return true
+			}
+		}
+	}
+	for _, pending := range s.pending {
+		for _, p := range pending {
+			if p.pid == pid {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stopPending stops the expiry of the pending processes and selectors
+// when the transport is closed. Must be called with the lock held.
+func (s *session) stopPending() {
+	for tid, pending := range s.pending {
+		for _, p := range pending {
+			if p.timer != nil {
+				p.timer.Stop()
+			}
+		}
+		delete(s.pending, tid)
+		delete(s.timelines, tid)
+	}
+	for _, sel := range s.selectors {
+		if sel.timer != nil {
+			sel.timer.Stop()
+			sel.timer = nil
+		}
+	}
+	s.selectors = nil
+}
+
+// attach the process pid to the builder of track tid, creating the
+// process with fn if it does not exist yet. Must be called with the
+// lock held.
+func (s *session) attach(tid string, b *Builder, pid string, fn func() Element) {
+	process := s.processes[pid]
+	if process == nil {
+		process = fn()
+		if process == nil {
+			log.Errorf("process %s could not be created", pid)
+			return
+		}
+		s.processes[pid] = process
+
+		if s.onProcessFn != nil {
+			s.onProcessFn(pid, process)
+		}
+	}
+
+	b.AttachElement(process)
+	s.attached[tid] = append(s.attached[tid], pid)
+}
+
+// attachSelector attaches a process of the selector to the builder of
+// track tid when it matches. Must be called with the lock held.
+func (s *session) attachSelector(sel *selector, tid string, b *Builder) {
+	if !sel.match(b.Track()) {
+		return
+	}
+	if sel.timer != nil {
+		sel.timer.Stop()
+		sel.timer = nil
+	}
+
+	pid := selectorPID(sel.pid, tid)
+	for _, attached := range s.attached[tid] {
+		if attached == pid {
+			return
+		}
+	}
+
+	s.attach(tid, b, pid, func() Element { return sel.fn(tid) })
+}
+
+// matched returns true when a track of the session matches the
+// selector. Must be called with the lock held.
+func (s *session) matched(sel *selector) bool {
+	for _, b := range s.builders {
+		if sel.match(b.Track()) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitSelector starts the expiry of a selector matching no track. It
+// expires after the pending ttl when configured. Must be called with
+// the lock held.
+func (s *session) waitSelector(sel *selector) {
+	ttl := s.config.Process.PendingTTLMs
+	if ttl == 0 || sel.timer != nil || s.matched(sel) {
+		return
+	}
+	sel.waits++
+	wait := sel.waits
+	sel.timer = time.AfterFunc(time.Duration(ttl)*time.Millisecond, func() {
+		s.expireSelector(sel, wait)
+	})
+}
+
+// expireSelector removes a selector no track matched within the pending
+// ttl, unless its expiry was stopped or restarted since wait
+func (s *session) expireSelector(sel *selector, wait int) {
+	s.mu.Lock()
+	found := false
+	for i, other := range s.selectors {
+		if other == sel {
+			found = sel.timer != nil && sel.waits == wait && !s.matched(sel)
+			if found {
+				s.selectors = append(s.selectors[:i], s.selectors[i+1:]...)
+			}
+			break
+		}
+	}
+	onExpireFn := s.onExpireFn
+	s.mu.Unlock()
+	if !found {
+		// matched a track or transport closed
+		return
+	}
+
+	log.Warnf("selector process %s expired, no track matches %s", sel.pid, sel.tid)
+	if onExpireFn != nil {
+		onExpireFn(sel.pid, sel.tid)
+	}
+
+	if s.isEmpty() && s.onEmptyFn != nil {
+		// Nothing left to wait for, cleanup transport
+		s.onEmptyFn()
+	}
+}
+
+// requeue detaches the builder of track tid without closing its
+// processes, they are queued until a track with the id is received
+// again and continue on the timeline of the detached builder. Must be
+// called with the lock held.
+func (s *session) requeue(tid string) {
+	if b := s.builders[tid]; b != nil {
+		b.detach()
+		delete(s.builders, tid)
+		if t := b.timeline(); t != nil && len(s.attached[tid]) != 0 {
+			s.timelines[tid] = t
+		}
+	}
+
+	for _, pid := range s.attached[tid] {
+		process := s.processes[pid]
+		s.queue(tid, pid, func() Element { return process })
+	}
+	delete(s.attached, tid)
+}
+
+// isEmpty returns true when the session has no tracks and no process
+// waits for a track, selectors wait for future tracks until they expire
+func (s *session) isEmpty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.builders) == 0 && len(s.pending) == 0 && len(s.selectors) == 0
+}
+
+// Processes returns the pending and active processes of the transport.
+// A selector matching no track yet is pending with the selector as
+// track id.
+func (s *session) Processes() []ProcessInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var infos []ProcessInfo
+	for tid, pending := range s.pending {
+		for _, p := range pending {
+			infos = append(infos, ProcessInfo{PID: p.pid, TID: tid, State: ProcessPending})
+		}
+	}
+	for tid, pids := range s.attached {
+		for _, pid := range pids {
+			infos = append(infos, ProcessInfo{PID: pid, TID: tid, State: ProcessActive})
+		}
+	}
+	for _, sel := range s.selectors {
+		if !s.matched(sel) {
+			infos = append(infos, ProcessInfo{PID: sel.pid, TID: sel.tid, State: ProcessPending})
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].PID != infos[j].PID {
+			return infos[i].PID < infos[j].PID
+		}
+		return infos[i].TID < infos[j].TID
+	})
+	return infos
+}
+
+// OnProcessExpired sets a handler that is called when a pending
+// process expired before its track was received, or a selector process
+// before a track matched it. The tid of a selector is the selector.
+func (s *session) OnProcessExpired(f func(pid, tid string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onExpireFn = f
+}
+
+// ID returns the session id of the transport
+func (s *session) ID() string {
+	return s.id
+}
+
+// OnClose sets a handler that is called when the transport is closed
+func (s *session) OnClose(f func()) {
+	s.onCloseFn = f
+}
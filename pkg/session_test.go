@@ -0,0 +1,301 @@
+package avp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingProcessExpiry(t *testing.T) {
+	Init(map[string]ElementFun{"test-eid": func(sid, pid, tid string, config []byte) Element {
+		return &elementMock{}
+	}})
+
+	c := Config{}
+	c.Process.PendingTTLMs = 50
+	s := newSession("session", c)
+
+	expired := make(chan string, 2)
+	s.OnProcessExpired(func(pid, tid string) {
+		expired <- pid + ":" + tid
+	})
+	empty := make(chan struct{}, 2)
+	s.onEmptyFn = func() {
+		empty <- struct{}{}
+	}
+
+	assert.NoError(t, s.Process("pid", "typo", "test-eid", nil))
+	assert.NoError(t, s.Process("sel", "kind=video", "test-eid", nil))
+	assert.Equal(t, []ProcessInfo{
+		{PID: "pid", TID: "typo", State: ProcessPending},
+		{PID: "sel", TID: "kind=video", State: ProcessPending},
+	}, s.Processes())
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		select {
+		case id := <-expired:
+			ids = append(ids, id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("pending process did not expire")
+		}
+	}
+	assert.ElementsMatch(t, []string{"pid:typo", "sel:kind=video"}, ids)
+
+	// nothing left, the transport can be closed
+	<-empty
+	assert.Empty(t, s.Processes())
+	assert.True(t, s.isEmpty())
+}
+
+func TestPendingProcessAttached(t *testing.T) {
+	Init(map[string]ElementFun{"test-eid": func(sid, pid, tid string, config []byte) Element {
+		return &elementMock{}
+	}})
+
+	c := Config{}
+	c.Process.PendingTTLMs = 50
+	s := newSession("session", c)
+	s.OnProcessExpired(func(pid, tid string) {
+		t.Errorf("attached process %s expired", pid)
+	})
+
+	assert.NoError(t, s.Process("pid", "audio", "test-eid", nil))
+	assert.NoError(t, s.Process("sel", "kind=audio", "test-eid", nil))
+
+	track := &rtpTrack{
+		id:       "audio",
+		streamID: "session",
+		kind:     webrtc.RTPCodecTypeAudio,
+		codec:    webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeOpus, ClockRate: 48000}},
+		packets:  make(chan *rtp.Packet),
+		done:     make(chan struct{}),
+	}
+	_, err := s.addTrack(track)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []ProcessInfo{
+		{PID: "pid", TID: "audio", State: ProcessActive},
+		{PID: "sel/audio", TID: "audio", State: ProcessActive},
+	}, s.Processes())
+
+	// the timers of the attached processes were stopped
+	time.Sleep(100 * time.Millisecond)
+	s.mu.RLock()
+	assert.Empty(t, s.pending)
+	assert.Len(t, s.selectors, 1)
+	assert.NotNil(t, s.processes["pid"])
+	s.mu.RUnlock()
+
+	// the transport closes
+	s.mu.Lock()
+	s.stopPending()
+	s.mu.Unlock()
+	close(track.done)
+	assert.Eventually(t, func() bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return len(s.builders) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+}
+
+func TestSessionNotEmptyWithSelectors(t *testing.T) {
+	Init(map[string]ElementFun{"test-eid": func(sid, pid, tid string, config []byte) Element {
+		return &elementMock{}
+	}})
+
+	s := newSession("session", Config{})
+	empty := make(chan struct{}, 1)
+	s.onEmptyFn = func() {
+		empty <- struct{}{}
+	}
+	assert.NoError(t, s.Process("sel", "kind=audio", "test-eid", nil))
+
+	track := &rtpTrack{
+		id:       "audio",
+		streamID: "session",
+		kind:     webrtc.RTPCodecTypeAudio,
+		codec:    webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeOpus, ClockRate: 48000}},
+		packets:  make(chan *rtp.Packet),
+		done:     make(chan struct{}),
+	}
+	_, err := s.addTrack(track)
+	assert.NoError(t, err)
+
+	// the last track left, the selector waits for the next ones
+	close(track.done)
+	assert.Eventually(t, func() bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return len(s.builders) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, s.isEmpty())
+	assert.Len(t, empty, 0)
+}
+
+func TestSessionSelectorExpiry(t *testing.T) {
+	Init(map[string]ElementFun{"test-eid": func(sid, pid, tid string, config []byte) Element {
+		return &elementMock{}
+	}})
+
+	c := Config{}
+	c.Process.PendingTTLMs = 200
+	s := newSession("session", c)
+	empty := make(chan struct{}, 1)
+	s.onEmptyFn = func() {
+		empty <- struct{}{}
+	}
+	assert.NoError(t, s.Process("sel", "kind=audio", "test-eid", nil))
+
+	// the selector matched a track within the ttl
+	time.Sleep(100 * time.Millisecond)
+	track := &rtpTrack{
+		id:       "audio",
+		streamID: "session",
+		kind:     webrtc.RTPCodecTypeAudio,
+		codec:    webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeOpus, ClockRate: 48000}},
+		packets:  make(chan *rtp.Packet),
+		done:     make(chan struct{}),
+	}
+	_, err := s.addTrack(track)
+	assert.NoError(t, err)
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, []ProcessInfo{{PID: "sel/audio", TID: "audio", State: ProcessActive}}, s.Processes())
+
+	// no track matches it after the last one left
+	close(track.done)
+	assert.Eventually(t, func() bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return len(s.builders) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, s.isEmpty())
+	assert.Equal(t, []ProcessInfo{{PID: "sel", TID: "kind=audio", State: ProcessPending}}, s.Processes())
+
+	select {
+	case <-empty:
+	case <-time.After(5 * time.Second):
+		t.Fatal("selector did not expire")
+	}
+	assert.True(t, s.isEmpty())
+	assert.Empty(t, s.Processes())
+}
+
+func TestSessionRequeueWhileTrackStops(t *testing.T) {
+	Init(map[string]ElementFun{"test-eid": func(sid, pid, tid string, config []byte) Element {
+		return &elementMock{}
+	}})
+
+	s := newSession("session", Config{})
+	assert.NoError(t, s.Process("pid", "audio", "test-eid", nil))
+
+	track := &rtpTrack{
+		id:       "audio",
+		streamID: "session",
+		kind:     webrtc.RTPCodecTypeAudio,
+		codec:    webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeOpus, ClockRate: 48000}},
+		packets:  make(chan *rtp.Packet),
+		done:     make(chan struct{}),
+	}
+	_, err := s.addTrack(track)
+	assert.NoError(t, err)
+
+	// the track ends while a reconnect detaches the builders
+	s.mu.Lock()
+	close(track.done)
+	time.Sleep(100 * time.Millisecond)
+	requeued := make(chan struct{})
+	go func() {
+		s.requeue("audio")
+		close(requeued)
+	}()
+	select {
+	case <-requeued:
+	case <-time.After(5 * time.Second):
+		t.Fatal("requeue deadlocked with the stopping builder")
+	}
+	s.mu.Unlock()
+
+	// the process waits for the next track with the id
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]ProcessInfo{{PID: "pid", TID: "audio", State: ProcessPending}}, s.Processes())
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSessionRequeueContinuesTimeline(t *testing.T) {
+	element := &sampleRecorder{samples: make(chan *Sample, 100)}
+	Init(map[string]ElementFun{"test-eid": func(sid, pid, tid string, config []byte) Element {
+		return element
+	}})
+
+	s := newSession("session", Config{})
+	assert.NoError(t, s.Process("pid", "audio", "test-eid", nil))
+
+	newTrack := func(ssrc uint32) *rtpTrack {
+		return &rtpTrack{
+			id:       "audio",
+			streamID: "session",
+			kind:     webrtc.RTPCodecTypeAudio,
+			ssrc:     webrtc.SSRC(ssrc),
+			codec:    webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: MimeTypeOpus, ClockRate: 48000}},
+			packets:  make(chan *rtp.Packet, 100),
+			done:     make(chan struct{}),
+		}
+	}
+	// ten 20ms packets, the last one stays in the sample builder
+	send := func(track *rtpTrack, seq uint16, ts uint32) []*Sample {
+		for i := uint16(0); i < 10; i++ {
+			track.packets <- &rtp.Packet{
+				Header:  rtp.Header{Version: 2, SequenceNumber: seq + i, Timestamp: ts + uint32(i)*960, SSRC: uint32(track.ssrc)},
+				Payload: []byte{0x01, 0x02, 0x03},
+			}
+		}
+		var samples []*Sample
+		for i := 0; i < 9; i++ {
+			select {
+			case sample := <-element.samples:
+				samples = append(samples, sample)
+			case <-time.After(5 * time.Second):
+				t.Fatal("no sample received")
+			}
+		}
+		return samples
+	}
+
+	first := newTrack(1234)
+	_, err := s.addTrack(first)
+	assert.NoError(t, err)
+	before := send(first, 100, 4294960000)
+
+	// the reconnected sender has a new ssrc, sequence and timestamp base
+	s.mu.Lock()
+	s.requeue("audio")
+	s.mu.Unlock()
+	close(first.done)
+	time.Sleep(200 * time.Millisecond)
+
+	second := newTrack(5678)
+	defer close(second.done)
+	_, err = s.addTrack(second)
+	assert.NoError(t, err)
+	after := send(second, 40000, 123456)
+
+	// the samples continue after the time the track was gone
+	last := before[len(before)-1]
+	assert.Equal(t, last.SequenceNumber+1, after[0].SequenceNumber)
+	gap := after[0].Timestamp - last.Timestamp
+	assert.True(t, gap >= 200*48 && gap < 5000*48, "gap of %d", gap)
+	for i := 1; i < len(after); i++ {
+		assert.Equal(t, after[i-1].SequenceNumber+1, after[i].SequenceNumber)
+		assert.Equal(t, after[i-1].Timestamp+960, after[i].Timestamp)
+	}
+
+	s.mu.RLock()
+	assert.Empty(t, s.timelines)
+	s.mu.RUnlock()
+}
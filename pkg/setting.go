@@ -0,0 +1,167 @@
+package avp
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/ice/v2"
+	log "github.com/pion/ion-log"
+	"github.com/pion/webrtc/v3"
+)
+
+var (
+	// ice muxes listen on a single port, they are shared by all
+	// the peer connections of the process
+	muxLock  sync.Mutex
+	udpMuxes = make(map[int]ice.UDPMux)
+	tcpMuxes = make(map[int]ice.TCPMux)
+	// listeners of the muxes, closing a mux doesn't close them
+	udpConns = make(map[int]*net.UDPConn)
+)
+
+// newSettingEngine creates the setting engine shared by the transport
+// peer connections from the webrtc config.
+func newSettingEngine(c webrtcconf) (webrtc.SettingEngine, error) {
+	se := webrtc.SettingEngine{}
+
+	var icePortStart, icePortEnd uint16
+
+	if len(c.ICEPortRange) == 2 {
+		icePortStart = c.ICEPortRange[0]
+		icePortEnd = c.ICEPortRange[1]
+	}
+
+	if icePortStart != 0 || icePortEnd != 0 {
+		if err := se.SetEphemeralUDPPortRange(icePortStart, icePortEnd); err != nil {
+			return se, err
+		}
+	}
+
+	if c.ICESinglePort != 0 {
+		mux, err := udpMux(c.ICESinglePort)
+		if err != nil {
+			return se, err
+		}
+		se.SetICEUDPMux(mux)
+	}
+
+	networkTypes := c.Candidates.NetworkTypes
+	if c.Candidates.TCPPort != 0 {
+		mux, err := tcpMux(c.Candidates.TCPPort)
+		if err != nil {
+			return se, err
+		}
+		se.SetICETCPMux(mux)
+
+		// tcp candidates are only gathered for tcp network types
+		if len(networkTypes) == 0 {
+			networkTypes = []string{"udp4", "udp6", "tcp4", "tcp6"}
+		}
+	}
+
+	if len(networkTypes) != 0 {
+		var types []webrtc.NetworkType
+		for _, raw := range networkTypes {
+			typ, err := webrtc.NewNetworkType(raw)
+			if err != nil {
+				return se, err
+			}
+			types = append(types, typ)
+		}
+		se.SetNetworkTypes(types)
+	}
+
+	if len(c.Candidates.Interfaces) != 0 {
+		interfaces := c.Candidates.Interfaces
+		se.SetInterfaceFilter(func(name string) bool {
+			for _, i := range interfaces {
+				if i == name {
+					return true
+				}
+			}
+			return false
+		})
+	}
+
+	if len(c.Candidates.NAT1To1IPs) != 0 {
+		// the ips replace the host candidates or are announced as srflx
+		// candidates, pion has no other mapping
+		var typ webrtc.ICECandidateType
+		switch strings.ToLower(c.Candidates.NAT1To1Type) {
+		case "", "host":
+			typ = webrtc.ICECandidateTypeHost
+		case "srflx":
+			typ = webrtc.ICECandidateTypeSrflx
+		default:
+			return se, fmt.Errorf("invalid nat1to1 type: %s", c.Candidates.NAT1To1Type)
+		}
+		se.SetNAT1To1IPs(c.Candidates.NAT1To1IPs, typ)
+	}
+
+	switch strings.ToLower(c.Candidates.MDNS) {
+	case "":
+	case "disabled":
+		se.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+	case "queryonly":
+		se.SetICEMulticastDNSMode(ice.MulticastDNSModeQueryOnly)
+	case "queryandgather":
+		se.SetICEMulticastDNSMode(ice.MulticastDNSModeQueryAndGather)
+	default:
+		return se, fmt.Errorf("invalid mdns mode: %s", c.Candidates.MDNS)
+	}
+
+	if c.Timeouts.ICEDisconnectedTimeout != 0 || c.Timeouts.ICEFailedTimeout != 0 || c.Timeouts.ICEKeepaliveInterval != 0 {
+		// zero values keep the pion defaults
+		se.SetICETimeouts(
+			time.Duration(c.Timeouts.ICEDisconnectedTimeout)*time.Second,
+			time.Duration(c.Timeouts.ICEFailedTimeout)*time.Second,
+			time.Duration(c.Timeouts.ICEKeepaliveInterval)*time.Second,
+		)
+	}
+
+	return se, nil
+}
+
+// udpMux returns the udp mux listening on port
+func udpMux(port int) (ice.UDPMux, error) {
+	muxLock.Lock()
+	defer muxLock.Unlock()
+
+	if mux := udpMuxes[port]; mux != nil {
+		return mux, nil
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Listening for ice udp on %s", conn.LocalAddr())
+
+	mux := ice.NewUDPMuxDefault(ice.UDPMuxParams{UDPConn: conn})
+	udpMuxes[port] = mux
+	udpConns[port] = conn
+	return mux, nil
+}
+
+// tcpMux returns the tcp mux listening on port
+func tcpMux(port int) (ice.TCPMux, error) {
+	muxLock.Lock()
+	defer muxLock.Unlock()
+
+	if mux := tcpMuxes[port]; mux != nil {
+		return mux, nil
+	}
+
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{Port: port})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Listening for ice tcp on %s", listener.Addr())
+
+	mux := ice.NewTCPMuxDefault(ice.TCPMuxParams{Listener: listener, ReadBufferSize: 8})
+	tcpMuxes[port] = mux
+	return mux, nil
+}
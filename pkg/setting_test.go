@@ -0,0 +1,53 @@
+package avp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSettingEngine(t *testing.T) {
+	_, err := newSettingEngine(webrtcconf{
+		ICEPortRange: []uint16{50000, 60000},
+		Candidates: candidateconf{
+			NAT1To1IPs:   []string{"1.2.3.4"},
+			NAT1To1Type:  "srflx",
+			NetworkTypes: []string{"udp4"},
+			Interfaces:   []string{"eth0"},
+			MDNS:         "disabled",
+		},
+		Timeouts: timeoutconf{ICEDisconnectedTimeout: 5, ICEFailedTimeout: 25, ICEKeepaliveInterval: 2},
+	})
+	assert.NoError(t, err)
+
+	_, err = newSettingEngine(webrtcconf{Candidates: candidateconf{NetworkTypes: []string{"sctp"}}})
+	assert.Error(t, err)
+
+	_, err = newSettingEngine(webrtcconf{Candidates: candidateconf{MDNS: "always"}})
+	assert.Error(t, err)
+
+	_, err = newSettingEngine(webrtcconf{Candidates: candidateconf{NAT1To1IPs: []string{"1.2.3.4"}, NAT1To1Type: "relay"}})
+	assert.Error(t, err)
+
+	_, err = newSettingEngine(webrtcconf{Candidates: candidateconf{NAT1To1IPs: []string{"1.2.3.4"}, NAT1To1Type: "host"}})
+	assert.NoError(t, err)
+}
+
+func TestNewSettingEngine_SharedMux(t *testing.T) {
+	_, err := newSettingEngine(webrtcconf{ICESinglePort: 55123})
+	assert.NoError(t, err)
+
+	// A second transport reuses the listening mux
+	_, err = newSettingEngine(webrtcconf{ICESinglePort: 55123})
+	assert.NoError(t, err)
+
+	muxLock.Lock()
+	assert.Len(t, udpMuxes, 1)
+	for port, mux := range udpMuxes {
+		assert.NoError(t, mux.Close())
+		assert.NoError(t, udpConns[port].Close())
+		delete(udpMuxes, port)
+		delete(udpConns, port)
+	}
+	muxLock.Unlock()
+}
@@ -17,13 +17,11 @@ type Subscriber struct {
 
 // NewSubscriber creates a new Subscriber
 func NewSubscriber(cfg WebRTCTransportConfig) (*Subscriber, error) {
-	me := webrtc.MediaEngine{}
-	err := me.RegisterDefaultCodecs()
+	api, err := cfg.newAPI()
 	if err != nil {
 		log.Errorf("NewSubscriber error: %v", err)
 		return nil, errPeerConnectionInitFailed
 	}
-	api := webrtc.NewAPI(webrtc.WithMediaEngine(&me), webrtc.WithSettingEngine(cfg.setting))
 	pc, err := api.NewPeerConnection(cfg.configuration)
 
 	if err != nil {
@@ -68,6 +66,23 @@ func (s *Subscriber) Answer(offer webrtc.SessionDescription) (webrtc.SessionDesc
 	return answer, nil
 }
 
+// AnswerGathered answers the offer once ice gathering is complete, the
+// answer includes all the local candidates for signaling without trickle ice.
+func (s *Subscriber) AnswerGathered(offer webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+	gathered := webrtc.GatheringCompletePromise(s.pc)
+	if _, err := s.Answer(offer); err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+	<-gathered
+	return *s.pc.LocalDescription(), nil
+}
+
+// OnICEConnectionStateChange sets a handler called when the ice
+// connection state of the peer connection changes
+func (s *Subscriber) OnICEConnectionStateChange(f func(webrtc.ICEConnectionState)) {
+	s.pc.OnICEConnectionStateChange(f)
+}
+
 // OnICECandidate handler
 func (s *Subscriber) OnICECandidate(f func(c *webrtc.ICECandidate)) {
 	s.pc.OnICECandidate(f)
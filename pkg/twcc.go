@@ -0,0 +1,231 @@
+package avp
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	log "github.com/pion/ion-log"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+)
+
+const (
+	twccInterval      = 100 * time.Millisecond
+	twccReferenceUnit = 64 * time.Millisecond
+	twccMaxRunLength  = 1<<13 - 1
+)
+
+// twccInterceptor sends transport wide congestion control feedback
+// for the incoming streams that negotiated the transport-cc extension.
+type twccInterceptor struct {
+	interceptor.NoOp
+	mu        sync.Mutex
+	start     time.Time
+	arrivals  map[int64]time.Time // unwrapped transport sequence number to arrival time
+	lastSeq   uint16
+	cycles    int64
+	started   bool
+	mediaSSRC uint32
+	fbCount   uint8
+	close     chan struct{}
+	wg        sync.WaitGroup
+}
+
+func newTWCCInterceptor() *twccInterceptor {
+	return &twccInterceptor{
+		start:    time.Now(),
+		arrivals: make(map[int64]time.Time),
+		close:    make(chan struct{}),
+	}
+}
+
+// BindRemoteStream records the arrival time of incoming packets
+func (t *twccInterceptor) BindRemoteStream(info *interceptor.StreamInfo, reader interceptor.RTPReader) interceptor.RTPReader {
+	var id uint8
+	for _, ext := range info.RTPHeaderExtensions {
+		if ext.URI == sdp.TransportCCURI {
+			id = uint8(ext.ID)
+		}
+	}
+	if id == 0 {
+		return reader
+	}
+
+	return interceptor.RTPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		i, attr, err := reader.Read(b, a)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		header := rtp.Header{}
+		if err := header.Unmarshal(b[:i]); err != nil {
+			return 0, nil, err
+		}
+		if ext := header.GetExtension(id); len(ext) >= 2 {
+			t.record(header.SSRC, binary.BigEndian.Uint16(ext), time.Now())
+		}
+		return i, attr, nil
+	})
+}
+
+// BindRTCPWriter starts sending feedback on the rtcp writer
+func (t *twccInterceptor) BindRTCPWriter(writer interceptor.RTCPWriter) interceptor.RTCPWriter {
+	t.wg.Add(1)
+	go t.loop(writer)
+	return writer
+}
+
+// Close stops sending feedback
+func (t *twccInterceptor) Close() error {
+	t.mu.Lock()
+	select {
+	case <-t.close:
+	default:
+		close(t.close)
+	}
+	t.mu.Unlock()
+	t.wg.Wait()
+	return nil
+}
+
+func (t *twccInterceptor) record(ssrc uint32, seq uint16, arrival time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.started {
+		// unwrap the 16 bit sequence number
+		if seq < 0x4000 && t.lastSeq > 0xc000 {
+			t.cycles++
+		} else if seq > 0xc000 && t.lastSeq < 0x4000 && t.cycles > 0 {
+			// late packet from the previous cycle
+			t.arrivals[(t.cycles-1)<<16|int64(seq)] = arrival
+			return
+		}
+	}
+	t.started = true
+	t.lastSeq = seq
+	t.mediaSSRC = ssrc
+	t.arrivals[t.cycles<<16|int64(seq)] = arrival
+}
+
+func (t *twccInterceptor) loop(writer interceptor.RTCPWriter) {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(twccInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.close:
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			pkt := t.feedback()
+			t.mu.Unlock()
+
+			if pkt == nil {
+				continue
+			}
+			if _, err := writer.Write([]rtcp.Packet{pkt}, interceptor.Attributes{}); err != nil {
+				log.Debugf("error writing twcc feedback: %s", err)
+			}
+		}
+	}
+}
+
+// feedback builds a feedback packet from the packets received since
+// the last feedback. Must be called with the lock held.
+func (t *twccInterceptor) feedback() *rtcp.TransportLayerCC {
+	if len(t.arrivals) == 0 {
+		return nil
+	}
+
+	seqs := make([]int64, 0, len(t.arrivals))
+	for seq := range t.arrivals {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	base := seqs[0]
+	count := seqs[len(seqs)-1] - base + 1
+	if count > math.MaxUint16 {
+		count = math.MaxUint16
+	}
+
+	first := t.arrivals[base]
+	ref := int64(first.Sub(t.start) / twccReferenceUnit)
+	prev := t.start.Add(time.Duration(ref) * twccReferenceUnit)
+
+	symbols := make([]uint16, count)
+	var deltas []*rtcp.RecvDelta
+	for i := int64(0); i < count; i++ {
+		arrival, ok := t.arrivals[base+i]
+		if !ok {
+			symbols[i] = rtcp.TypeTCCPacketNotReceived
+			continue
+		}
+
+		delta := arrival.Sub(prev).Microseconds()
+		prev = arrival
+
+		typ := rtcp.TypeTCCPacketReceivedSmallDelta
+		if delta < 0 || delta/rtcp.TypeTCCDeltaScaleFactor > math.MaxUint8 {
+			typ = rtcp.TypeTCCPacketReceivedLargeDelta
+			if max := int64(math.MaxInt16 * rtcp.TypeTCCDeltaScaleFactor); delta > max {
+				delta = max
+			} else if min := int64(math.MinInt16 * rtcp.TypeTCCDeltaScaleFactor); delta < min {
+				delta = min
+			}
+		}
+		symbols[i] = typ
+		deltas = append(deltas, &rtcp.RecvDelta{Type: typ, Delta: delta})
+	}
+
+	// Encode the packet status with run length chunks
+	var chunks []rtcp.PacketStatusChunk
+	for i := 0; i < len(symbols); {
+		run := 1
+		for i+run < len(symbols) && symbols[i+run] == symbols[i] && run < twccMaxRunLength {
+			run++
+		}
+		chunks = append(chunks, &rtcp.RunLengthChunk{
+			Type:               rtcp.TypeTCCRunLengthChunk,
+			PacketStatusSymbol: symbols[i],
+			RunLength:          uint16(run),
+		})
+		i += run
+	}
+
+	pkt := &rtcp.TransportLayerCC{
+		MediaSSRC:          t.mediaSSRC,
+		BaseSequenceNumber: uint16(base),
+		PacketStatusCount:  uint16(count),
+		ReferenceTime:      uint32(ref) & 0xffffff,
+		FbPktCount:         t.fbCount,
+		PacketChunks:       chunks,
+		RecvDeltas:         deltas,
+	}
+
+	size := 4 + 16 + 2*len(chunks)
+	for _, d := range deltas {
+		if d.Type == rtcp.TypeTCCPacketReceivedSmallDelta {
+			size++
+		} else {
+			size += 2
+		}
+	}
+	pkt.Header = rtcp.Header{
+		Padding: size%4 != 0,
+		Count:   rtcp.FormatTCC,
+		Type:    rtcp.TypeTransportSpecificFeedback,
+		Length:  pkt.Len()/4 - 1,
+	}
+
+	t.fbCount++
+	t.arrivals = make(map[int64]time.Time)
+	return pkt
+}
@@ -0,0 +1,43 @@
+package avp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTWCCInterceptor_Feedback(t *testing.T) {
+	twcc := newTWCCInterceptor()
+	assert.Nil(t, twcc.feedback())
+
+	now := twcc.start.Add(100 * time.Millisecond)
+	twcc.record(1234, 65534, now)
+	twcc.record(1234, 65535, now.Add(5*time.Millisecond))
+	// 0 and 1 are lost
+	twcc.record(1234, 2, now.Add(10*time.Millisecond))
+	twcc.record(1234, 3, now.Add(200*time.Millisecond))
+
+	pkt := twcc.feedback()
+	assert.NotNil(t, pkt)
+	assert.Equal(t, uint16(65534), pkt.BaseSequenceNumber)
+	assert.Equal(t, uint16(6), pkt.PacketStatusCount)
+	assert.Equal(t, uint32(1234), pkt.MediaSSRC)
+	assert.Len(t, pkt.RecvDeltas, 4)
+	assert.Equal(t, rtcp.TypeTCCPacketReceivedLargeDelta, pkt.RecvDeltas[3].Type)
+
+	raw, err := pkt.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(raw)%4)
+
+	decoded := &rtcp.TransportLayerCC{}
+	assert.NoError(t, decoded.Unmarshal(raw))
+	assert.Equal(t, pkt.BaseSequenceNumber, decoded.BaseSequenceNumber)
+	assert.Equal(t, pkt.PacketStatusCount, decoded.PacketStatusCount)
+	assert.Len(t, decoded.RecvDeltas, 4)
+
+	// Received packets are reported only once
+	assert.Nil(t, twcc.feedback())
+	assert.NoError(t, twcc.Close())
+}
@@ -8,7 +8,7 @@ type atomicBool struct {
 	val int32
 }
 
-func (b *atomicBool) set(value bool) { // nolint: unparam
+func (b *atomicBool) set(value bool) {
 	var i int32
 	if value {
 		i = 1
@@ -1,13 +1,12 @@
 package avp
 
 import (
-	"errors"
 	"fmt"
-	"sync"
 	"time"
 
 	log "github.com/pion/ion-log"
 	"github.com/pion/rtcp"
+	"github.com/pion/sdp/v3"
 
 	"github.com/pion/webrtc/v3"
 )
@@ -15,12 +14,19 @@ import (
 const (
 	publisher  = 0
 	subscriber = 1
+
+	defaultICERestarts       = 3
+	defaultReconnectAttempts = 5
+	defaultReconnectInterval = time.Second
 )
 
 // WebRTCTransportConfig represents configuration options
 type WebRTCTransportConfig struct {
-	configuration webrtc.Configuration
-	setting       webrtc.SettingEngine
+	configuration    webrtc.Configuration
+	setting          webrtc.SettingEngine
+	codecs           []codecconf
+	headerExtensions []headerextconf
+	interceptors     interceptorconf
 }
 
 type SFUFeedback struct {
@@ -29,40 +35,40 @@ type SFUFeedback struct {
 	Audio    bool   `json:"audio"`
 }
 
-type PendingProcess struct {
-	pid string
-	fn  func() Element
+// pendingCandidate is an ice candidate gathered before the transport
+// had an ice candidate handler
+type pendingCandidate struct {
+	candidate *webrtc.ICECandidate
+	target    int
 }
 
 // WebRTCTransport represents a webrtc transport
 type WebRTCTransport struct {
-	id  string
+	*session
+	rtc WebRTCTransportConfig
 	pub *Publisher
 	sub *Subscriber
-	mu  sync.RWMutex
 
-	builders  map[string]*Builder         // one builder per track
-	pending   map[string][]PendingProcess // maps track id to pending element constructors
-	processes map[string]Element          // existing processes
-	onCloseFn func()
+	closed       atomicBool
+	done         chan struct{} // closed on Close
+	generation   int           // incremented each time the peer connections are replaced
+	iceRestarts  int
+	reconnecting bool
+
+	onICECandidateFn      func(c *webrtc.ICECandidate, target int)
+	onNegotiationNeededFn func()
+	candidates            []pendingCandidate // gathered while no handler was set
+	negotiationNeeded     bool               // while no handler was set
+	onReconnectFn         func() error
 }
 
 // NewWebRTCTransport creates a new webrtc transport
 func NewWebRTCTransport(id string, c Config) *WebRTCTransport {
 	conf := webrtc.Configuration{}
-	se := webrtc.SettingEngine{}
-
-	var icePortStart, icePortEnd uint16
-
-	if len(c.WebRTC.ICEPortRange) == 2 {
-		icePortStart = c.WebRTC.ICEPortRange[0]
-		icePortEnd = c.WebRTC.ICEPortRange[1]
-	}
-
-	if icePortStart != 0 || icePortEnd != 0 {
-		if err := se.SetEphemeralUDPPortRange(icePortStart, icePortEnd); err != nil {
-			panic(err)
-		}
+	se, err := newSettingEngine(c.WebRTC)
+	if err != nil {
+		log.Errorf("Error configuring webrtc: %s", err)
+		return nil
 	}
 
 	var iceServers []webrtc.ICEServer
@@ -77,93 +83,287 @@ func NewWebRTCTransport(id string, c Config) *WebRTCTransport {
 
 	conf.ICEServers = iceServers
 
-	config := WebRTCTransportConfig{
-		setting:       se,
-		configuration: conf,
+	t := &WebRTCTransport{
+		session: newSession(id, c),
+		rtc: WebRTCTransportConfig{
+			setting:          se,
+			configuration:    conf,
+			codecs:           c.WebRTC.Codecs,
+			headerExtensions: c.WebRTC.HeaderExtensions,
+			interceptors:     c.WebRTC.Interceptors,
+		},
+		done: make(chan struct{}),
+	}
+	t.onProcessFn = t.publish
+	t.onEmptyFn = func() {
+		t.Close()
 	}
 
-	pub, err := NewPublisher(config)
+	t.mu.Lock()
+	err = t.newPeerConnections()
+	t.mu.Unlock()
 	if err != nil {
 		log.Errorf("Error creating peer connection: %s", err)
 		return nil
 	}
 
-	sub, err := NewSubscriber(config)
+	go t.pliLoop(c.WebRTC.PLICycle)
+
+	return t
+}
+
+// newPeerConnections creates the publisher and subscriber peer
+// connections and binds the transport handlers to them. Must be
+// called with the lock held.
+func (t *WebRTCTransport) newPeerConnections() error {
+	pub, err := NewPublisher(t.rtc)
 	if err != nil {
-		log.Errorf("Error creating peer connection: %s", err)
-		return nil
+		return err
 	}
 
-	t := &WebRTCTransport{
-		id:        id,
-		pub:       pub,
-		sub:       sub,
-		builders:  make(map[string]*Builder),
-		pending:   make(map[string][]PendingProcess),
-		processes: make(map[string]Element),
+	sub, err := NewSubscriber(t.rtc)
+	if err != nil {
+		_ = pub.Close()
+		return err
 	}
 
+	t.generation++
+	gen := t.generation
+
 	sub.OnTrack(func(track *webrtc.TrackRemote, recv *webrtc.RTPReceiver) {
-		id := track.ID()
-		log.Debugf("Got track: %s", id)
+		t.onTrack(sub, track, recv)
+	})
+	pub.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		t.onICEConnectionStateChange(gen, publisher, state)
+	})
+	sub.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		t.onICEConnectionStateChange(gen, subscriber, state)
+	})
+
+	pub.OnICECandidate(func(c *webrtc.ICECandidate) {
+		t.onICECandidate(gen, c, publisher)
+	})
+	pub.OnNegotiationNeeded(func() {
+		t.onNegotiationNeeded(gen)
+	})
+	sub.OnICECandidate(func(c *webrtc.ICECandidate) {
+		t.onICECandidate(gen, c, subscriber)
+	})
+	t.candidates = nil
+	t.negotiationNeeded = false
+
+	t.pub = pub
+	t.sub = sub
+	return nil
+}
+
+// onICECandidate passes a candidate to the handler, or keeps it until
+// a handler is set
+func (t *WebRTCTransport) onICECandidate(gen int, c *webrtc.ICECandidate, target int) {
+	t.mu.Lock()
+	if gen != t.generation {
+		t.mu.Unlock()
+		return
+	}
+	f := t.onICECandidateFn
+	if f == nil {
+		t.candidates = append(t.candidates, pendingCandidate{c, target})
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+	f(c, target)
+}
+
+// onNegotiationNeeded calls the handler, or keeps the negotiation until
+// a handler is set
+func (t *WebRTCTransport) onNegotiationNeeded(gen int) {
+	t.mu.Lock()
+	if gen != t.generation {
+		t.mu.Unlock()
+		return
+	}
+	f := t.onNegotiationNeededFn
+	if f == nil {
+		t.negotiationNeeded = true
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+	f()
+}
 
-		maxPacketsLate := c.SampleBuilder.AudioMaxLate
-		if track.Kind() == webrtc.RTPCodecTypeVideo {
-			maxPacketsLate = c.SampleBuilder.VideoMaxLate
+func (t *WebRTCTransport) onTrack(sub *Subscriber, track *webrtc.TrackRemote, recv *webrtc.RTPReceiver) {
+	var opts []BuilderOption
+	for _, ext := range recv.GetParameters().HeaderExtensions {
+		if ext.URI == sdp.AudioLevelURI {
+			opts = append(opts, WithAudioLevelExtension(uint8(ext.ID)))
 		}
+	}
+	if _, err := t.addTrack(track, opts...); err != nil {
+		log.Warnf("dropped track %s: %s", track.ID(), err)
+		return
+	}
 
-		if maxPacketsLate == 0 {
-			log.Warnf("audio/video maxlate should not be 0. Using 100.")
-			maxPacketsLate = 100
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		err := sub.pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{SenderSSRC: uint32(track.SSRC()), MediaSSRC: uint32(track.SSRC())}})
+		if err != nil {
+			log.Errorf("error writing pli %s", err)
 		}
+	}
+}
 
-		maxTimeLate := time.Millisecond * time.Duration(c.SampleBuilder.MaxLateTimeMs)
+func (t *WebRTCTransport) onICEConnectionStateChange(gen, target int, state webrtc.ICEConnectionState) {
+	t.mu.Lock()
+	if t.closed.get() || gen != t.generation {
+		// event from a peer connection that has been replaced
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+
+	log.Debugf("transport %s target %d ice connection state: %s", t.id, target, state)
+
+	switch state {
+	case webrtc.ICEConnectionStateConnected:
+		if target == publisher {
+			t.mu.Lock()
+			t.iceRestarts = 0
+			t.mu.Unlock()
+		}
+	case webrtc.ICEConnectionStateDisconnected:
+		// Only the publisher can restart ice, the sfu is the
+		// offerer for the subscriber.
+		if target == publisher {
+			t.restartICE()
+		}
+	case webrtc.ICEConnectionStateFailed:
+		t.reconnect()
+	}
+}
 
-		builder := MustBuilder(NewBuilder(track, maxPacketsLate, WithMaxLateTime(maxTimeLate)))
+// restartICE renegotiates the publisher with an ice restart,
+// at most icerestarts times until it is connected again.
+func (t *WebRTCTransport) restartICE() {
+	maxRestarts := t.config.WebRTC.Reconnect.ICERestarts
+	if maxRestarts == 0 {
+		maxRestarts = defaultICERestarts
+	}
+
+	t.mu.Lock()
+	if t.onNegotiationNeededFn == nil || t.iceRestarts >= maxRestarts {
+		t.mu.Unlock()
+		return
+	}
+	t.iceRestarts++
+	pub, negotiate := t.pub, t.onNegotiationNeededFn
+	t.mu.Unlock()
+
+	log.Infof("restarting ice for transport %s", t.id)
+	pub.RestartICE()
+	negotiate()
+}
+
+// reconnect replaces the failed peer connections and rejoins the
+// session. Attached processes are kept and resume on the new tracks.
+// The transport is closed when all attempts fail.
+func (t *WebRTCTransport) reconnect() {
+	t.mu.Lock()
+	if t.reconnecting || t.closed.get() {
+		t.mu.Unlock()
+		return
+	}
+	t.reconnecting = true
+	rejoin := t.onReconnectFn
+	t.mu.Unlock()
+
+	if rejoin == nil {
+		log.Infof("transport %s failed", t.id)
+		t.Close()
+		return
+	}
+
+	// the attempts back off, out of the ice state callback
+	go t.reconnectLoop(rejoin)
+}
+
+func (t *WebRTCTransport) reconnectLoop(rejoin func() error) {
+	defer func() {
 		t.mu.Lock()
-		defer t.mu.Unlock()
-		t.builders[id] = builder
-
-		// If there is a pending pipeline for this track,
-		// initialize the pipeline.
-		if pending := t.pending[id]; len(pending) != 0 {
-			for _, p := range pending {
-				process := t.processes[p.pid]
-				if process == nil {
-					process = p.fn()
-					t.processes[p.pid] = process
+		t.reconnecting = false
+		t.mu.Unlock()
+	}()
+
+	attempts := t.config.WebRTC.Reconnect.Attempts
+	if attempts == 0 {
+		attempts = defaultReconnectAttempts
+	}
+	interval := time.Duration(t.config.WebRTC.Reconnect.IntervalMs) * time.Millisecond
+	if interval == 0 {
+		interval = defaultReconnectInterval
+	}
+
+	for i := 1; i <= attempts; i++ {
+		if t.closed.get() {
+			return
+		}
+
+		log.Infof("reconnecting transport %s (%d/%d)", t.id, i, attempts)
+		err := t.reset()
+		if err == nil {
+			if err = rejoin(); err == nil {
+				t.mu.Lock()
+				// the rejoin bound the handlers, negotiation of the
+				// published tracks goes to the new signal stream
+				t.reconnecting = false
+				for pid, process := range t.processes {
+					t.publish(pid, process)
 				}
-				builder.AttachElement(process)
+				t.mu.Unlock()
+				return
 			}
-			delete(t.pending, id)
 		}
+		log.Errorf("error reconnecting transport %s: %s", t.id, err)
 
-		if track.Kind() == webrtc.RTPCodecTypeVideo {
-			err := sub.pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{SenderSSRC: uint32(track.SSRC()), MediaSSRC: uint32(track.SSRC())}})
-			if err != nil {
-				log.Errorf("error writing pli %s", err)
-			}
+		select {
+		case <-time.After(interval):
+		case <-t.done:
+			return
 		}
+	}
 
-		builder.OnStop(func() {
-			t.mu.Lock()
-			b := t.builders[id]
-			if b != nil {
-				log.Debugf("stop builder %s", id)
-				delete(t.builders, id)
-			}
-			t.mu.Unlock()
+	log.Errorf("transport %s failed to reconnect", t.id)
+	t.Close()
+}
 
-			if t.isEmpty() {
-				// No more tracks, cleanup transport
-				t.Close()
-			}
-		})
-	})
+// reset replaces the peer connections. Processes attached to the
+// current tracks are queued so they are reattached when the tracks
+// are received again. The handlers of the previous signal stream are
+// cleared, the rejoin sets new ones.
+func (t *WebRTCTransport) reset() error {
+	t.mu.Lock()
+	t.onICECandidateFn = nil
+	t.onNegotiationNeededFn = nil
 
-	go t.pliLoop(c.WebRTC.PLICycle)
+	for id := range t.builders {
+		t.requeue(id)
+	}
 
-	return t
+	pub, sub := t.pub, t.sub
+	if err := t.newPeerConnections(); err != nil {
+		t.mu.Unlock()
+		return err
+	}
+	t.iceRestarts = 0
+	t.mu.Unlock()
+
+	if err := sub.Close(); err != nil {
+		log.Debugf("error closing subscriber: %s", err)
+	}
+	if err := pub.Close(); err != nil {
+		log.Debugf("error closing publisher: %s", err)
+	}
+	return nil
 }
 
 func (t *WebRTCTransport) pliLoop(cycle uint) {
@@ -172,36 +372,38 @@ func (t *WebRTCTransport) pliLoop(cycle uint) {
 	}
 
 	ticker := time.NewTicker(time.Duration(cycle) * time.Millisecond)
+	defer ticker.Stop()
 	for range ticker.C {
-		t.mu.RLock()
-		builders := t.builders
-		t.mu.RUnlock()
-
-		if len(builders) == 0 {
+		if t.closed.get() {
 			return
 		}
 
+		t.mu.RLock()
 		var pkts []rtcp.Packet
-		for _, b := range builders {
+		for _, b := range t.builders {
 			pkts = append(pkts, &rtcp.PictureLossIndication{SenderSSRC: uint32(b.Track().SSRC()), MediaSSRC: uint32(b.Track().SSRC())})
 		}
+		sub := t.sub
+		t.mu.RUnlock()
 
-		err := t.sub.pc.WriteRTCP(pkts)
+		if len(pkts) == 0 {
+			continue
+		}
+
+		err := sub.pc.WriteRTCP(pkts)
 		if err != nil {
 			log.Errorf("error writing pli %s", err)
 		}
 	}
 }
 
-func (t *WebRTCTransport) isEmpty() bool {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-	return len(t.builders) == 0 && len(t.pending) == 0
-}
-
-// OnClose sets a handler that is called when the webrtc transport is closed
-func (t *WebRTCTransport) OnClose(f func()) {
-	t.onCloseFn = f
+// OnReconnect sets a handler that is called after the peer connections
+// failed and were replaced. The handler must rejoin the session and
+// renegotiate both peer connections.
+func (t *WebRTCTransport) OnReconnect(f func() error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onReconnectFn = f
 }
 
 // Close the webrtc transport
@@ -209,6 +411,13 @@ func (t *WebRTCTransport) Close() error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	if t.closed.get() {
+		return nil
+	}
+	t.closed.set(true)
+	close(t.done)
+	t.stopPending()
+
 	if t.onCloseFn != nil {
 		t.onCloseFn()
 	}
@@ -220,63 +429,73 @@ func (t *WebRTCTransport) Close() error {
 	return t.pub.Close()
 }
 
-// Process creates a pipeline
-func (t *WebRTCTransport) Process(pid, tid, eid string, config []byte) error {
-	log.Infof("WebRTCTransport.Process id=%s", pid)
-	t.mu.Lock()
-	defer t.mu.Unlock()
-
-	e := registry.GetElement(eid)
-	if e == nil {
-		log.Errorf("element not found: %s", eid)
-		return errors.New("element not found")
+// publish binds the elements of a process sending media back into the
+// session to the publisher. Must be called with the lock held. Processes
+// are published after a reconnect rejoined the session.
+func (t *WebRTCTransport) publish(pid string, process Element) {
+	if t.reconnecting {
+		return
 	}
-
-	b := t.builders[tid]
-	if b == nil {
-		log.Debugf("builder not found for track %s. queuing.", tid)
-		t.pending[tid] = append(t.pending[tid], PendingProcess{
-			pid: pid,
-			fn:  func() Element { return e(t.id, pid, tid, config) },
-		})
-		return nil
+	for _, p := range Publishables(process) {
+		if err := p.Publish(t.pub); err != nil {
+			log.Errorf("error publishing process %s: %s", pid, err)
+		}
 	}
+}
 
-	process := t.processes[pid]
-	if process == nil {
-		process = e(t.id, pid, tid, config)
-		t.processes[pid] = process
+// OnNegotiationNeeded sets a handler called when the publisher needs to
+// send a new offer to the sfu, e.g. after a process published a track or
+// to restart ice. A negotiation needed before the handler was set is
+// passed to it first.
+func (t *WebRTCTransport) OnNegotiationNeeded(f func()) {
+	t.mu.Lock()
+	t.onNegotiationNeededFn = f
+	pending := t.negotiationNeeded && f != nil
+	if pending {
+		t.negotiationNeeded = false
 	}
+	t.mu.Unlock()
 
-	b.AttachElement(process)
-
-	return nil
+	if pending {
+		f()
+	}
 }
 
 // CreateOffer starts the PeerConnection and generates the localDescription
 func (t *WebRTCTransport) CreateOffer() (webrtc.SessionDescription, error) {
-	return t.pub.CreateOffer()
+	pub, _ := t.peers()
+	return pub.CreateOffer()
 }
 
 // SetRemoteDescription sets the SessionDescription of the remote peer
 func (t *WebRTCTransport) SetRemoteDescription(desc webrtc.SessionDescription) error {
-	return t.pub.SetRemoteDescription(desc)
+	pub, _ := t.peers()
+	return pub.SetRemoteDescription(desc)
 }
 
 // Answer starts the PeerConnection and generates the localDescription
 func (t *WebRTCTransport) Answer(offer webrtc.SessionDescription) (webrtc.SessionDescription, error) {
-	return t.sub.Answer(offer)
+	_, sub := t.peers()
+	return sub.Answer(offer)
+}
+
+// AnswerGathered answers the offer with all the local ice candidates,
+// for remote peers that don't trickle candidates.
+func (t *WebRTCTransport) AnswerGathered(offer webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+	_, sub := t.peers()
+	return sub.AnswerGathered(offer)
 }
 
 // AddICECandidate accepts an ICE candidate string and adds it to the existing set of candidates
 func (t *WebRTCTransport) AddICECandidate(candidate webrtc.ICECandidateInit, target int) error {
+	pub, sub := t.peers()
 	switch target {
 	case publisher:
-		if err := t.pub.AddICECandidate(candidate); err != nil {
+		if err := pub.AddICECandidate(candidate); err != nil {
 			return fmt.Errorf("error setting ice candidate: %w", err)
 		}
 	case subscriber:
-		if err := t.sub.AddICECandidate(candidate); err != nil {
+		if err := sub.AddICECandidate(candidate); err != nil {
 			return fmt.Errorf("error setting ice candidate: %w", err)
 		}
 	}
@@ -285,11 +504,21 @@ func (t *WebRTCTransport) AddICECandidate(candidate webrtc.ICECandidateInit, tar
 
 // OnICECandidate sets an event handler which is invoked when a new ICE candidate is found.
 // Take note that the handler is gonna be called with a nil pointer when gathering is finished.
+// Candidates gathered before the handler was set are passed to it first.
 func (t *WebRTCTransport) OnICECandidate(f func(c *webrtc.ICECandidate, target int)) {
-	t.pub.OnICECandidate(func(c *webrtc.ICECandidate) {
-		f(c, publisher)
-	})
-	t.sub.OnICECandidate(func(c *webrtc.ICECandidate) {
-		f(c, subscriber)
-	})
+	t.mu.Lock()
+	t.onICECandidateFn = f
+	candidates := t.candidates
+	t.candidates = nil
+	t.mu.Unlock()
+
+	for _, c := range candidates {
+		f(c.candidate, c.target)
+	}
+}
+
+func (t *WebRTCTransport) peers() (*Publisher, *Subscriber) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.pub, t.sub
 }
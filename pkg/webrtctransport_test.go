@@ -2,6 +2,8 @@ package avp
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
@@ -222,3 +224,237 @@ func TestNewWebRTCTransportWithExpectedBuilder(t *testing.T) {
 	assert.NoError(t, transport.Close())
 	assert.NoError(t, remote.Close())
 }
+
+type closeRecorder struct {
+	elementMock
+	closed atomicBool
+}
+
+func (e *closeRecorder) Close() {
+	e.closed.set(true)
+}
+
+func TestWebRTCTransportResetKeepsProcesses(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	me := webrtc.MediaEngine{}
+	_ = me.RegisterDefaultCodecs()
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(&me))
+	remote, err := api.NewPeerConnection(webrtc.Configuration{})
+	assert.NoError(t, err)
+
+	tid := "tid"
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: MimeTypeOpus}, tid, "pion")
+	assert.NoError(t, err)
+
+	_, err = remote.AddTrack(track)
+	assert.NoError(t, err)
+
+	element := &closeRecorder{}
+	Init(map[string]ElementFun{"test-eid": func(sid, pid, tid string, config []byte) Element {
+		return element
+	}})
+
+	transport := NewWebRTCTransport("id", Config{})
+	assert.NotNil(t, transport)
+
+	reconnected := make(chan struct{})
+	transport.OnReconnect(func() error {
+		close(reconnected)
+		return nil
+	})
+
+	assert.NoError(t, transport.Process("123", tid, "test-eid", []byte{}))
+
+	offer, err := remote.CreateOffer(nil)
+	assert.NoError(t, err)
+	gatherComplete := webrtc.GatheringCompletePromise(remote)
+	assert.NoError(t, remote.SetLocalDescription(offer))
+	<-gatherComplete
+	answer, err := transport.Answer(*remote.LocalDescription())
+	assert.NoError(t, err)
+	assert.NoError(t, remote.SetRemoteDescription(answer))
+
+	done := waitForBuilder(transport, tid)
+	sendRTPUntilDone(done, t, []*webrtc.TrackLocalStaticSample{track})
+
+	sub := transport.sub
+	transport.reconnect()
+	<-reconnected
+
+	transport.mu.RLock()
+	assert.NotEqual(t, sub, transport.sub)
+	assert.Len(t, transport.builders, 0)
+	assert.Len(t, transport.pending[tid], 1)
+	assert.Equal(t, element, transport.processes["123"])
+	transport.mu.RUnlock()
+	assert.False(t, element.closed.get())
+
+	assert.NoError(t, transport.Close())
+	assert.NoError(t, remote.Close())
+}
+
+type publishRecorder struct {
+	elementMock
+	mu   sync.Mutex
+	pubs []*Publisher
+}
+
+func (e *publishRecorder) Publish(pub *Publisher) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pubs = append(e.pubs, pub)
+	return nil
+}
+
+func (e *publishRecorder) published() []*Publisher {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Publisher{}, e.pubs...)
+}
+
+type parentMock struct {
+	elementMock
+	children []Element
+}
+
+func (e *parentMock) Children() []Element {
+	return e.children
+}
+
+func TestWebRTCTransportPublishesNestedElements(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	transport := NewWebRTCTransport("id", Config{})
+	assert.NotNil(t, transport)
+
+	// a writer at the end of a chain and one attached twice
+	writer := &publishRecorder{}
+	shared := &publishRecorder{}
+	chain := &parentMock{children: []Element{shared, writer}}
+	process := &parentMock{children: []Element{&elementMock{}, chain, shared}}
+
+	transport.mu.Lock()
+	transport.publish("123", process)
+	transport.mu.Unlock()
+	assert.Len(t, writer.published(), 1)
+	assert.Len(t, shared.published(), 1)
+
+	assert.NoError(t, transport.Close())
+}
+
+func TestWebRTCTransportReconnectRebindsHandlers(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	transport := NewWebRTCTransport("id", Config{})
+	assert.NotNil(t, transport)
+
+	events := make(chan string, 100)
+	next := func() string {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			return "timeout"
+		}
+	}
+
+	// handlers of the first signal stream, the api data channel of the
+	// publisher is negotiated once
+	transport.OnICECandidate(func(c *webrtc.ICECandidate, target int) {
+		events <- "stale candidate"
+	})
+	transport.OnNegotiationNeeded(func() {
+		events <- "negotiation"
+	})
+	assert.Equal(t, "negotiation", next())
+
+	element := &publishRecorder{}
+	transport.mu.Lock()
+	transport.processes["123"] = element
+	transport.publish("123", element)
+	transport.mu.Unlock()
+	assert.Len(t, element.published(), 1)
+
+	transport.OnReconnect(func() error {
+		events <- "rejoin"
+		transport.mu.RLock()
+		assert.Nil(t, transport.onICECandidateFn)
+		assert.Nil(t, transport.onNegotiationNeededFn)
+		transport.mu.RUnlock()
+		// published after the rejoin
+		assert.Len(t, element.published(), 1)
+
+		// the negotiation of the new publisher and the candidates
+		// gathered before the handlers are set are kept
+		_, err := transport.CreateOffer()
+		assert.NoError(t, err)
+		time.Sleep(100 * time.Millisecond)
+		transport.OnNegotiationNeeded(func() {
+			events <- "renegotiation"
+		})
+		transport.OnICECandidate(func(c *webrtc.ICECandidate, target int) {
+			if c != nil {
+				events <- "candidate"
+			}
+		})
+		return nil
+	})
+	transport.reconnect()
+
+	assert.Equal(t, "rejoin", next())
+	assert.Equal(t, "renegotiation", next())
+	assert.Equal(t, "candidate", next())
+	assert.Eventually(t, func() bool {
+		pubs := element.published()
+		return len(pubs) == 2 && pubs[1] == transport.pub
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the remaining events go to the new handlers only
+	assert.NoError(t, transport.Close())
+	for len(events) > 0 {
+		e := <-events
+		assert.Contains(t, []string{"candidate"}, e)
+	}
+}
+
+func TestWebRTCTransportReconnectBackoff(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	c := Config{}
+	c.WebRTC.Reconnect.IntervalMs = uint32(time.Hour / time.Millisecond)
+	transport := NewWebRTCTransport("id", c)
+	assert.NotNil(t, transport)
+
+	attempts := make(chan struct{}, 10)
+	transport.OnReconnect(func() error {
+		attempts <- struct{}{}
+		return errors.New("rejoin failed")
+	})
+
+	// the backoff doesn't block the caller
+	returned := make(chan struct{})
+	go func() {
+		transport.reconnect()
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconnect blocked")
+	}
+	<-attempts
+
+	// and is cancelled on close
+	assert.NoError(t, transport.Close())
+	assert.Eventually(t, func() bool {
+		transport.mu.RLock()
+		defer transport.mu.RUnlock()
+		return !transport.reconnecting
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Len(t, attempts, 0)
+}